@@ -0,0 +1,271 @@
+package rure
+
+import (
+	"fmt"
+	"sync"
+	"unicode/utf8"
+)
+
+// anchoredRegexes holds variants of a Regex that are compiled on first use.
+type anchoredRegexes struct {
+	fullOnce  sync.Once
+	full      *Regex
+	startOnce sync.Once
+	start     *Regex
+	// at holds the variants used by FindAnchoredAt and IsFullMatchAt, which
+	// are indexed as in anchoredAt.
+	at [4]struct {
+		once sync.Once
+		re   *Regex
+	}
+}
+
+// anchoredSets holds variants of a RegexSet that are compiled on first use.
+type anchoredSets struct {
+	fullOnce  sync.Once
+	full      *RegexSet
+	startOnce sync.Once
+	start     *RegexSet
+}
+
+// IsFullMatch returns true if re matches all of text.
+//
+// This is not the same as wrapping a pattern in ^ and $, which changes the
+// meaning of a pattern with a top-level alternation or multi-line mode
+// enabled. Instead, the pattern is wrapped in \A(?:...)\z and compiled with
+// the same flags and options as re the first time it is needed.
+func (re *Regex) IsFullMatch(text string) bool {
+	return re.IsFullMatchBytes(noCopyBytes(text))
+}
+
+// IsFullMatchBytes returns true if re matches all of text.
+func (re *Regex) IsFullMatchBytes(text []byte) bool {
+	a := &re.anchored
+	a.fullOnce.Do(func() {
+		a.full = re.mustCompileAnchored(anchorPrefix, true)
+	})
+	return a.full.IsMatchBytes(text)
+}
+
+// IsFullMatchAt returns true if re matches all of text starting at index
+// start, i.e., if a match of re starts at start and ends at the end of text.
+//
+// Like IsMatchAt, and unlike IsFullMatch(text[start:]), assertions such as
+// ^ and \b observe the text before start, and \A does not match when start
+// is greater than 0.
+func (re *Regex) IsFullMatchAt(text string, start int) bool {
+	return re.IsFullMatchBytesAt(noCopyBytes(text), start)
+}
+
+// IsFullMatchBytesAt returns true if re matches all of text starting at
+// index start.
+func (re *Regex) IsFullMatchBytesAt(text []byte, start int) bool {
+	if start == 0 {
+		return re.IsFullMatchBytes(text)
+	}
+	if start > len(text) {
+		return false
+	}
+	from, at := re.anchoredAt(text, start, true)
+	return at.IsMatchBytes(text[from:])
+}
+
+// FindAnchored returns the end location of the leftmost-first match of re
+// that starts at the beginning of text. If no match starts there, then ok is
+// false, even if re matches later in text.
+//
+// The pattern is wrapped in \A(?:...) and compiled with the same flags and
+// options as re the first time it is needed.
+func (re *Regex) FindAnchored(text string) (end int, ok bool) {
+	return re.FindAnchoredBytes(noCopyBytes(text))
+}
+
+// FindAnchoredBytes returns the end location of the leftmost-first match of
+// re that starts at the beginning of text.
+func (re *Regex) FindAnchoredBytes(text []byte) (end int, ok bool) {
+	a := &re.anchored
+	a.startOnce.Do(func() {
+		a.start = re.mustCompileAnchored(anchorPrefix, false)
+	})
+	_, end, ok = a.start.FindBytes(text)
+	return end, ok
+}
+
+// FindAnchoredAt returns the end location of the leftmost-first match of re
+// that starts at index start of text. If no match starts there, then ok is
+// false, even if re matches later in text.
+//
+// Like IsMatchAt, and unlike FindAnchored(text[start:]), assertions such as
+// ^ and \b observe the text before start, and \A does not match when start
+// is greater than 0. To do so, the pattern is wrapped in \A(?:...) after a
+// prefix that matches the codepoint before start, and compiled with the same
+// flags and options as re the first time it is needed.
+func (re *Regex) FindAnchoredAt(text string, start int) (end int, ok bool) {
+	return re.FindAnchoredBytesAt(noCopyBytes(text), start)
+}
+
+// FindAnchoredBytesAt returns the end location of the leftmost-first match
+// of re that starts at index start of text.
+func (re *Regex) FindAnchoredBytesAt(
+	text []byte,
+	start int,
+) (end int, ok bool) {
+	if start == 0 {
+		return re.FindAnchoredBytes(text)
+	}
+	if start > len(text) {
+		return 0, false
+	}
+	from, at := re.anchoredAt(text, start, false)
+	_, end, ok = at.FindBytes(text[from:])
+	if !ok {
+		return 0, false
+	}
+	return from + end, true
+}
+
+// anchoredAt returns the variant of re that matches at start, which is
+// searched from index from, the start of the codepoint before start. The
+// variant first matches that codepoint with a prefix that depends on whether
+// it is valid UTF-8, and is compiled on first use.
+func (re *Regex) anchoredAt(
+	text []byte,
+	start int,
+	full bool,
+) (from int, at *Regex) {
+	r, size := utf8.DecodeLastRune(text[:start])
+	invalid := r == utf8.RuneError && size == 1
+	i := 0
+	if invalid {
+		i++
+	}
+	if full {
+		i += 2
+	}
+	a := &re.anchored.at[i]
+	a.once.Do(func() {
+		prefix := anchorAtValidPrefix
+		if invalid {
+			prefix = anchorAtInvalidPrefix
+		}
+		a.re = re.mustCompileAnchored(prefix, full)
+	})
+	return start - size, a.re
+}
+
+func (re *Regex) mustCompileAnchored(prefix string, full bool) *Regex {
+	anchored, _, err := wrapPattern(
+		re.pattern, prefix, anchorSuffix(full), re.flags, re.options)
+	if err != nil {
+		panic(fmt.Sprintf("rure: anchoring %s failed: %s", re.pattern, err))
+	}
+	return anchored
+}
+
+// IsFullMatch returns true if any pattern in set matches all of text.
+//
+// Like Regex.IsFullMatch, each pattern is wrapped in \A(?:...)\z and the set
+// is compiled again with the same flags and options the first time it is
+// needed.
+func (set *RegexSet) IsFullMatch(text string) bool {
+	return set.fullSet().IsMatch(text)
+}
+
+// IsFullMatchBytes returns true if any pattern in set matches all of text.
+func (set *RegexSet) IsFullMatchBytes(text []byte) bool {
+	return set.fullSet().IsMatchBytes(text)
+}
+
+// FullMatches returns, for each pattern in set, whether it matches all of
+// text.
+func (set *RegexSet) FullMatches(text string) []bool {
+	return set.fullSet().Matches(text)
+}
+
+// FullMatchesBytes returns, for each pattern in set, whether it matches all
+// of text.
+func (set *RegexSet) FullMatchesBytes(text []byte) []bool {
+	return set.fullSet().MatchesBytes(text)
+}
+
+// IsAnchoredMatch returns true if any pattern in set has a match that starts
+// at the beginning of text.
+//
+// Like Regex.FindAnchored, each pattern is wrapped in \A(?:...) and the set
+// is compiled again with the same flags and options the first time it is
+// needed.
+func (set *RegexSet) IsAnchoredMatch(text string) bool {
+	return set.startSet().IsMatch(text)
+}
+
+// IsAnchoredMatchBytes returns true if any pattern in set has a match that
+// starts at the beginning of text.
+func (set *RegexSet) IsAnchoredMatchBytes(text []byte) bool {
+	return set.startSet().IsMatchBytes(text)
+}
+
+// AnchoredMatches returns, for each pattern in set, whether it has a match
+// that starts at the beginning of text.
+func (set *RegexSet) AnchoredMatches(text string) []bool {
+	return set.startSet().Matches(text)
+}
+
+// AnchoredMatchesBytes returns, for each pattern in set, whether it has a
+// match that starts at the beginning of text.
+func (set *RegexSet) AnchoredMatchesBytes(text []byte) []bool {
+	return set.startSet().MatchesBytes(text)
+}
+
+func (set *RegexSet) fullSet() *RegexSet {
+	a := &set.anchored
+	a.fullOnce.Do(func() {
+		a.full = set.mustCompileAnchored(true)
+	})
+	return a.full
+}
+
+func (set *RegexSet) startSet() *RegexSet {
+	a := &set.anchored
+	a.startOnce.Do(func() {
+		a.start = set.mustCompileAnchored(false)
+	})
+	return a.start
+}
+
+func (set *RegexSet) mustCompileAnchored(full bool) *RegexSet {
+	patterns := make([]string, len(set.patterns))
+	for i, pattern := range set.patterns {
+		patterns[i] = anchorPrefix + pattern + anchorSuffix(full)
+	}
+	anchored, err := compileSet(patterns, set.flags, set.options, true)
+	if err != nil {
+		// Some patterns need a new line before the suffix, which
+		// wrapPattern finds one pattern at a time.
+		for i, pattern := range set.patterns {
+			_, patterns[i], _ = wrapPattern(pattern,
+				anchorPrefix, anchorSuffix(full), set.flags, set.options)
+		}
+		anchored, err = compileSet(patterns, set.flags, set.options, true)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("rure: anchoring %q failed: %s", set.patterns, err))
+	}
+	return anchored
+}
+
+// anchorPrefix and anchorSuffix wrap a pattern in \A(?:...), followed by \z
+// if full is true.
+const anchorPrefix = `\A(?:`
+
+// anchorAtValidPrefix and anchorAtInvalidPrefix are used in place of
+// anchorPrefix to match a pattern after the codepoint before where the match
+// starts, when that codepoint is valid UTF-8 and when it is a byte of invalid
+// UTF-8, respectively.
+const anchorAtValidPrefix = `\A(?su:.)(?:`
+
+func anchorSuffix(full bool) string {
+	if full {
+		return `)\z`
+	}
+	return ")"
+}
@@ -0,0 +1,128 @@
+package rure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsFullMatch(t *testing.T) {
+	re := MustCompile(`foo|bar`)
+	require.True(t, re.IsFullMatch("foo"))
+	require.True(t, re.IsFullMatchBytes([]byte("bar")))
+	require.False(t, re.IsFullMatch("foobar"))
+	require.False(t, re.IsFullMatch("foo "))
+
+	// Leftmost-first semantics don't prevent a longer full match.
+	re = MustCompile(`a|ab`)
+	require.True(t, re.IsFullMatch("ab"))
+
+	re, err := CompileOptions(`\w+$`, FlagMulti|FlagUnicode, nil)
+	require.NoError(t, err)
+	require.True(t, re.IsMatch("abc\ndef"))
+	require.False(t, re.IsFullMatch("abc\ndef"))
+	require.True(t, re.IsFullMatch("abc"))
+}
+
+func TestIsFullMatchComment(t *testing.T) {
+	re, err := CompileOptions("a+ # letters", FlagSpace|FlagUnicode, nil)
+	require.NoError(t, err)
+	require.True(t, re.IsFullMatch("aaa"))
+	require.False(t, re.IsFullMatch("aaab"))
+
+	re = MustCompile("(?x)a # letters\n | b")
+	require.True(t, re.IsFullMatch("b"))
+	end, ok := re.FindAnchored("ab")
+	require.True(t, ok)
+	require.Equal(t, 1, end)
+}
+
+func TestFindAnchored(t *testing.T) {
+	re := MustCompile(`a+|b`)
+	end, ok := re.FindAnchored("aab")
+	require.True(t, ok)
+	require.Equal(t, 2, end)
+
+	end, ok = re.FindAnchoredBytes([]byte("baa"))
+	require.True(t, ok)
+	require.Equal(t, 1, end)
+
+	_, ok = re.FindAnchored("caa")
+	require.False(t, ok)
+	_, ok = re.FindAnchored("")
+	require.False(t, ok)
+
+	end, ok = MustCompile(`x*`).FindAnchored("yx")
+	require.True(t, ok)
+	require.Equal(t, 0, end)
+}
+
+func TestFindAnchoredAt(t *testing.T) {
+	re := MustCompile(`ab`)
+	end, ok := re.FindAnchoredAt("xxab", 2)
+	require.True(t, ok)
+	require.Equal(t, 4, end)
+	_, ok = re.FindAnchoredAt("xxab", 1)
+	require.False(t, ok)
+	_, ok = re.FindAnchoredAt("xxab", 5)
+	require.False(t, ok)
+	end, ok = re.FindAnchoredBytesAt([]byte("\xffab"), 1)
+	require.True(t, ok)
+	require.Equal(t, 3, end)
+
+	// Assertions see the text before start.
+	_, ok = MustCompile(`(?-u:\b)b`).FindAnchoredAt("ab", 1)
+	require.False(t, ok)
+	end, ok = MustCompile(`(?-u:\b)b`).FindAnchoredAt("-b", 1)
+	require.True(t, ok)
+	require.Equal(t, 2, end)
+	// The pure Go fallback can't compile Unicode word boundaries.
+	if re, err := Compile(`\bb`); err == nil {
+		_, ok = re.FindAnchoredAt("éb", 2)
+		require.False(t, ok)
+		end, ok = re.FindAnchoredAt("☃b", 3)
+		require.True(t, ok)
+		require.Equal(t, 4, end)
+	}
+	_, ok = MustCompile(`\Ab`).FindAnchoredAt("ab", 1)
+	require.False(t, ok)
+	re, err := CompileOptions(`^b`, FlagMulti, nil)
+	require.NoError(t, err)
+	end, ok = re.FindAnchoredAt("a\nb", 2)
+	require.True(t, ok)
+	require.Equal(t, 3, end)
+	_, ok = re.FindAnchoredAt("a b", 2)
+	require.False(t, ok)
+}
+
+func TestIsFullMatchAt(t *testing.T) {
+	re := MustCompile(`a|ab`)
+	require.True(t, re.IsFullMatchAt("xab", 1))
+	require.True(t, re.IsFullMatchBytesAt([]byte("ab"), 0))
+	require.False(t, re.IsFullMatchAt("xabc", 1))
+	require.False(t, re.IsFullMatchAt("xab", 2))
+	require.False(t, MustCompile(`(?-u:\b)ab`).IsFullMatchAt("xab", 1))
+
+	re = MustCompile("(?x)b # comment")
+	require.True(t, re.IsFullMatchAt("ab", 1))
+}
+
+func TestSetFullMatch(t *testing.T) {
+	set, err := CompileSetOptions(
+		[]string{`\d+`, `[a-z]+|\d`, "x # comment"},
+		FlagSpace|FlagUnicode, nil)
+	require.NoError(t, err)
+
+	require.True(t, set.IsFullMatch("123"))
+	require.Equal(t, []bool{true, false, false}, set.FullMatches("123"))
+	require.Equal(t,
+		[]bool{true, true, false}, set.FullMatchesBytes([]byte("1")))
+	require.Equal(t, []bool{false, true, true}, set.FullMatches("x"))
+	require.False(t, set.IsFullMatchBytes([]byte("x1")))
+
+	require.True(t, set.IsAnchoredMatch("x1"))
+	require.False(t, set.IsAnchoredMatchBytes([]byte(" x1")))
+	require.Equal(t, []bool{false, true, true}, set.AnchoredMatches("x1"))
+	require.Equal(t,
+		[]bool{true, true, false}, set.AnchoredMatchesBytes([]byte("1x")))
+}
@@ -0,0 +1,7 @@
+//go:build cgo && !purego
+// +build cgo,!purego
+
+package main
+
+// wantCarets are the carets under the error in TestCheckDiagnostic.
+const wantCarets = "^^^^^"
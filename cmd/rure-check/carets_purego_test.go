@@ -0,0 +1,8 @@
+//go:build !cgo || purego
+// +build !cgo purego
+
+package main
+
+// wantCarets are the carets under the error in TestCheckDiagnostic. The pure
+// Go fallback only reports where the error starts.
+const wantCarets = "^"
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	rure "github.com/BurntSushi/rure-go"
+	"github.com/BurntSushi/rure-go/internal/inlineflags"
+)
+
+// runExplain runs the explain subcommand with the given arguments, and
+// returns its exit status.
+func runExplain(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("rure-check explain", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	flagLetters := fs.String("flags", "u",
+		"flags to compile patterns with, as inline flag letters (imsUxu)")
+	jsonOut := fs.Bool("json", false, "write explanations as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	flags, err := inlineflags.Parse(*flagLetters)
+	if err != nil {
+		fmt.Fprintf(stderr, "rure-check: %s\n", err)
+		return 2
+	}
+
+	patterns := fs.Args()
+	if len(patterns) == 0 {
+		scanner := bufio.NewScanner(stdin)
+		scanner.Buffer(nil, 1<<24)
+		for scanner.Scan() {
+			patterns = append(patterns, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			fmt.Fprintf(stderr, "rure-check: <stdin>: %s\n", err)
+			return 2
+		}
+	}
+
+	status := 0
+	w := bufio.NewWriter(stdout)
+	enc := json.NewEncoder(w)
+	for i, pattern := range patterns {
+		e, err := rure.Explain(pattern, flags)
+		if err != nil {
+			fmt.Fprintf(stderr, "rure-check: %q: %s\n", pattern, err)
+			status = 1
+			continue
+		}
+		if *jsonOut {
+			err = enc.Encode(e)
+		} else {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			_, err = io.WriteString(w, e.String())
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintf(stderr, "rure-check: %s\n", err)
+		return 2
+	}
+	return status
+}
@@ -0,0 +1,467 @@
+/*
+Command rure-check compiles regular expressions in bulk with the same engine
+and options used by the rure package, so that files of rules can be validated
+before they are deployed.
+
+Usage:
+
+	rure-check [flags] [file ...]
+
+Patterns are read from each file given, or from stdin if no files are given.
+By default, every line is a pattern, except for blank lines and lines whose
+first non-space character is #. With -input json, or for files whose names end
+in .json, the input is instead a JSON array whose elements are either pattern
+strings or objects like the following, where flags, if present, replaces the
+flags given on the command line:
+
+	{"pattern": "(?P<year>\\d{4})-\\d{2}", "flags": "iu"}
+
+Flags are written like inline flags, as a string of the letters i, m, s, U, x
+and u, so that -flags "" disables Unicode mode.
+
+Every pattern that fails to compile is reported with a diagnostic in the style
+of rustc, with the offending part of the pattern underlined:
+
+	error: unclosed group
+	 --> rules.txt:3:4
+	  |
+	3 | foo(bar
+	  |    ^
+
+Line and column numbers count from 1 and columns count codepoints. For JSON
+input, the location is the file name followed by the index of the pattern in
+the array, and the line and column within the pattern, as in rules.json[2]:1:5.
+
+With -json, a single JSON object is written to stdout instead, which reports
+the result of every pattern:
+
+	{
+	  "checked": 2,
+	  "failed": 1,
+	  "results": [
+	    {"source": "rules.txt", "line": 1, "pattern": "foo", "ok": true},
+	    {"source": "rules.txt", "line": 3, "pattern": "foo(bar", "ok": false,
+	     "error": {"message": "unclosed group", "line": 1, "column": 4,
+	               "length": 1, "text": "regex parse error: ..."}}
+	  ]
+	}
+
+The line of a result is its line in the source for line input, and its index
+is its index in the array for JSON input. The line and column of an error are
+within the pattern, and are 0 when the error has no location, such as when a
+pattern exceeds the size limit.
+
+The exit status is 0 if every pattern compiled, 1 if any pattern failed to
+compile and 2 if the input could not be read.
+
+The explain subcommand describes patterns instead of just checking them, as
+explained by rure.Explain:
+
+	rure-check explain [-flags imsUxu] [-json] [pattern ...]
+
+Each pattern given is explained, or each line of stdin if no patterns are
+given. Flags have the same meaning as above. With -json, each explanation is
+written as a JSON object on its own line. The exit status is 1 if any
+pattern failed to compile.
+*/
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	rure "github.com/BurntSushi/rure-go"
+	"github.com/BurntSushi/rure-go/internal/inlineflags"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// config is the configuration given on the command line.
+type config struct {
+	flags        uint32
+	sizeLimit    int
+	dfaSizeLimit int
+	input        string
+	json         bool
+}
+
+// run runs the command with the given arguments, and returns its exit
+// status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) > 0 && args[0] == "explain" {
+		return runExplain(args[1:], stdin, stdout, stderr)
+	}
+	fs := flag.NewFlagSet("rure-check", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	flags := fs.String("flags", "u",
+		"flags to compile patterns with, as inline flag letters (imsUxu)")
+	sizeLimit := fs.Int("size-limit", 0,
+		"size limit of compiled patterns in bytes (0 is the default limit)")
+	dfaSizeLimit := fs.Int("dfa-size-limit", 0,
+		"size limit of the DFA cache in bytes (0 is the default limit)")
+	input := fs.String("input", "",
+		`format of the input, "lines" or "json" (default: by file name)`)
+	jsonOut := fs.Bool("json", false, "write results as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	cfg := config{
+		sizeLimit:    *sizeLimit,
+		dfaSizeLimit: *dfaSizeLimit,
+		input:        *input,
+		json:         *jsonOut,
+	}
+	var err error
+	if cfg.flags, err = inlineflags.Parse(*flags); err != nil {
+		fmt.Fprintf(stderr, "rure-check: %s\n", err)
+		return 2
+	}
+	if cfg.input != "" && cfg.input != "lines" && cfg.input != "json" {
+		fmt.Fprintf(stderr, "rure-check: unknown input format %q\n", cfg.input)
+		return 2
+	}
+
+	var entries []entry
+	if fs.NArg() == 0 {
+		if entries, err = readEntries("<stdin>", stdin, cfg.input); err != nil {
+			fmt.Fprintf(stderr, "rure-check: %s\n", err)
+			return 2
+		}
+	}
+	for _, name := range fs.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintf(stderr, "rure-check: %s\n", err)
+			return 2
+		}
+		more, err := readEntries(name, f, cfg.input)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(stderr, "rure-check: %s\n", err)
+			return 2
+		}
+		entries = append(entries, more...)
+	}
+
+	results := check(entries, cfg)
+	failed := 0
+	for _, r := range results {
+		if !r.OK {
+			failed++
+		}
+	}
+	if cfg.json {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report{
+			Checked: len(results),
+			Failed:  failed,
+			Results: results,
+		})
+	} else {
+		w := bufio.NewWriter(stdout)
+		for _, r := range results {
+			if !r.OK {
+				writeDiagnostic(w, r)
+			}
+		}
+		if failed > 0 {
+			fmt.Fprintf(w, "%d of %d patterns failed to compile\n",
+				failed, len(results))
+		}
+		err = w.Flush()
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "rure-check: %s\n", err)
+		return 2
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// entry is a pattern read from the input.
+type entry struct {
+	source string
+	// line is the line of the pattern in the source for line input, and
+	// index is its index in the array for JSON input. The other is -1.
+	line, index int
+	pattern     string
+	// flags are the flags of the pattern, if it has its own.
+	flags    string
+	hasFlags bool
+}
+
+// readEntries reads the patterns from the source with the given name, in the
+// given format. If format is empty, then it is chosen by the name.
+func readEntries(name string, r io.Reader, format string) ([]entry, error) {
+	if format == "" {
+		format = "lines"
+		if strings.HasSuffix(name, ".json") {
+			format = "json"
+		}
+	}
+	if format == "json" {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := parseJSON(name, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		return entries, nil
+	}
+
+	var entries []entry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<24)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		entries = append(entries, entry{
+			source:  name,
+			line:    line,
+			index:   -1,
+			pattern: text,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	return entries, nil
+}
+
+// parseJSON parses a JSON array of patterns.
+func parseJSON(name string, data []byte) ([]entry, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	entries := make([]entry, len(raw))
+	for i, msg := range raw {
+		e := entry{source: name, line: -1, index: i}
+		if err := json.Unmarshal(msg, &e.pattern); err != nil {
+			var obj struct {
+				Pattern *string `json:"pattern"`
+				Flags   *string `json:"flags"`
+			}
+			if err := json.Unmarshal(msg, &obj); err != nil {
+				return nil, fmt.Errorf(
+					"element %d is not a string or an object", i)
+			}
+			if obj.Pattern == nil {
+				return nil, fmt.Errorf("element %d has no pattern", i)
+			}
+			e.pattern = *obj.Pattern
+			if obj.Flags != nil {
+				e.flags, e.hasFlags = *obj.Flags, true
+			}
+		}
+		entries[i] = e
+	}
+	return entries, nil
+}
+
+// report is the JSON output.
+type report struct {
+	Checked int      `json:"checked"`
+	Failed  int      `json:"failed"`
+	Results []result `json:"results"`
+}
+
+// result is the result of compiling a pattern.
+type result struct {
+	Source  string      `json:"source"`
+	Line    int         `json:"line,omitempty"`
+	Index   *int        `json:"index,omitempty"`
+	Pattern string      `json:"pattern"`
+	OK      bool        `json:"ok"`
+	Error   *diagnostic `json:"error,omitempty"`
+}
+
+// diagnostic describes why a pattern failed to compile.
+type diagnostic struct {
+	// Message is the short description of the error.
+	Message string `json:"message"`
+	// Line and Column are where the error starts in the pattern, counting
+	// from 1, or 0 if the error has no location. Column counts codepoints.
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	// Length is the number of codepoints underlined.
+	Length int `json:"length"`
+	// Text is the full error message.
+	Text string `json:"text"`
+}
+
+// check compiles every entry and returns the results.
+func check(entries []entry, cfg config) []result {
+	opts := rure.NewOptions()
+	if cfg.sizeLimit > 0 {
+		opts.SetSizeLimit(cfg.sizeLimit)
+	}
+	if cfg.dfaSizeLimit > 0 {
+		opts.SetDFASizeLimit(cfg.dfaSizeLimit)
+	}
+	results := make([]result, len(entries))
+	for i, e := range entries {
+		r := result{Source: e.source, Pattern: e.pattern, OK: true}
+		if e.index >= 0 {
+			index := e.index
+			r.Index = &index
+		} else {
+			r.Line = e.line
+		}
+		flags := cfg.flags
+		var err error
+		if e.hasFlags {
+			flags, err = inlineflags.Parse(e.flags)
+		}
+		if err == nil {
+			_, err = rure.CompileOptions(e.pattern, flags, opts)
+		}
+		if err != nil {
+			d := parseError(e.pattern, err)
+			r.OK, r.Error = false, &d
+		}
+		results[i] = r
+	}
+	return results
+}
+
+var (
+	// rustLineNumber matches the line number that prefixes each line of a
+	// multi-line pattern in a parse error from the Rust regex engine.
+	rustLineNumber = regexp.MustCompile(`^ *(\d+): `)
+	// goSyntaxError matches a parse error from Go's regexp package, which is
+	// used by the pure Go fallback.
+	goSyntaxError = regexp.MustCompile("^error parsing regexp: (.*): `(.*)`$")
+	// goFlags matches the inline flags at the start of a pattern.
+	goFlags = regexp.MustCompile(`^\(\?[a-zA-Z-]*\)`)
+	// fallbackError matches a parse error from the pure Go fallback's
+	// translation of the pattern.
+	fallbackError = regexp.MustCompile(
+		`^regex parse error at offset (\d+): (.*)$`)
+)
+
+// parseError returns a diagnostic for the error from compiling pattern.
+//
+// The Rust regex engine writes the pattern in its parse errors with the span
+// of the error underlined by carets, which are found by column here, while
+// the pure Go fallback's errors either give an offset or quote the offending
+// part of the pattern.
+func parseError(pattern string, err error) diagnostic {
+	text := err.Error()
+	d := diagnostic{Message: text, Text: text}
+	lines := strings.Split(text, "\n")
+	if len(lines) > 2 && lines[0] == "regex parse error:" {
+		d.Message = strings.TrimPrefix(lines[len(lines)-1], "error: ")
+		for i := 2; i < len(lines); i++ {
+			carets := strings.TrimLeft(lines[i], " ")
+			if carets == "" || strings.Trim(carets, "^ ") != "" {
+				continue
+			}
+			d.Line, d.Column = 1, len(lines[i])-len(carets)-4+1
+			if m := rustLineNumber.FindString(lines[i-1]); m != "" {
+				d.Line, _ = strconv.Atoi(strings.TrimSpace(m[:len(m)-2]))
+				d.Column = len(lines[i]) - len(carets) - len(m) + 1
+			}
+			d.Length = len(carets) - len(strings.TrimLeft(carets, "^"))
+			break
+		}
+		return d
+	}
+	if m := fallbackError.FindStringSubmatch(text); m != nil {
+		offset, _ := strconv.Atoi(m[1])
+		d.Message = m[2]
+		d.Line, d.Column = position(pattern, offset)
+		d.Length = 1
+		if offset >= len(pattern) {
+			d.Length = 0
+		}
+		return d
+	}
+	if m := goSyntaxError.FindStringSubmatch(text); m != nil {
+		d.Message = m[1] + ": `" + m[2] + "`"
+		// The quoted part may include the flags that the pattern was
+		// prefixed with by the fallback.
+		unflagged := goFlags.ReplaceAllString(m[2], "")
+		for _, quoted := range []string{m[2], unflagged} {
+			offset := strings.Index(pattern, quoted)
+			if offset >= 0 && quoted != "" {
+				d.Line, d.Column = position(pattern, offset)
+				d.Length = utf8.RuneCountInString(quoted)
+				break
+			}
+		}
+	}
+	return d
+}
+
+// position returns the line and column of a byte offset in pattern, counting
+// from 1.
+func position(pattern string, offset int) (line, column int) {
+	if offset > len(pattern) {
+		offset = len(pattern)
+	}
+	before := pattern[:offset]
+	start := strings.LastIndexByte(before, '\n') + 1
+	return strings.Count(before, "\n") + 1,
+		utf8.RuneCountInString(before[start:]) + 1
+}
+
+// writeDiagnostic writes the diagnostic of a failed result in the style of
+// rustc.
+func writeDiagnostic(w io.Writer, r result) {
+	d := r.Error
+	fmt.Fprintf(w, "error: %s\n", d.Message)
+	location := r.Source
+	if r.Index != nil {
+		location += fmt.Sprintf("[%d]", *r.Index)
+	}
+	if d.Line == 0 {
+		if r.Index == nil {
+			location += fmt.Sprintf(":%d", r.Line)
+		}
+		fmt.Fprintf(w, " --> %s\n\n", location)
+		return
+	}
+	line, number := d.Line, d.Line
+	if r.Index == nil {
+		// A pattern read from a line has only one line.
+		number = r.Line
+	}
+	fmt.Fprintf(w, " --> %s:%d:%d\n", location, number, d.Column)
+
+	lines := strings.Split(r.Pattern, "\n")
+	if line > len(lines) {
+		fmt.Fprintln(w)
+		return
+	}
+	// Tabs are shown as single spaces so that the carets line up.
+	text := strings.Replace(lines[line-1], "\t", " ", -1)
+	gutter := strings.Repeat(" ", len(strconv.Itoa(number)))
+	length := d.Length
+	if length < 1 {
+		length = 1
+	}
+	fmt.Fprintf(w, "%s |\n", gutter)
+	fmt.Fprintf(w, "%d | %s\n", number, text)
+	fmt.Fprintf(w, "%s | %s%s\n\n", gutter,
+		strings.Repeat(" ", d.Column-1), strings.Repeat("^", length))
+}
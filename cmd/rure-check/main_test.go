@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	rure "github.com/BurntSushi/rure-go"
+	"github.com/stretchr/testify/require"
+)
+
+func checkStdin(t *testing.T, input string, args ...string) (string, int) {
+	var stdout, stderr bytes.Buffer
+	status := run(args, strings.NewReader(input), &stdout, &stderr)
+	require.Empty(t, stderr.String())
+	return stdout.String(), status
+}
+
+func TestCheckOK(t *testing.T) {
+	out, status := checkStdin(t, "# comment\n\nfoo\n\\w+\n")
+	require.Equal(t, 0, status)
+	require.Equal(t, "", out)
+}
+
+func TestCheckDiagnostic(t *testing.T) {
+	out, status := checkStdin(t, "foo\n  # comment\nxa{2,1}\n")
+	require.Equal(t, 1, status)
+	require.Contains(t, out, "error: ")
+	require.Contains(t, out, " --> <stdin>:3:3\n")
+	require.Contains(t, out, "  |\n3 | xa{2,1}\n  |   "+wantCarets+"\n")
+	require.Contains(t, out, "1 of 2 patterns failed to compile\n")
+}
+
+func TestCheckFlags(t *testing.T) {
+	// # starts a comment in verbose mode.
+	_, status := checkStdin(t, "(a#)\n", "-flags", "x")
+	require.Equal(t, 1, status)
+	_, status = checkStdin(t, "(a#)\n", "-flags", "iu")
+	require.Equal(t, 0, status)
+
+	var stdout, stderr bytes.Buffer
+	status = run([]string{"-flags", "q"}, nil, &stdout, &stderr)
+	require.Equal(t, 2, status)
+	require.Contains(t, stderr.String(), `unknown flag 'q'`)
+}
+
+func TestCheckJSON(t *testing.T) {
+	input := `["a", {"pattern": "(b", "flags": "i"}, {"pattern": "c"}]`
+	out, status := checkStdin(t, input, "-input", "json", "-json")
+	require.Equal(t, 1, status)
+
+	var got report
+	require.NoError(t, json.Unmarshal([]byte(out), &got))
+	require.Equal(t, 3, got.Checked)
+	require.Equal(t, 1, got.Failed)
+	require.Len(t, got.Results, 3)
+	require.True(t, got.Results[0].OK)
+	require.Equal(t, 0, *got.Results[0].Index)
+	require.False(t, got.Results[1].OK)
+	require.Equal(t, 1, *got.Results[1].Index)
+	require.Equal(t, "(b", got.Results[1].Pattern)
+	require.Equal(t, 1, got.Results[1].Error.Line)
+	require.Equal(t, 1, got.Results[1].Error.Column)
+	require.True(t, got.Results[2].OK)
+}
+
+func TestCheckBadInput(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	status := run([]string{"-input", "json"}, strings.NewReader(`[1]`),
+		&stdout, &stderr)
+	require.Equal(t, 2, status)
+	require.Contains(t, stderr.String(), "element 0")
+
+	stderr.Reset()
+	status = run([]string{"testdata/does-not-exist"}, nil, &stdout, &stderr)
+	require.Equal(t, 2, status)
+}
+
+func TestParseError(t *testing.T) {
+	for _, test := range []struct {
+		pattern string
+		line    int
+		column  int
+		length  int
+	}{
+		{"(abc", 1, 1, 1},
+		{"a{2,1}", 1, 2, 5},
+		{"☃[z-a]", 1, 3, 3},
+		{"(?x)a\n(b", 2, 1, 1},
+	} {
+		_, err := rure.Compile(test.pattern)
+		require.Error(t, err, test.pattern)
+		d := parseError(test.pattern, err)
+		if !strings.HasPrefix(d.Text, "regex parse error:") {
+			// The pure Go fallback reports some errors without a location.
+			continue
+		}
+		require.Equal(t, test.line, d.Line, test.pattern)
+		require.Equal(t, test.column, d.Column, test.pattern)
+		require.Equal(t, test.length, d.Length, test.pattern)
+		require.NotContains(t, d.Message, "\n", test.pattern)
+	}
+}
+
+func TestParseErrorFallback(t *testing.T) {
+	d := parseError("ab(c", errorString("error parsing regexp: "+
+		"missing closing ): `(c`"))
+	require.Equal(t, diagnostic{
+		Message: "missing closing ): `(c`",
+		Line:    1,
+		Column:  3,
+		Length:  2,
+		Text:    "error parsing regexp: missing closing ): `(c`",
+	}, d)
+
+	d = parseError("x\n\\p{Foo}", errorString("regex parse error at "+
+		"offset 2: Unicode class \"Foo\" is not supported"))
+	require.Equal(t, 2, d.Line)
+	require.Equal(t, 1, d.Column)
+	require.Equal(t, `Unicode class "Foo" is not supported`, d.Message)
+
+	d = parseError("a", errorString("Compiled regex exceeds size limit."))
+	require.Equal(t, 0, d.Line)
+	require.Equal(t, "Compiled regex exceeds size limit.", d.Message)
+}
+
+func TestWriteDiagnosticNoLocation(t *testing.T) {
+	var buf bytes.Buffer
+	index := 4
+	writeDiagnostic(&buf, result{
+		Source:  "rules.json",
+		Index:   &index,
+		Pattern: "a",
+		Error:   &diagnostic{Message: "too big"},
+	})
+	require.Equal(t, "error: too big\n --> rules.json[4]\n\n", buf.String())
+}
+
+type errorString string
+
+func (err errorString) Error() string {
+	return string(err)
+}
+
+func TestExplain(t *testing.T) {
+	out, status := checkStdin(t, "", "explain", `(?P<a>x)+`)
+	require.Equal(t, 0, status)
+	require.Equal(t, strings.Join([]string{
+		"`(?P<a>x)+` one or more times, as many times as possible " +
+			"(flags: u)",
+		"  `(?P<a>x)` capturing group 1 named \"a\" (flags: u)",
+		"    `x` the literal \"x\" (flags: u)",
+		"",
+	}, "\n"), out)
+
+	out, status = checkStdin(t, "a\nb*\n", "explain", "-json", "-flags", "i")
+	require.Equal(t, 0, status)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 2)
+	var e struct {
+		Pattern string
+		Flags   uint32
+		Root    struct{ Kind string }
+	}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &e))
+	require.Equal(t, "b*", e.Pattern)
+	require.Equal(t, uint32(rure.FlagCaseI), e.Flags)
+	require.Equal(t, "repetition", e.Root.Kind)
+
+	var stdout, stderr bytes.Buffer
+	status = run([]string{"explain", "(a"}, nil, &stdout, &stderr)
+	require.Equal(t, 1, status)
+	require.Contains(t, stderr.String(), `"(a"`)
+}
@@ -0,0 +1,84 @@
+package rure
+
+import "github.com/BurntSushi/rure-go/internal/combine"
+
+// groupPattern compiles pattern, which is given by a user to be combined
+// with other patterns into a single alternation, and returns it along with
+// pattern wrapped in a capturing group. An error is returned if pattern fails
+// to compile or matches the empty string.
+//
+// The names of the capturing groups in pattern are removed from the wrapped
+// pattern, so that patterns using the same names can be combined. Callers
+// find the names with the Regex returned instead.
+func groupPattern(
+	pattern string,
+	flags uint32,
+	options *Options,
+) (*Regex, string, error) {
+	re, err := CompileOptions(pattern, flags, options)
+	if err != nil {
+		return nil, "", err
+	}
+	if re.IsFullMatch("") {
+		return nil, "", combine.ErrMatchesEmpty
+	}
+	_, wrapped, err := wrapPattern(
+		withoutNames(pattern, flags), "(", ")", flags, options)
+	if err != nil {
+		return nil, "", err
+	}
+	return re, wrapped, nil
+}
+
+// wrapPattern compiles pattern between prefix and suffix with
+// combine.Wrap, and returns the compiled pattern along with its text.
+func wrapPattern(
+	pattern, prefix, suffix string,
+	flags uint32,
+	options *Options,
+) (*Regex, string, error) {
+	var re *Regex
+	wrapped, err := combine.Wrap(pattern, prefix, suffix,
+		func(pattern string) error {
+			var err error
+			re, err = compileInternal(pattern, flags, options)
+			return err
+		})
+	return re, wrapped, err
+}
+
+// compileInternal is like CompileOptions, but reports the compile to
+// observers as internal, for patterns built by this package.
+func compileInternal(
+	pattern string,
+	flags uint32,
+	options *Options,
+) (*Regex, error) {
+	re := &Regex{}
+	if err := re.compile(pattern, flags, options, true); err != nil {
+		return nil, err
+	}
+	return re, nil
+}
+
+// withoutNames returns pattern with its named capturing groups replaced by
+// unnamed ones, which keep the same indexes. If pattern can't be parsed, then
+// it is returned as is.
+func withoutNames(pattern string, flags uint32) string {
+	root, _, err := parse(pattern, flags)
+	if err != nil {
+		return pattern
+	}
+	var starts []int
+	var visit func(n *node)
+	visit = func(n *node) {
+		if n.kind == nodeGroup && n.name != "" {
+			starts = append(starts, n.start)
+		}
+		for _, sub := range n.subs {
+			visit(sub)
+		}
+	}
+	visit(root)
+	return combine.WithoutNames(pattern, starts)
+}
@@ -0,0 +1,712 @@
+//go:build cgo && !purego
+// +build cgo,!purego
+
+package rure
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestConformance runs the tests from Rust's regex crate in testdata/regex.
+// See testdata/regex/README.md for details.
+func TestConformance(t *testing.T) {
+	files, err := filepath.Glob("testdata/regex/*.toml")
+	require.NoError(t, err)
+	fowler, err := filepath.Glob("testdata/regex/fowler/*.toml")
+	require.NoError(t, err)
+	files = append(files, fowler...)
+	require.NotEmpty(t, files)
+
+	ran := 0
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		require.NoError(t, err)
+		tests, err := parseRegexTests(string(data))
+		require.NoError(t, err, "parsing %s", file)
+
+		group := strings.TrimSuffix(
+			strings.TrimPrefix(filepath.ToSlash(file), "testdata/regex/"),
+			".toml")
+		for _, test := range tests {
+			test := test
+			t.Run(group+"/"+test.name, func(t *testing.T) {
+				if reason := test.skip(); reason != "" {
+					t.Skip(reason)
+				}
+				ran++
+				if test.set {
+					test.runSet(t)
+				} else {
+					test.run(t)
+				}
+			})
+		}
+	}
+	// Guard against the skip rules or the parser silently dropping
+	// everything.
+	require.True(t, ran > 500, "only %d conformance tests ran", ran)
+}
+
+// regexTest is a single test in the format used by Rust's regex crate.
+type regexTest struct {
+	name            string
+	regexes         []string
+	set             bool
+	haystack        string
+	bounds          []int
+	matches         []testMatch
+	matchLimit      int
+	compiles        bool
+	anchored        bool
+	caseInsensitive bool
+	unicode         bool
+	utf8            bool
+	lineTerminator  string
+	matchKind       string
+	searchKind      string
+}
+
+// testMatch is an expected match. groups[0] is the overall match and the
+// remaining groups are only present when a test specifies captures. A
+// group that did not participate in the match is nil.
+type testMatch struct {
+	id     int
+	groups [][]int
+}
+
+// skip returns a non-empty reason when test relies on configuration that the
+// C API does not expose.
+func (test *regexTest) skip() string {
+	switch {
+	case test.anchored && test.matchLimit != 1:
+		// Anchored tests with a single match report the same thing as
+		// an unanchored search, so those are still run.
+		return "anchored searches are not supported"
+	case test.lineTerminator != "":
+		return "line terminators are not supported"
+	case len(test.bounds) == 2 && test.bounds[1] != len(test.haystack):
+		return "search bounds that end early are not supported"
+	case !test.set && test.matchKind != "leftmost-first":
+		return "only leftmost-first match semantics are supported"
+	case !test.set && test.searchKind != "leftmost":
+		return "only leftmost searches are supported"
+	case test.set && test.matchKind != "all":
+		return "sets only support all match semantics"
+	case test.set && test.searchKind != "overlapping":
+		return "sets only support overlapping searches"
+	case test.utf8 && !isASCII(test.haystack):
+		// librure matches on bytes, so empty matches may split a codepoint,
+		// which is forbidden when a test requires UTF-8 mode. On ASCII
+		// haystacks the distinction doesn't matter.
+		return "UTF-8 mode is not supported"
+	}
+	return ""
+}
+
+func (test *regexTest) flags() uint32 {
+	var flags uint32
+	if test.caseInsensitive {
+		flags |= FlagCaseI
+	}
+	if test.unicode {
+		flags |= FlagUnicode
+	}
+	return flags
+}
+
+func (test *regexTest) run(t *testing.T) {
+	re, err := CompileOptions(test.regexes[0], test.flags(), nil)
+	if !test.compiles {
+		require.Error(t, err)
+		return
+	}
+	require.NoError(t, err)
+	haystack := []byte(test.haystack)
+
+	if len(test.bounds) == 2 && test.bounds[0] > 0 {
+		// The C API only supports a start offset via the *At variants.
+		require.Equal(t,
+			len(test.matches) > 0,
+			re.IsMatchBytesAt(haystack, test.bounds[0]),
+			"IsMatchBytesAt")
+		require.Equal(t,
+			len(test.matches) > 0,
+			re.IsMatchAt(test.haystack, test.bounds[0]),
+			"IsMatchAt")
+		return
+	}
+
+	var want []int
+	for _, m := range test.matches {
+		want = append(want, m.groups[0]...)
+	}
+
+	require.Equal(t, len(test.matches) > 0, re.IsMatchBytes(haystack),
+		"IsMatchBytes")
+	require.Equal(t, len(test.matches) > 0, re.IsMatchAt(test.haystack, 0),
+		"IsMatchAt")
+
+	_, ok := re.ShortestMatchBytes(haystack)
+	require.Equal(t, len(test.matches) > 0, ok, "ShortestMatchBytes")
+
+	start, end, ok := re.FindBytes(haystack)
+	if len(want) > 0 {
+		require.True(t, ok, "FindBytes")
+		require.Equal(t, want[:2], []int{start, end}, "FindBytes")
+	} else {
+		require.False(t, ok, "FindBytes")
+	}
+	start2, end2, ok2 := re.Find(test.haystack)
+	require.Equal(t, []interface{}{start, end, ok},
+		[]interface{}{start2, end2, ok2}, "Find")
+
+	require.Equal(t, want, test.limit(re.FindAllBytes(haystack)),
+		"FindAllBytes")
+	require.Equal(t, want, test.limit(re.FindAll(test.haystack)), "FindAll")
+
+	var got []int
+	it := re.IterBytes(haystack)
+	for it.Next(nil) {
+		start, end := it.Match()
+		got = append(got, start, end)
+	}
+	require.Equal(t, want, test.limit(got), "Iter")
+
+	caps := re.NewCaptures()
+	ok = re.CapturesBytes(caps, haystack)
+	require.Equal(t, len(test.matches) > 0, ok, "CapturesBytes")
+	if ok {
+		require.Equal(t, test.matches[0].groups, test.groups(caps),
+			"CapturesBytes")
+	}
+
+	it = re.IterBytes(haystack)
+	var gotCaps [][][]int
+	for it.Next(caps) {
+		gotCaps = append(gotCaps, test.groups(caps))
+	}
+	if test.matchLimit > 0 && len(gotCaps) > test.matchLimit {
+		gotCaps = gotCaps[:test.matchLimit]
+	}
+	var wantCaps [][][]int
+	for _, m := range test.matches {
+		wantCaps = append(wantCaps, m.groups)
+	}
+	require.Equal(t, wantCaps, gotCaps, "Iter with captures")
+}
+
+func (test *regexTest) runSet(t *testing.T) {
+	set, err := CompileSetOptions(test.regexes, test.flags(), nil)
+	if !test.compiles {
+		require.Error(t, err)
+		return
+	}
+	require.NoError(t, err)
+
+	start := 0
+	if len(test.bounds) == 2 {
+		start = test.bounds[0]
+	}
+	want := make([]bool, len(test.regexes))
+	for _, m := range test.matches {
+		want[m.id] = true
+	}
+	require.Equal(t, want, set.MatchesAt(test.haystack, start), "MatchesAt")
+	require.Equal(t,
+		len(test.matches) > 0, set.IsMatchAt(test.haystack, start),
+		"IsMatchAt")
+}
+
+// limit truncates a slice of match offsets to the test's match limit.
+func (test *regexTest) limit(offsets []int) []int {
+	if test.matchLimit > 0 && len(offsets) > 2*test.matchLimit {
+		return offsets[:2*test.matchLimit]
+	}
+	return offsets
+}
+
+// groups converts caps into the same form as testMatch.groups. If the test
+// only specifies the overall match, then only the overall match is returned.
+func (test *regexTest) groups(caps *Captures) [][]int {
+	n := caps.Len()
+	if len(test.matches) > 0 && len(test.matches[0].groups) == 1 {
+		n = 1
+	}
+	groups := make([][]int, n)
+	for i := range groups {
+		if start, end, ok := caps.Group(i); ok {
+			groups[i] = []int{start, end}
+		}
+	}
+	return groups
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// parseRegexTests parses the TOML test format used by Rust's regex crate.
+func parseRegexTests(data string) ([]*regexTest, error) {
+	tables, err := parseTOMLTables(data, "test")
+	if err != nil {
+		return nil, err
+	}
+	var tests []*regexTest
+	for _, table := range tables {
+		test := &regexTest{
+			compiles:   true,
+			unicode:    true,
+			utf8:       true,
+			matchKind:  "leftmost-first",
+			searchKind: "leftmost",
+		}
+		unescape := false
+		for key, value := range table {
+			var ok bool
+			switch key {
+			case "name":
+				test.name, ok = value.(string)
+			case "regex":
+				switch v := value.(type) {
+				case string:
+					test.regexes, ok = []string{v}, true
+				case []interface{}:
+					test.set, ok = true, true
+					test.regexes = make([]string, len(v))
+					for i := range v {
+						if test.regexes[i], ok = v[i].(string); !ok {
+							break
+						}
+					}
+				}
+			case "haystack":
+				test.haystack, ok = value.(string)
+			case "bounds":
+				if v, isTable := value.(map[string]interface{}); isTable {
+					value = []interface{}{v["start"], v["end"]}
+				}
+				test.bounds, ok = toInts(value)
+			case "matches":
+				test.matches, ok = toMatches(value)
+			case "match-limit":
+				var limit int64
+				limit, ok = value.(int64)
+				test.matchLimit = int(limit)
+			case "compiles":
+				test.compiles, ok = value.(bool)
+			case "anchored":
+				test.anchored, ok = value.(bool)
+			case "case-insensitive":
+				test.caseInsensitive, ok = value.(bool)
+			case "unicode":
+				test.unicode, ok = value.(bool)
+			case "utf8":
+				test.utf8, ok = value.(bool)
+			case "unescape":
+				unescape, ok = value.(bool)
+			case "line-terminator":
+				test.lineTerminator, ok = value.(string)
+			case "match-kind":
+				test.matchKind, ok = value.(string)
+			case "search-kind":
+				test.searchKind, ok = value.(string)
+			default:
+				return nil, fmt.Errorf("test %v: unknown key %q",
+					table["name"], key)
+			}
+			if !ok {
+				return nil, fmt.Errorf("test %v: invalid value for %q: %v",
+					table["name"], key, value)
+			}
+		}
+		if unescape {
+			test.haystack = unescapeHaystack(test.haystack)
+		}
+		tests = append(tests, test)
+	}
+	return tests, nil
+}
+
+// toMatches converts the value of a test's matches key. Each match is
+// either a match as accepted by toMatch or an inline table with an id and
+// a span or spans.
+func toMatches(value interface{}) ([]testMatch, bool) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	matches := []testMatch{}
+	for _, item := range list {
+		var m testMatch
+		switch v := item.(type) {
+		case map[string]interface{}:
+			id, ok := v["id"].(int64)
+			if !ok {
+				return nil, false
+			}
+			if span, ok := v["span"]; ok {
+				m, ok = toMatch(span)
+			} else {
+				m, ok = toMatch(v["spans"])
+			}
+			if !ok {
+				return nil, false
+			}
+			m.id = int(id)
+		default:
+			if m, ok = toMatch(v); !ok {
+				return nil, false
+			}
+		}
+		matches = append(matches, m)
+	}
+	return matches, true
+}
+
+// toMatch converts either a single span or a list of capture group spans,
+// where an empty list marks a group that did not participate.
+func toMatch(value interface{}) (testMatch, bool) {
+	if span, ok := toInts(value); ok {
+		return testMatch{groups: [][]int{span}}, true
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return testMatch{}, false
+	}
+	var m testMatch
+	for _, group := range list {
+		span, ok := toInts(group)
+		if !ok {
+			return testMatch{}, false
+		}
+		if len(span) == 0 {
+			span = nil
+		}
+		m.groups = append(m.groups, span)
+	}
+	return m, true
+}
+
+func toInts(value interface{}) ([]int, bool) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	ints := []int{}
+	for _, item := range list {
+		n, ok := item.(int64)
+		if !ok {
+			return nil, false
+		}
+		ints = append(ints, int(n))
+	}
+	return ints, true
+}
+
+// unescapeHaystack interprets the escape sequences \xNN, \n, \r, \t, \0 and
+// \\ in s. Any other backslash is left as is.
+func unescapeHaystack(s string) string {
+	var buf []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 >= len(s) {
+			buf = append(buf, s[i])
+			continue
+		}
+		switch s[i+1] {
+		case 'n':
+			buf = append(buf, '\n')
+		case 'r':
+			buf = append(buf, '\r')
+		case 't':
+			buf = append(buf, '\t')
+		case '0':
+			buf = append(buf, 0)
+		case '\\':
+			buf = append(buf, '\\')
+		case 'x':
+			if i+3 < len(s) {
+				if b, err := strconv.ParseUint(s[i+2:i+4], 16, 8); err == nil {
+					buf = append(buf, byte(b))
+					i += 3
+					continue
+				}
+			}
+			buf = append(buf, s[i])
+			continue
+		default:
+			buf = append(buf, s[i])
+			continue
+		}
+		i++
+	}
+	return string(buf)
+}
+
+// parseTOMLTables parses the subset of TOML used by the regex crate's tests:
+// an array of tables named name, whose keys are bare and whose values are
+// strings, integers, booleans, arrays or inline tables.
+func parseTOMLTables(data, name string) ([]map[string]interface{}, error) {
+	p := &tomlParser{s: data}
+	var tables []map[string]interface{}
+	for {
+		p.skipSpace(true)
+		if p.pos >= len(p.s) {
+			return tables, nil
+		}
+		if header := "[[" + name + "]]"; strings.HasPrefix(p.rest(), header) {
+			tables = append(tables, map[string]interface{}{})
+			p.pos += len(header)
+			continue
+		}
+		if len(tables) == 0 {
+			return nil, p.errorf("expected [[%s]]", name)
+		}
+		key, value, err := p.keyValue()
+		if err != nil {
+			return nil, err
+		}
+		tables[len(tables)-1][key] = value
+	}
+}
+
+type tomlParser struct {
+	s   string
+	pos int
+}
+
+func (p *tomlParser) rest() string {
+	return p.s[p.pos:]
+}
+
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	line := strings.Count(p.s[:p.pos], "\n") + 1
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// skipSpace skips whitespace and comments, including new lines only when
+// newlines is true.
+func (p *tomlParser) skipSpace(newlines bool) {
+	for p.pos < len(p.s) {
+		switch c := p.s[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '\n' && newlines:
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.s) && p.s[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) keyValue() (string, interface{}, error) {
+	start := p.pos
+	for p.pos < len(p.s) && isTOMLKeyByte(p.s[p.pos]) {
+		p.pos++
+	}
+	key := p.s[start:p.pos]
+	if key == "" {
+		return "", nil, p.errorf("expected key")
+	}
+	p.skipSpace(false)
+	if !strings.HasPrefix(p.rest(), "=") {
+		return "", nil, p.errorf("expected '=' after %q", key)
+	}
+	p.pos++
+	p.skipSpace(false)
+	value, err := p.value()
+	return key, value, err
+}
+
+func isTOMLKeyByte(c byte) bool {
+	return c == '-' || c == '_' ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') ||
+		('0' <= c && c <= '9')
+}
+
+func (p *tomlParser) value() (interface{}, error) {
+	rest := p.rest()
+	switch {
+	case strings.HasPrefix(rest, "'''"):
+		return p.multiLineString("'''", false)
+	case strings.HasPrefix(rest, `"""`):
+		return p.multiLineString(`"""`, true)
+	case strings.HasPrefix(rest, "'"):
+		end := strings.IndexAny(rest[1:], "'\n")
+		if end < 0 || rest[1+end] != '\'' {
+			return nil, p.errorf("unclosed literal string")
+		}
+		p.pos += end + 2
+		return rest[1 : 1+end], nil
+	case strings.HasPrefix(rest, `"`):
+		p.pos++
+		return p.basicString(`"`)
+	case strings.HasPrefix(rest, "["):
+		return p.array()
+	case strings.HasPrefix(rest, "{"):
+		return p.inlineTable()
+	case strings.HasPrefix(rest, "true"):
+		p.pos += 4
+		return true, nil
+	case strings.HasPrefix(rest, "false"):
+		p.pos += 5
+		return false, nil
+	}
+	start := p.pos
+	for p.pos < len(p.s) && strings.IndexByte("+-_0123456789", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+	n, err := strconv.ParseInt(
+		strings.Replace(p.s[start:p.pos], "_", "", -1), 10, 64)
+	if err != nil {
+		return nil, p.errorf("invalid value")
+	}
+	return n, nil
+}
+
+func (p *tomlParser) multiLineString(delim string, escapes bool) (string, error) {
+	p.pos += len(delim)
+	// A new line immediately following the opening delimiter is trimmed.
+	if strings.HasPrefix(p.rest(), "\r\n") {
+		p.pos += 2
+	} else if strings.HasPrefix(p.rest(), "\n") {
+		p.pos++
+	}
+	if escapes {
+		return p.basicString(delim)
+	}
+	end := strings.Index(p.rest(), delim)
+	if end < 0 {
+		return "", p.errorf("unclosed multi-line string")
+	}
+	// Up to two quotes may appear just before the closing delimiter.
+	for strings.HasPrefix(p.rest()[end+1:], delim) {
+		end++
+	}
+	s := p.rest()[:end]
+	p.pos += end + len(delim)
+	return s, nil
+}
+
+// basicString parses the rest of a string with escape sequences, up to and
+// including the closing delimiter.
+func (p *tomlParser) basicString(delim string) (string, error) {
+	var buf strings.Builder
+	for {
+		if p.pos >= len(p.s) {
+			return "", p.errorf("unclosed string")
+		}
+		if strings.HasPrefix(p.rest(), delim) {
+			p.pos += len(delim)
+			return buf.String(), nil
+		}
+		c := p.s[p.pos]
+		if c != '\\' {
+			buf.WriteByte(c)
+			p.pos++
+			continue
+		}
+		p.pos++
+		if p.pos >= len(p.s) {
+			return "", p.errorf("unclosed string")
+		}
+		esc := p.s[p.pos]
+		p.pos++
+		switch esc {
+		case 'b':
+			buf.WriteByte('\b')
+		case 't':
+			buf.WriteByte('\t')
+		case 'n':
+			buf.WriteByte('\n')
+		case 'f':
+			buf.WriteByte('\f')
+		case 'r':
+			buf.WriteByte('\r')
+		case '"', '\\':
+			buf.WriteByte(esc)
+		case 'u', 'U':
+			width := 4
+			if esc == 'U' {
+				width = 8
+			}
+			if p.pos+width > len(p.s) {
+				return "", p.errorf("invalid unicode escape")
+			}
+			cp, err := strconv.ParseUint(p.s[p.pos:p.pos+width], 16, 32)
+			if err != nil {
+				return "", p.errorf("invalid unicode escape")
+			}
+			buf.WriteRune(rune(cp))
+			p.pos += width
+		case '\n', ' ', '\t', '\r':
+			// A line ending backslash trims all following whitespace.
+			p.pos--
+			p.skipSpace(true)
+		default:
+			return "", p.errorf("invalid escape \\%c", esc)
+		}
+	}
+}
+
+func (p *tomlParser) array() ([]interface{}, error) {
+	p.pos++
+	list := []interface{}{}
+	for {
+		p.skipSpace(true)
+		if strings.HasPrefix(p.rest(), "]") {
+			p.pos++
+			return list, nil
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+		p.skipSpace(true)
+		if strings.HasPrefix(p.rest(), ",") {
+			p.pos++
+		} else if !strings.HasPrefix(p.rest(), "]") {
+			return nil, p.errorf("expected ',' or ']' in array")
+		}
+	}
+}
+
+func (p *tomlParser) inlineTable() (map[string]interface{}, error) {
+	p.pos++
+	table := map[string]interface{}{}
+	for {
+		p.skipSpace(false)
+		if strings.HasPrefix(p.rest(), "}") {
+			p.pos++
+			return table, nil
+		}
+		key, value, err := p.keyValue()
+		if err != nil {
+			return nil, err
+		}
+		table[key] = value
+		p.skipSpace(false)
+		if strings.HasPrefix(p.rest(), ",") {
+			p.pos++
+		} else if !strings.HasPrefix(p.rest(), "}") {
+			return nil, p.errorf("expected ',' or '}' in inline table")
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package rure
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoMatch is returned by Unmarshal when the regex does not match.
+var ErrNoMatch = errors.New("rure: no match")
+
+// Unmarshal finds the leftmost-first match of re in text and stores the text
+// of its named capturing groups in the struct that v points to.
+//
+// Each struct field with a tag of the form `rure:"name"` is set from the
+// group called name. A field may be a string, []byte, bool, any integer or
+// floating point type, time.Duration, or any type whose pointer implements
+// encoding.TextUnmarshaler (such as time.Time, which is parsed as RFC 3339).
+// A time.Time field may instead be given a layout for time.Parse with a tag
+// like `rure:"ts,layout=2006-01-02 15:04:05"`. Fields without a rure tag, or
+// with a tag of "-", are ignored.
+//
+// A field may also be a pointer to any of those types, which is useful for
+// groups that don't always participate in a match: the pointer is set to nil
+// if its group did not participate. Other fields are left unchanged when
+// their group does not participate.
+//
+// The first time a struct type is given to Unmarshal for re, its tags are
+// checked against the names of the groups in re, and an error is returned if
+// a tag names a group that doesn't exist. The result of that check is cached,
+// so only the first call for each struct type pays for it.
+//
+// If re does not match text, then ErrNoMatch is returned. If a group's text
+// can't be converted to the type of its field, then an error naming the group
+// is returned, and fields for other groups may have been set.
+//
+// It can be called from multiple goroutines simultaneously.
+func (re *Regex) Unmarshal(text string, v interface{}) error {
+	return re.UnmarshalBytes(noCopyBytes(text), v)
+}
+
+// UnmarshalBytes is like Unmarshal, but for a []byte haystack.
+func (re *Regex) UnmarshalBytes(text []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() ||
+		rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("rure: Unmarshal needs a non-nil struct pointer, "+
+			"not %T", v)
+	}
+	dec, err := re.decoder(rv.Elem().Type())
+	if err != nil {
+		return err
+	}
+	locs := re.FindSubmatchIndexBytes(text)
+	if locs == nil {
+		return ErrNoMatch
+	}
+	for _, f := range dec.fields {
+		start, end := locs[2*f.group], locs[2*f.group+1]
+		field := rv.Elem().Field(f.index)
+		if start < 0 {
+			if field.Kind() == reflect.Ptr {
+				field.Set(reflect.Zero(field.Type()))
+			}
+			continue
+		}
+		if err := f.decode(field, text[start:end]); err != nil {
+			return fmt.Errorf("rure: group %q: %s", f.name, err)
+		}
+	}
+	return nil
+}
+
+// decoder maps the tagged fields of a struct type to groups of a Regex.
+type decoder struct {
+	fields []decoderField
+}
+
+type decoderField struct {
+	name   string
+	group  int
+	index  int
+	layout string
+}
+
+// decoder returns the decoder for typ, building it if this is the first time
+// typ is used with re.
+func (re *Regex) decoder(typ reflect.Type) (*decoder, error) {
+	if dec, ok := re.decoders.Load(typ); ok {
+		return dec.(*decoder), nil
+	}
+	groups := map[string]int{}
+	for i, name := range re.CaptureNames() {
+		if _, ok := groups[name]; !ok && name != "" {
+			groups[name] = i
+		}
+	}
+
+	dec := &decoder{}
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		tag, ok := sf.Tag.Lookup("rure")
+		if !ok || tag == "-" {
+			continue
+		}
+		f := decoderField{name: tag, index: i}
+		if comma := strings.IndexByte(tag, ','); comma >= 0 {
+			f.name, tag = tag[:comma], tag[comma+1:]
+			if !strings.HasPrefix(tag, "layout=") {
+				return nil, fmt.Errorf("rure: field %s of %s: unknown option %q",
+					sf.Name, typ, tag)
+			}
+			f.layout = strings.TrimPrefix(tag, "layout=")
+		}
+		if sf.PkgPath != "" {
+			return nil, fmt.Errorf("rure: field %s of %s is not exported",
+				sf.Name, typ)
+		}
+		if !canDecode(sf.Type) {
+			return nil, fmt.Errorf("rure: field %s of %s: unsupported type %s",
+				sf.Name, typ, sf.Type)
+		}
+		if f.layout != "" && indirect(sf.Type) != timeType {
+			return nil, fmt.Errorf("rure: field %s of %s: layout requires "+
+				"time.Time, not %s", sf.Name, typ, sf.Type)
+		}
+		if f.group, ok = groups[f.name]; !ok {
+			return nil, fmt.Errorf("rure: field %s of %s: no group named %q "+
+				"in %s", sf.Name, typ, f.name, re.pattern)
+		}
+		dec.fields = append(dec.fields, f)
+	}
+	actual, _ := re.decoders.LoadOrStore(typ, dec)
+	return actual.(*decoder), nil
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	bytesType           = reflect.TypeOf([]byte(nil))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+func indirect(typ reflect.Type) reflect.Type {
+	if typ.Kind() == reflect.Ptr {
+		return typ.Elem()
+	}
+	return typ
+}
+
+func canDecode(typ reflect.Type) bool {
+	typ = indirect(typ)
+	if reflect.PtrTo(typ).Implements(textUnmarshalerType) || typ == bytesType {
+		return true
+	}
+	switch typ.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// decode converts text and stores it in field, allocating a new value if
+// field is a pointer.
+func (f *decoderField) decode(field reflect.Value, text []byte) error {
+	if field.Kind() == reflect.Ptr {
+		ptr := reflect.New(field.Type().Elem())
+		if err := f.decode(ptr.Elem(), text); err != nil {
+			return err
+		}
+		field.Set(ptr)
+		return nil
+	}
+
+	if f.layout != "" {
+		t, err := time.Parse(f.layout, string(text))
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText(text)
+	}
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(string(text))
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+	if field.Type() == bytesType {
+		field.SetBytes(append([]byte(nil), text...))
+		return nil
+	}
+
+	s := string(text)
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(s, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(n)
+	}
+	return nil
+}
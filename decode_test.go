@@ -0,0 +1,120 @@
+package rure
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type logLine struct {
+	Time    time.Time     `rure:"ts"`
+	Level   level         `rure:"level"`
+	Took    time.Duration `rure:"took"`
+	Status  *int          `rure:"status"`
+	Ratio   float64       `rure:"ratio"`
+	Cached  bool          `rure:"cached"`
+	Addr    net.IP        `rure:"addr"`
+	Message []byte        `rure:"msg"`
+	Ignored string
+	Skipped string `rure:"-"`
+}
+
+type level int
+
+func (l *level) UnmarshalText(text []byte) error {
+	switch strings.ToLower(string(text)) {
+	case "info":
+		*l = 1
+	case "error":
+		*l = 2
+	}
+	return nil
+}
+
+func TestUnmarshal(t *testing.T) {
+	re := MustCompile(`(?P<ts>\S+) (?P<level>\w+) (?P<took>\S+)` +
+		`(?: status=(?P<status>\d+))? ratio=(?P<ratio>\S+)` +
+		` cached=(?P<cached>\w+) addr=(?P<addr>\S+) (?P<msg>.*)`)
+
+	var line logLine
+	err := re.Unmarshal("2024-01-02T03:04:05Z ERROR 1.5s status=503 "+
+		"ratio=0.25 cached=true addr=10.0.0.1 upstream timed out", &line)
+	require.NoError(t, err)
+	require.Equal(t,
+		time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), line.Time)
+	require.Equal(t, level(2), line.Level)
+	require.Equal(t, 1500*time.Millisecond, line.Took)
+	require.NotNil(t, line.Status)
+	require.Equal(t, 503, *line.Status)
+	require.Equal(t, 0.25, line.Ratio)
+	require.True(t, line.Cached)
+	require.Equal(t, "10.0.0.1", line.Addr.String())
+	require.Equal(t, []byte("upstream timed out"), line.Message)
+
+	err = re.UnmarshalBytes([]byte("2024-01-02T03:04:05Z info 2ms "+
+		"ratio=1 cached=false addr=::1 ok"), &line)
+	require.NoError(t, err)
+	require.Nil(t, line.Status)
+	require.Equal(t, level(1), line.Level)
+	require.Equal(t, []byte("ok"), line.Message)
+
+	require.Equal(t, ErrNoMatch, re.Unmarshal("nope", &line))
+}
+
+func TestUnmarshalLayout(t *testing.T) {
+	var v struct {
+		Day  time.Time  `rure:"day,layout=Jan 2, 2006"`
+		Next *time.Time `rure:"next,layout=2006-01-02"`
+		N    uint8      `rure:"n"`
+	}
+	re := MustCompile(
+		`(?P<day>\w+ \d+, \d+)(?: (?P<next>\S+))?(?: (?P<n>\d+))?`)
+	require.NoError(t, re.Unmarshal("Mar 4, 2021 2021-03-05 7", &v))
+	require.Equal(t, time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC), v.Day)
+	require.Equal(t, time.Date(2021, 3, 5, 0, 0, 0, 0, time.UTC), *v.Next)
+	require.Equal(t, uint8(7), v.N)
+
+	err := re.Unmarshal("Mar 4, 2021 2021-03-05 700", &v)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `group "n"`)
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	re := MustCompile(`(?P<a>\d+)`)
+	var missing struct {
+		A int `rure:"a"`
+		B int `rure:"b"`
+	}
+	err := re.Unmarshal("1", &missing)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `no group named "b"`)
+	// Errors are reported on every call, not just the first.
+	require.Error(t, re.Unmarshal("1", &missing))
+
+	var unexported struct {
+		a int `rure:"a"`
+	}
+	require.Error(t, re.Unmarshal("1", &unexported))
+	_ = unexported.a
+
+	var unsupported struct {
+		A []int `rure:"a"`
+	}
+	require.Error(t, re.Unmarshal("1", &unsupported))
+
+	var badLayout struct {
+		A int `rure:"a,layout=2006"`
+	}
+	require.Error(t, re.Unmarshal("1", &badLayout))
+
+	var ok struct {
+		A int `rure:"a"`
+	}
+	require.Error(t, re.Unmarshal("1", ok))
+	require.Error(t, re.Unmarshal("1", nil))
+	require.NoError(t, re.Unmarshal("12", &ok))
+	require.Equal(t, 12, ok.A)
+}
@@ -56,6 +56,28 @@ when using MustCompile) and selectively disable the flag when one wants to
 match arbitrary bytes. The flag can be disabled in a regular expression with
 (?-u).
 
+Pure Go fallback
+
+When cgo is disabled (e.g., CGO_ENABLED=0) or when the purego build tag is
+set, this package is implemented with Go's regexp package instead of Rust's
+regex library. This permits building without cgo or without librure
+installed, but it is much slower and some features are unavailable.
+
+Patterns are translated to Go's syntax before being compiled, as by
+Translate. Syntax that is only supported by Rust, such as the x flag,
+\u{...} escapes, nested classes, class set operations and the long names of
+Unicode classes, is rewritten into an equivalent form. Syntax that Go does not
+support, or that Go supports with a different meaning, makes compilation fail
+with an Error. This includes Unicode-aware word boundaries (use (?-u:\b) for
+an ASCII word boundary), CRLF mode for ^ and $, and anything that matches
+arbitrary bytes when Unicode mode is disabled, such as (?-u:.) and
+(?-u:\xFF).
+
+The fallback also differs in a few smaller ways: Options are ignored,
+ShortestMatch reports the end of the leftmost-first match, FindAllParallel
+searches on a single goroutine and iteration moves forward by a whole
+codepoint (instead of a single byte) after an empty match.
+
 Performance tips
 
 When matching text, prefer methods in this order: IsMatch, Find, Captures.
@@ -0,0 +1,438 @@
+package rure
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/rure-go/internal/inlineflags"
+)
+
+// maxExplainedRanges is the number of ranges of a class that are written in
+// the description of the class.
+const maxExplainedRanges = 8
+
+// ExplainKind is the kind of an ExplainNode.
+type ExplainKind int
+
+const (
+	// ExplainEmpty matches the empty string.
+	ExplainEmpty ExplainKind = iota
+	// ExplainLiteral matches a literal string.
+	ExplainLiteral
+	// ExplainClass matches a single character from a class, which includes
+	// bracketed classes, escaped classes like \d and \pL, and the dot.
+	ExplainClass
+	// ExplainAssertion matches the empty string at certain positions, such as
+	// ^ and \b.
+	ExplainAssertion
+	// ExplainRepetition repeats its only child.
+	ExplainRepetition
+	// ExplainGroup is a group, capturing or not, with its body as its only
+	// child.
+	ExplainGroup
+	// ExplainFlags sets flags for the rest of the enclosing group, as in
+	// (?i).
+	ExplainFlags
+	// ExplainConcat matches each of its children in sequence.
+	ExplainConcat
+	// ExplainAlternation matches any one of its children, preferring the
+	// first that matches.
+	ExplainAlternation
+)
+
+var explainKindNames = [...]string{
+	ExplainEmpty:       "empty",
+	ExplainLiteral:     "literal",
+	ExplainClass:       "class",
+	ExplainAssertion:   "assertion",
+	ExplainRepetition:  "repetition",
+	ExplainGroup:       "group",
+	ExplainFlags:       "flags",
+	ExplainConcat:      "concat",
+	ExplainAlternation: "alternation",
+}
+
+// String returns the name of the kind, such as "literal".
+func (k ExplainKind) String() string {
+	if k < 0 || int(k) >= len(explainKindNames) {
+		return "ExplainKind(" + strconv.Itoa(int(k)) + ")"
+	}
+	return explainKindNames[k]
+}
+
+// MarshalText implements encoding.TextMarshaler, so that kinds are encoded
+// in JSON by name.
+func (k ExplainKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// RuneRange is an inclusive range of codepoints, or of bytes when Unicode
+// mode is disabled.
+type RuneRange struct {
+	Lo, Hi rune
+}
+
+// ExplainNode describes a part of a pattern.
+type ExplainNode struct {
+	// Kind is the kind of the part.
+	Kind ExplainKind
+	// Start and End are the byte offsets of the part in the pattern, and
+	// Text is the text between them.
+	Start, End int
+	Text       string
+	// Flags are the flags in effect for the part. For a group, they are the
+	// flags in effect inside the group, and for an ExplainFlags, they are
+	// the flags after it.
+	Flags uint32
+	// Description describes what the part matches in English.
+	Description string
+	// Children are the parts of the part.
+	Children []*ExplainNode
+
+	// Group is the index of a capturing group, or 0 for a group that doesn't
+	// capture, and Name is the name of a named capturing group.
+	Group int
+	Name  string
+	// Min and Max are the bounds of a repetition, where a Max of -1 means
+	// that it is unbounded. Greedy is true if the repetition matches as many
+	// times as possible, which takes the U flag into account.
+	Min, Max int
+	Greedy   bool
+	// Literal is the string matched by a literal.
+	Literal string
+	// Ranges are the ranges of codepoints matched by a class, with case
+	// insensitivity and negation applied. They are nil if the class uses
+	// Unicode tables that Go doesn't have, such as \p{Emoji}.
+	Ranges []RuneRange
+	// Bytes is true if a literal or class matches bytes rather than
+	// codepoints, because Unicode mode is disabled.
+	Bytes bool
+}
+
+// Explanation describes the structure of a pattern, such as for reviewing
+// a pattern written by someone else.
+type Explanation struct {
+	// Pattern and Flags are the pattern and flags that were explained.
+	Pattern string
+	Flags   uint32
+	// Root describes the whole pattern.
+	Root *ExplainNode
+	// CaptureNames are the names of the capturing groups, as returned by
+	// Regex.CaptureNames for the compiled pattern.
+	CaptureNames []string
+}
+
+// Explain describes the structure of a pattern compiled with the given
+// flags: its groups and their names, its repetitions, its classes with the
+// characters they match, and the flags in effect at every part of it.
+//
+// The pattern is compiled first, and Explain returns the same error as
+// CompileOptions if it doesn't compile. Classes are expanded with Go's
+// Unicode tables, which may be from a different version of Unicode than the
+// tables of the regex engine.
+func Explain(pattern string, flags uint32) (*Explanation, error) {
+	re, err := CompileOptions(pattern, flags, nil)
+	if err != nil {
+		return nil, err
+	}
+	root, parsed, err := parse(pattern, flags)
+	if err != nil {
+		return nil, err
+	}
+	// The groups are numbered by the parser, which must find the same groups
+	// as the regex engine for the names to be those the engine reports.
+	names := re.CaptureNames()
+	if len(parsed) != len(names) {
+		return nil, fmt.Errorf("rure: explaining %q found %d capturing "+
+			"groups, but the regex engine found %d", pattern, len(parsed),
+			len(names))
+	}
+	e := &Explanation{Pattern: pattern, Flags: flags, CaptureNames: names}
+	e.Root = e.explain(root, 0)
+	return e, nil
+}
+
+// explain returns the description of n, which is in depth groups.
+func (e *Explanation) explain(n *node, depth int) *ExplainNode {
+	x := &ExplainNode{
+		Start: n.start,
+		End:   n.end,
+		Text:  e.Pattern[n.start:n.end],
+		Flags: n.flags,
+	}
+	switch n.kind {
+	case nodeEmpty:
+		x.Kind = ExplainEmpty
+		x.Description = "the empty string"
+	case nodeLiteral:
+		x.Kind = ExplainLiteral
+		x.Literal, x.Bytes = appendLiteral("", n), n.isByte
+		x.Description = describeLiteral(x.Literal, n.flags)
+	case nodeDot:
+		x.Kind = ExplainClass
+		x.Ranges = dotRanges(n.flags, n.crlf)
+		x.Bytes = n.flags&FlagUnicode == 0
+		x.Description = describeDot(n)
+	case nodeClass:
+		x.Kind = ExplainClass
+		x.Bytes = n.flags&FlagUnicode == 0
+		if ranges, ok := classRanges(n.class, n.flags); ok {
+			x.Ranges = ranges
+			if x.Ranges == nil {
+				x.Ranges = []RuneRange{}
+			}
+		}
+		x.Description = describeClass(x)
+	case nodeAssertion:
+		x.Kind = ExplainAssertion
+		x.Description = describeAssertion(n)
+	case nodeRepetition:
+		x.Kind = ExplainRepetition
+		x.Min, x.Max, x.Greedy = n.min, n.max, n.greedy
+		x.Description = describeRepetition(n)
+	case nodeGroup:
+		x.Kind = ExplainGroup
+		x.Group = n.index
+		if n.index > 0 {
+			x.Name = e.CaptureNames[n.index]
+		}
+		x.Description = describeGroup(n, x.Name)
+		depth++
+	case nodeFlags:
+		x.Kind = ExplainFlags
+		x.Description = "sets flags " + describeFlags(n.setFlags) +
+			" for the rest of the pattern"
+		if depth > 0 {
+			x.Description = "sets flags " + describeFlags(n.setFlags) +
+				" for the rest of the group"
+		}
+	case nodeConcat:
+		x.Kind = ExplainConcat
+	case nodeAlternation:
+		x.Kind = ExplainAlternation
+		x.Description = fmt.Sprintf(
+			"one of %d alternatives, preferring the first that matches",
+			len(n.subs))
+	}
+
+	for i := 0; i < len(n.subs); i++ {
+		sub := n.subs[i]
+		// Consecutive literals with the same flags are explained as a
+		// single literal.
+		if n.kind == nodeConcat && sub.kind == nodeLiteral {
+			lit := *sub
+			text := appendLiteral("", sub)
+			for i+1 < len(n.subs) && n.subs[i+1].kind == nodeLiteral &&
+				n.subs[i+1].flags == sub.flags {
+				i++
+				text = appendLiteral(text, n.subs[i])
+				lit.isByte = lit.isByte || n.subs[i].isByte
+				lit.end = n.subs[i].end
+			}
+			child := e.explain(&lit, depth)
+			child.Literal = text
+			child.Description = describeLiteral(text, lit.flags)
+			x.Children = append(x.Children, child)
+			continue
+		}
+		x.Children = append(x.Children, e.explain(sub, depth))
+	}
+	if x.Kind == ExplainConcat {
+		x.Description = fmt.Sprintf("a sequence of %d parts",
+			len(x.Children))
+		if len(x.Children) == 1 {
+			return x.Children[0]
+		}
+	}
+	return x
+}
+
+// String describes the pattern as an indented tree, with a line for every
+// part of the pattern that has its text, its description and the flags in
+// effect for it.
+func (e *Explanation) String() string {
+	var buf strings.Builder
+	var write func(x *ExplainNode, indent string)
+	write = func(x *ExplainNode, indent string) {
+		text := strings.NewReplacer("\n", `\n`, "\t", `\t`).Replace(x.Text)
+		flags := inlineflags.Format(x.Flags)
+		if flags == "" {
+			flags = "none"
+		}
+		fmt.Fprintf(&buf, "%s`%s` %s (flags: %s)\n",
+			indent, text, x.Description, flags)
+		for _, child := range x.Children {
+			write(child, indent+"  ")
+		}
+	}
+	write(e.Root, "")
+	return buf.String()
+}
+
+// appendLiteral appends the text matched by the literal n to text.
+func appendLiteral(text string, n *node) string {
+	if n.isByte {
+		return text + string([]byte{byte(n.lit)})
+	}
+	return text + string(n.lit)
+}
+
+func describeLiteral(text string, flags uint32) string {
+	if flags&FlagCaseI != 0 {
+		return fmt.Sprintf("the literal %q, ignoring case", text)
+	}
+	return fmt.Sprintf("the literal %q", text)
+}
+
+func describeDot(n *node) string {
+	what := "character"
+	if n.flags&FlagUnicode == 0 {
+		what = "byte"
+	}
+	switch {
+	case n.flags&FlagDotNL != 0:
+		return "any " + what
+	case n.crlf:
+		return "any " + what + ` except \n and \r`
+	default:
+		return "any " + what + ` except \n`
+	}
+}
+
+func describeClass(x *ExplainNode) string {
+	what := "a character"
+	if x.Bytes {
+		what = "a byte"
+	}
+	switch {
+	case x.Ranges == nil:
+		return what + " in " + x.Text +
+			", which can't be expanded with Go's Unicode tables"
+	case len(x.Ranges) == 0:
+		return "nothing, since the class is empty"
+	}
+	parts := make([]string, 0, maxExplainedRanges+1)
+	for i, r := range x.Ranges {
+		if i == maxExplainedRanges {
+			parts = append(parts, fmt.Sprintf("and %d more ranges",
+				len(x.Ranges)-i))
+			break
+		}
+		if r.Lo == r.Hi {
+			parts = append(parts, quoteClassRune(r.Lo, x.Bytes))
+		} else {
+			parts = append(parts, quoteClassRune(r.Lo, x.Bytes)+"-"+
+				quoteClassRune(r.Hi, x.Bytes))
+		}
+	}
+	return what + " in " + strings.Join(parts, ", ")
+}
+
+// quoteClassRune quotes a codepoint, or a byte if isByte is true, in the
+// ranges of the description of a class.
+func quoteClassRune(r rune, isByte bool) string {
+	if isByte && r >= utf8.RuneSelf {
+		return fmt.Sprintf(`'\x%02x'`, r)
+	}
+	return strconv.QuoteRune(r)
+}
+
+func describeAssertion(n *node) string {
+	word := "Unicode word"
+	if n.flags&FlagUnicode == 0 {
+		word = "ASCII word"
+	}
+	line := "a line"
+	if n.crlf {
+		line = `a line, where lines end with \n or \r\n`
+	}
+	switch n.assert {
+	case assertStartText:
+		return "the start of the text"
+	case assertEndText:
+		return "the end of the text"
+	case assertStartLine:
+		return "the start of " + line
+	case assertEndLine:
+		return "the end of " + line
+	case assertWordBoundary:
+		return "a " + word + " boundary"
+	case assertNotWordBoundary:
+		return "anywhere but a " + word + " boundary"
+	case assertWordStart:
+		return "the start of a " + word
+	case assertWordEnd:
+		return "the end of a " + word
+	case assertWordStartHalf:
+		return "a position that doesn't follow a " + word + " character"
+	default:
+		return "a position that isn't followed by a " + word + " character"
+	}
+}
+
+func describeRepetition(n *node) string {
+	var times string
+	switch {
+	case n.min == 0 && n.max == -1:
+		times = "zero or more times"
+	case n.min == 1 && n.max == -1:
+		times = "one or more times"
+	case n.min == 0 && n.max == 1:
+		times = "zero times or once"
+	case n.max == -1:
+		times = fmt.Sprintf("at least %d times", n.min)
+	case n.min == n.max && n.min == 1:
+		return "exactly once"
+	case n.min == n.max:
+		return fmt.Sprintf("exactly %d times", n.min)
+	default:
+		times = fmt.Sprintf("between %d and %d times", n.min, n.max)
+	}
+	if n.greedy {
+		return times + ", as many times as possible"
+	}
+	return times + ", as few times as possible"
+}
+
+func describeGroup(n *node, name string) string {
+	var desc string
+	switch {
+	case n.index > 0 && name != "":
+		desc = fmt.Sprintf("capturing group %d named %q", n.index, name)
+	case n.index > 0:
+		desc = fmt.Sprintf("capturing group %d", n.index)
+	default:
+		desc = "non-capturing group"
+	}
+	if n.setFlags != "" {
+		desc += " that sets flags " + describeFlags(n.setFlags)
+	}
+	return desc
+}
+
+// flagNames are the names of the inline flags.
+var flagNames = map[rune]string{
+	'i': "case insensitive",
+	'm': "multi-line",
+	's': "dot matches new line",
+	'U': "swap greed",
+	'x': "verbose",
+	'u': "Unicode",
+	'R': "CRLF",
+}
+
+// describeFlags describes the text of inline flags like "i-u".
+func describeFlags(text string) string {
+	var parts []string
+	state := "on"
+	for _, c := range text {
+		if c == '-' {
+			state = "off"
+			continue
+		}
+		parts = append(parts, flagNames[c]+" "+state)
+	}
+	return text + " (" + strings.Join(parts, ", ") + ")"
+}
@@ -0,0 +1,197 @@
+package rure
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/rure-go/internal/inlineflags"
+	"github.com/stretchr/testify/require"
+)
+
+// explainClass returns the ranges of the class that is the whole of
+// pattern. It parses the pattern without compiling it, so that it can test
+// classes that the pure Go fallback can't compile.
+func explainClass(t *testing.T, pattern string, flags uint32) []RuneRange {
+	root, _, err := parse(pattern, flags)
+	require.NoError(t, err, pattern)
+	e := &Explanation{Pattern: pattern, Flags: flags}
+	x := e.explain(root, 0)
+	require.Equal(t, ExplainClass, x.Kind, pattern)
+	return x.Ranges
+}
+
+func inRanges(ranges []RuneRange, r rune) bool {
+	for _, rr := range ranges {
+		if rr.Lo <= r && r <= rr.Hi {
+			return true
+		}
+	}
+	return false
+}
+
+func TestExplain(t *testing.T) {
+	e, err := Explain(`(?i)(?P<year>\d{4})-(\w+)?`, FlagDefault)
+	require.NoError(t, err)
+	root := e.Root
+	require.Equal(t, ExplainConcat, root.Kind)
+	require.Equal(t, uint32(FlagUnicode), root.Flags)
+	require.Len(t, root.Children, 4)
+
+	flags := root.Children[0]
+	require.Equal(t, ExplainFlags, flags.Kind)
+	require.Equal(t, "(?i)", flags.Text)
+	require.Equal(t, uint32(FlagCaseI|FlagUnicode), flags.Flags)
+
+	year := root.Children[1]
+	require.Equal(t, ExplainGroup, year.Kind)
+	require.Equal(t, 1, year.Group)
+	require.Equal(t, "year", year.Name)
+	require.Equal(t, uint32(FlagCaseI|FlagUnicode), year.Flags)
+	rep := year.Children[0]
+	require.Equal(t, ExplainRepetition, rep.Kind)
+	require.Equal(t, 4, rep.Min)
+	require.Equal(t, 4, rep.Max)
+	require.Equal(t, `\d`, rep.Children[0].Text)
+	require.Equal(t, RuneRange{'0', '9'}, rep.Children[0].Ranges[0])
+
+	lit := root.Children[2]
+	require.Equal(t, ExplainLiteral, lit.Kind)
+	require.Equal(t, "-", lit.Literal)
+	require.Equal(t, `the literal "-", ignoring case`, lit.Description)
+
+	opt := root.Children[3]
+	require.Equal(t, ExplainRepetition, opt.Kind)
+	require.Equal(t, 0, opt.Min)
+	require.Equal(t, 1, opt.Max)
+	require.True(t, opt.Greedy)
+	require.Equal(t, 2, opt.Children[0].Group)
+
+	require.Equal(t, []string{"", "year", ""}, e.CaptureNames)
+}
+
+func TestExplainCaptureNames(t *testing.T) {
+	for _, pattern := range []string{
+		`a`,
+		`(a)(?P<b>b)(?:c)(?<d>d)`,
+		`((a)|(?P<x>(b)))(?i:(c))`,
+		`(?x) ( a ) # (b)
+		(?P<c> c )`,
+		`[(](a)`,
+		`\((a)`,
+	} {
+		e, err := Explain(pattern, FlagDefault)
+		require.NoError(t, err, pattern)
+		require.Equal(t, MustCompile(pattern).CaptureNames(), e.CaptureNames,
+			pattern)
+	}
+}
+
+func TestExplainFlags(t *testing.T) {
+	e, err := Explain(`a(?i:b(?-i)c)d`, FlagDefault)
+	require.NoError(t, err)
+	var flags []uint32
+	var walk func(x *ExplainNode)
+	walk = func(x *ExplainNode) {
+		if x.Kind == ExplainLiteral {
+			flags = append(flags, x.Flags)
+		}
+		for _, child := range x.Children {
+			walk(child)
+		}
+	}
+	walk(e.Root)
+	require.Equal(t, []uint32{
+		FlagUnicode,
+		FlagCaseI | FlagUnicode,
+		FlagUnicode,
+		FlagUnicode,
+	}, flags)
+
+	e, err = Explain(`(?U)a+b+?`, FlagDefault)
+	require.NoError(t, err)
+	require.False(t, e.Root.Children[1].Greedy)
+	require.True(t, e.Root.Children[2].Greedy)
+
+	e, err = Explain(`a b # comment`, FlagDefault|FlagSpace)
+	require.NoError(t, err)
+	require.Equal(t, "ab", e.Root.Literal)
+
+	// The flags are written with the letters of inlineflags.
+	for i, flag := range []uint32{
+		FlagCaseI, FlagMulti, FlagDotNL, FlagSwapGreed, FlagSpace, FlagUnicode,
+	} {
+		require.Equal(t, inlineflags.Letters[i:i+1], inlineflags.Format(flag))
+	}
+}
+
+func TestExplainClasses(t *testing.T) {
+	require.Equal(t, []RuneRange{{'a', 'c'}, {'x', 'x'}},
+		explainClass(t, `[a-cx]`, FlagDefault))
+	require.Equal(t, []RuneRange{{'A', 'C'}, {'a', 'c'}},
+		explainClass(t, `[a-c]`, FlagDefault|FlagCaseI))
+	require.Equal(t, []RuneRange{{'b', 'd'}, {'f', 'h'}, {'j', 'n'}},
+		explainClass(t, `[b-n--aeiou]`, FlagDefault))
+	require.Equal(t, []RuneRange{{'c', 'd'}},
+		explainClass(t, `[a-d&&[c-z]]`, FlagDefault))
+	require.Equal(t, []RuneRange{{'a', 'b'}, {'e', 'f'}},
+		explainClass(t, `[a-d~~c-f]`, FlagDefault))
+	require.Equal(t, []RuneRange{{']', ']'}},
+		explainClass(t, `[]]`, FlagDefault))
+	require.Equal(t, []RuneRange{{'-', '-'}, {'a', 'a'}},
+		explainClass(t, `[a-]`, FlagDefault))
+	require.Equal(t, []RuneRange{{0, '`'}, {'{', 0xFF}},
+		explainClass(t, `[^[:lower:]]`, 0))
+	require.Equal(t, []RuneRange{{0, 9}, {11, 0xFF}},
+		explainClass(t, `.`, 0))
+	require.Equal(t,
+		[]RuneRange{{0, 9}, {11, 0xD7FF}, {0xE000, 0x10FFFF}},
+		explainClass(t, `.`, FlagDefault))
+
+	// Uppercase Greek letters.
+	greek := explainClass(t, `[\p{Greek}&&\p{Lu}]`, FlagDefault)
+	require.True(t, inRanges(greek, 'Ω'))
+	require.False(t, inRanges(greek, 'ω'))
+	require.False(t, inRanges(greek, 'A'))
+	require.Equal(t, greek,
+		explainClass(t, `[\p{sc=greek}&&\p{gc=Uppercase_Letter}]`,
+			FlagDefault))
+
+	// Properties that Go has no tables for aren't expanded.
+	require.Nil(t, explainClass(t, `\p{Emoji}`, FlagDefault))
+	require.Nil(t, explainClass(t, `[a\p{Emoji}]`, FlagDefault))
+}
+
+func TestExplainString(t *testing.T) {
+	e, err := Explain(`(?m)^a|[b-d]*`, FlagDefault)
+	require.NoError(t, err)
+	require.Equal(t, strings.Join([]string{
+		"`(?m)^a|[b-d]*` one of 2 alternatives, preferring the first " +
+			"that matches (flags: u)",
+		"  `(?m)^a` a sequence of 3 parts (flags: u)",
+		"    `(?m)` sets flags m (multi-line on) for the rest of the " +
+			"pattern (flags: mu)",
+		"    `^` the start of a line (flags: mu)",
+		"    `a` the literal \"a\" (flags: mu)",
+		"  `[b-d]*` zero or more times, as many times as possible " +
+			"(flags: mu)",
+		"    `[b-d]` a character in 'b'-'d' (flags: mu)",
+		"",
+	}, "\n"), e.String())
+}
+
+func TestExplainJSON(t *testing.T) {
+	e, err := Explain(`a+`, FlagDefault)
+	require.NoError(t, err)
+	data, err := json.Marshal(e.Root)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"Kind":"repetition"`)
+	require.Contains(t, string(data), `"Kind":"literal"`)
+}
+
+func TestExplainError(t *testing.T) {
+	_, err := Explain(`(a`, FlagDefault)
+	require.Error(t, err)
+	_, ok := err.(*Error)
+	require.True(t, ok)
+}
@@ -0,0 +1,123 @@
+/*
+Package expvarobserver is an implementation of rure.Observer that publishes
+statistics about compiles and searches as expvar variables.
+
+It is kept apart from the rure package since importing expvar registers a
+handler for /debug/vars on http.DefaultServeMux.
+
+The published variable is a map like the following, with an entry in patterns
+for every pattern that has been searched with:
+
+	{
+	  "compiles": 3,
+	  "compile_errors": 1,
+	  "compile_nanoseconds": 51200,
+	  "patterns": {
+	    "\\w+": {
+	      "searches": 10,
+	      "matches": 7,
+	      "bytes": 4096,
+	      "nanoseconds": 88000
+	    }
+	  }
+	}
+
+Searches with a rure.RegexSet are recorded under its patterns, written as a
+list of quoted strings like ["a" "b"].
+
+Since there is an entry per pattern, it should not be used with patterns that
+are built from untrusted input, which could grow the map without bound.
+*/
+package expvarobserver
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+
+	rure "github.com/BurntSushi/rure-go"
+)
+
+// Observer is a rure.Observer that records compiles and searches in an
+// expvar.Map.
+//
+// It can be used safely from multiple goroutines simultaneously.
+type Observer struct {
+	vars     *expvar.Map
+	patterns *expvar.Map
+	// mu serializes adding new patterns to patterns.
+	mu sync.Mutex
+}
+
+var _ rure.Observer = (*Observer)(nil)
+
+// New returns an Observer whose statistics are published with expvar under
+// the given name. Like expvar.Publish, it panics if the name is already in
+// use.
+//
+// To use it, give it to rure.SetObserver or Regex.SetObserver.
+func New(name string) *Observer {
+	o := Unpublished()
+	expvar.Publish(name, o)
+	return o
+}
+
+// Unpublished returns an Observer whose statistics are not published with
+// expvar, which is useful when they are part of another variable.
+func Unpublished() *Observer {
+	o := &Observer{vars: new(expvar.Map).Init()}
+	o.patterns = new(expvar.Map).Init()
+	o.vars.Set("patterns", o.patterns)
+	return o
+}
+
+// Map returns the map that the statistics are recorded in.
+func (o *Observer) Map() *expvar.Map {
+	return o.vars
+}
+
+// String returns the statistics as JSON, which makes an Observer an
+// expvar.Var.
+func (o *Observer) String() string {
+	return o.vars.String()
+}
+
+// OnCompile records a compile.
+func (o *Observer) OnCompile(event rure.CompileEvent) {
+	o.vars.Add("compiles", 1)
+	if event.Err != nil {
+		o.vars.Add("compile_errors", 1)
+	}
+	o.vars.Add("compile_nanoseconds", int64(event.Duration))
+}
+
+// OnSearch records a search.
+func (o *Observer) OnSearch(event rure.SearchEvent) {
+	pattern := event.Pattern
+	if event.Patterns != nil {
+		pattern = fmt.Sprintf("%q", event.Patterns)
+	}
+	stats := o.pattern(pattern)
+	stats.Add("searches", 1)
+	if event.Matched {
+		stats.Add("matches", 1)
+	}
+	stats.Add("bytes", int64(event.HaystackLen))
+	stats.Add("nanoseconds", int64(event.Duration))
+}
+
+// pattern returns the statistics for pattern, adding them if this is the
+// first search with it.
+func (o *Observer) pattern(pattern string) *expvar.Map {
+	if stats, ok := o.patterns.Get(pattern).(*expvar.Map); ok {
+		return stats
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if stats, ok := o.patterns.Get(pattern).(*expvar.Map); ok {
+		return stats
+	}
+	stats := new(expvar.Map).Init()
+	o.patterns.Set(pattern, stats)
+	return stats
+}
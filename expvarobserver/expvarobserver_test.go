@@ -0,0 +1,65 @@
+package expvarobserver
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	rure "github.com/BurntSushi/rure-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObserver(t *testing.T) {
+	o := New("rure_test")
+	require.Equal(t, o, expvar.Get("rure_test"))
+
+	rure.SetObserver(o)
+	re, err := rure.Compile(`\d+`)
+	_, badErr := rure.Compile(`(`)
+	rure.SetObserver(nil)
+	require.NoError(t, err)
+	require.Error(t, badErr)
+	// Compiles after the observer is removed are not recorded.
+	rure.MustCompile(`x`)
+
+	re.SetObserver(o)
+	require.True(t, re.IsMatch("a1"))
+	require.False(t, re.IsMatch("ab"))
+	require.Equal(t, 2, re.Count("1 2"))
+
+	var stats struct {
+		Compiles      int `json:"compiles"`
+		CompileErrors int `json:"compile_errors"`
+		Patterns      map[string]struct {
+			Searches int `json:"searches"`
+			Matches  int `json:"matches"`
+			Bytes    int `json:"bytes"`
+		} `json:"patterns"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(o.String()), &stats))
+	require.Equal(t, 2, stats.Compiles)
+	require.Equal(t, 1, stats.CompileErrors)
+	require.Len(t, stats.Patterns, 1)
+	require.Equal(t, 3, stats.Patterns[`\d+`].Searches)
+	require.Equal(t, 2, stats.Patterns[`\d+`].Matches)
+	require.Equal(t, 7, stats.Patterns[`\d+`].Bytes)
+
+	require.Panics(t, func() { New("rure_test") })
+	require.NotNil(t, Unpublished().Map())
+}
+
+func TestObserverSet(t *testing.T) {
+	o := Unpublished()
+	rure.SetObserver(o)
+	defer rure.SetObserver(nil)
+	set := rure.MustCompileSet([]string{`a`, `b`})
+	require.True(t, set.IsMatch("a"))
+
+	var stats struct {
+		Patterns map[string]struct {
+			Searches int `json:"searches"`
+		} `json:"patterns"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(o.String()), &stats))
+	require.Equal(t, 1, stats.Patterns[`["a" "b"]`].Searches)
+}
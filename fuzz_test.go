@@ -0,0 +1,349 @@
+//go:build cgo && !purego && go1.18
+// +build cgo,!purego,go1.18
+
+package rure
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/rure-go/internal/inlineflags"
+)
+
+// maxFuzzPattern and maxFuzzRepeat bound the patterns that FuzzDifferential
+// compiles. Nested counted repetitions grow the compiled program
+// multiplicatively, and large ones can take far longer to compile than the
+// search they guard, which stalls the fuzzer.
+const (
+	maxFuzzPattern = 64
+	maxFuzzRepeat  = 100
+)
+
+// FuzzDifferential compares the results of this package with Go's regexp
+// package. Only short patterns in the syntax that both packages agree on are
+// compared; anything else is skipped. Seeds live in
+// testdata/fuzz/FuzzDifferential.
+//
+// Run it with:
+//
+//	go test -run '^$' -fuzz FuzzDifferential
+//
+// It reports 0 execs/sec while it minimizes a new interesting input, which
+// takes up to a minute; pass -fuzzminimizetime to shorten that.
+func FuzzDifferential(f *testing.F) {
+	f.Add(`a+`, []byte("baaab"), 0, uint32(0))
+	f.Add(`a*`, []byte(""), 0, uint32(0))
+	f.Add(`(a|ab)(c|bcd)(d*)`, []byte("abcd"), 1, uint32(0))
+	f.Add(`^(foo)?$`, []byte("x\nfoo\n"), 2, uint32(FlagMulti))
+	f.Add(`[a-z]+(?:\.[a-z]+)*`, []byte("a.b ☃ c.d"), 3, uint32(FlagCaseI))
+	f.Add(`x*`, []byte("\xff\xe2\x98"), 1, uint32(0))
+	f.Add(`(?U)a+?b{1,3}`, []byte("aabbbb"), 0, uint32(FlagSwapGreed))
+	f.Add(`\x{2603}|\z`, []byte("☃\x00"), 5, uint32(FlagDotNL))
+	f.Fuzz(func(
+		t *testing.T,
+		pattern string,
+		haystack []byte,
+		at int,
+		flags uint32,
+	) {
+		flags &= FlagCaseI | FlagMulti | FlagDotNL | FlagSwapGreed
+		if len(pattern) > maxFuzzPattern {
+			t.Skip()
+		}
+		goPattern, ast, ok := sharedSyntax(pattern, flags)
+		if !ok || repeatCount(ast) > maxFuzzRepeat {
+			t.Skip()
+		}
+		goRe, err := regexp.Compile(goPattern)
+		if err != nil {
+			t.Skip()
+		}
+		re, err := CompileOptions(pattern, flags|FlagUnicode, nil)
+		if err != nil {
+			t.Skip()
+		}
+		startContext := usesStartContext(ast)
+		if at < 0 {
+			at = -at
+		}
+
+		check := func(haystack []byte) {
+			diff := differential{t, pattern, flags, haystack}
+			diff.find(re, goRe)
+			diff.findAll(re, goRe)
+			diff.iter(re, goRe)
+			diff.captures(re, goRe)
+			if i := at % (len(haystack) + 1); i == 0 || !startContext {
+				diff.isMatchAt(re, goRe, i)
+			}
+		}
+		check(haystack)
+		if len(haystack) == 0 {
+			check(nil)
+		}
+		if len(haystack) >= 2 {
+			// Check a sub-slice that shares its backing array, so that
+			// both its start and its length differ from the original.
+			check(haystack[1 : len(haystack)-1])
+		}
+	})
+}
+
+// differential reports any divergence on haystack between a Regex and the
+// equivalent regexp.Regexp.
+type differential struct {
+	t        *testing.T
+	pattern  string
+	flags    uint32
+	haystack []byte
+}
+
+func (d differential) check(method string, got, want interface{}) {
+	if !reflect.DeepEqual(got, want) {
+		d.t.Errorf("%s(%q) with flags %#x on %q: rure gave %v, regexp gave %v",
+			method, d.pattern, d.flags, d.haystack, got, want)
+	}
+}
+
+func (d differential) find(re *Regex, goRe *regexp.Regexp) {
+	var got []int
+	if start, end, ok := re.FindBytes(d.haystack); ok {
+		got = []int{start, end}
+	}
+	d.check("FindBytes", got, goRe.FindIndex(d.haystack))
+
+	got = nil
+	if start, end, ok := re.Find(string(d.haystack)); ok {
+		got = []int{start, end}
+	}
+	d.check("Find", got, goRe.FindIndex(d.haystack))
+}
+
+func (d differential) findAll(re *Regex, goRe *regexp.Regexp) {
+	var want []int
+	for _, m := range goRe.FindAllIndex(d.haystack, -1) {
+		want = append(want, m...)
+	}
+	got := runeBoundaryMatches(d.haystack, re.FindAllBytes(d.haystack))
+	d.check("FindAllBytes", got, want)
+	got = runeBoundaryMatches(d.haystack, re.FindAll(string(d.haystack)))
+	d.check("FindAll", got, want)
+}
+
+func (d differential) iter(re *Regex, goRe *regexp.Regexp) {
+	var want []int
+	for _, m := range goRe.FindAllIndex(d.haystack, -1) {
+		want = append(want, m...)
+	}
+	var got []int
+	it := re.IterBytes(d.haystack)
+	for it.Next(nil) {
+		start, end := it.Match()
+		got = append(got, start, end)
+	}
+	d.check("IterBytes", runeBoundaryMatches(d.haystack, got), want)
+
+	got = nil
+	caps := re.NewCaptures()
+	it = re.Iter(string(d.haystack))
+	for it.Next(caps) {
+		start, end, _ := caps.Group(0)
+		got = append(got, start, end)
+	}
+	d.check("Iter", runeBoundaryMatches(d.haystack, got), want)
+}
+
+func (d differential) captures(re *Regex, goRe *regexp.Regexp) {
+	caps := re.NewCaptures()
+	var got []int
+	if re.CapturesBytes(caps, d.haystack) {
+		for i := 0; i < caps.Len(); i++ {
+			start, end, ok := caps.Group(i)
+			if !ok {
+				start, end = -1, -1
+			}
+			got = append(got, start, end)
+		}
+	}
+	d.check("CapturesBytes", got, goRe.FindSubmatchIndex(d.haystack))
+}
+
+func (d differential) isMatchAt(re *Regex, goRe *regexp.Regexp, at int) {
+	want := goRe.Match(d.haystack[at:])
+	d.check(fmt.Sprintf("IsMatchBytesAt(%d)", at),
+		re.IsMatchBytesAt(d.haystack, at), want)
+	d.check(fmt.Sprintf("IsMatchAt(%d)", at),
+		re.IsMatchAt(string(d.haystack), at), want)
+}
+
+// runeBoundaryMatches removes the empty matches that split a codepoint from
+// matches. librure steps over a byte after an empty match, while Go's regexp
+// steps over a whole (possibly invalid) codepoint, so only the former reports
+// them.
+func runeBoundaryMatches(haystack []byte, matches []int) []int {
+	var kept []int
+	// Go's regexp considers each byte of invalid UTF-8 its own codepoint.
+	// Matches are in order, so the haystack is decoded only once.
+	boundary := 0
+	for i := 0; i < len(matches); i += 2 {
+		start, end := matches[i], matches[i+1]
+		for boundary < start {
+			_, size := utf8.DecodeRune(haystack[boundary:])
+			boundary += size
+		}
+		if start == end && boundary != start {
+			continue
+		}
+		kept = append(kept, start, end)
+	}
+	return kept
+}
+
+// sharedSyntax returns the pattern to give to Go's regexp package, its
+// parsed form, and whether pattern is in the syntax that means the same
+// thing to both packages when searching any haystack, including invalid
+// UTF-8.
+func sharedSyntax(
+	pattern string,
+	flags uint32,
+) (string, *syntax.Regexp, bool) {
+	// Perl classes and word boundaries are ASCII-only in Go but Unicode-aware
+	// by default in Rust. Rust also has \< and \> word boundaries, nested
+	// classes and set operations in classes, all of which Go reads as
+	// literals.
+	inClass := false
+	for i := 0; i < len(pattern); i++ {
+		switch rest := pattern[i:]; {
+		case rest[0] == '\\' && len(rest) > 1:
+			if strings.IndexByte("dDsSwWbB<>", rest[1]) >= 0 {
+				return "", nil, false
+			}
+			i++
+		case !inClass && rest[0] == '[':
+			inClass = true
+			// Skip a leading ^ and ], which is a literal at the start of a
+			// class. Only Go lets that ] start a range.
+			if strings.HasPrefix(rest[1:], "^") {
+				i++
+			}
+			if strings.HasPrefix(pattern[i+1:], "]-") {
+				return "", nil, false
+			} else if strings.HasPrefix(pattern[i+1:], "]") {
+				i++
+			}
+		case inClass && rest[0] == ']':
+			inClass = false
+		case inClass && strings.HasPrefix(rest, "[:"):
+			end := strings.Index(rest, ":]")
+			if end < 0 {
+				return "", nil, false
+			}
+			i += end + 1
+		case inClass && (rest[0] == '[' || strings.HasPrefix(rest, "&&") ||
+			strings.HasPrefix(rest, "--") || strings.HasPrefix(rest, "~~")):
+			return "", nil, false
+		}
+	}
+	goPattern := pattern
+	on := inlineflags.Format(flags & (FlagCaseI | FlagMulti | FlagDotNL |
+		FlagSwapGreed))
+	if on != "" {
+		goPattern = "(?" + on + ")" + pattern
+	}
+	ast, err := syntax.Parse(goPattern, syntax.Perl)
+	if err != nil {
+		return "", nil, false
+	}
+	return goPattern, ast, sharedAST(ast)
+}
+
+// sharedAST reports whether re only uses constructs that match the same way
+// in both packages. Go's regexp decodes each byte of invalid UTF-8 as U+FFFD,
+// which librure never matches, so nothing that can match U+FFFD is allowed.
+func sharedAST(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL,
+		syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return false
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			// Go reads a brace that doesn't start a valid repetition, like
+			// the one in a{01}, as a literal.
+			if r == utf8.RuneError || r == '{' || r == '}' {
+				return false
+			}
+		}
+	case syntax.OpRepeat:
+		// librure drops the groups in a repetition of at most zero, like
+		// the one in (a){0}, so it reports fewer of them.
+		if re.Max == 0 && hasCapture(re.Sub[0]) {
+			return false
+		}
+	case syntax.OpCharClass:
+		for i := 0; i < len(re.Rune); i += 2 {
+			if re.Rune[i] <= utf8.RuneError && utf8.RuneError <= re.Rune[i+1] {
+				return false
+			}
+		}
+	}
+	for _, sub := range re.Sub {
+		if !sharedAST(sub) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasCapture reports whether re contains a capturing group.
+func hasCapture(re *syntax.Regexp) bool {
+	if re.Op == syntax.OpCapture {
+		return true
+	}
+	for _, sub := range re.Sub {
+		if hasCapture(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// repeatCount returns how many times the most repeated part of re is copied
+// when it is compiled, which is the product of the counts of the repetitions
+// nested around it.
+func repeatCount(re *syntax.Regexp) int {
+	most := 1
+	for _, sub := range re.Sub {
+		if n := repeatCount(sub); n > most {
+			most = n
+		}
+	}
+	if re.Op == syntax.OpRepeat {
+		count := re.Max
+		if count < re.Min {
+			count = re.Min
+		}
+		if count > 1 {
+			most *= count
+		}
+	}
+	return most
+}
+
+// usesStartContext reports whether re contains a start anchor, whose result
+// depends on the text before the start of a search.
+func usesStartContext(re *syntax.Regexp) bool {
+	if re.Op == syntax.OpBeginLine || re.Op == syntax.OpBeginText {
+		return true
+	}
+	for _, sub := range re.Sub {
+		if usesStartContext(sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,262 @@
+/*
+Package highlight renders text with the matches of a regex highlighted, either
+with ANSI escape sequences for terminals or with HTML <mark> elements.
+
+Both the whole of each match and the individual capturing groups within it can
+be given a style. Styles are keyed by the names of groups, as reported by
+rure.Regex.CaptureNames, or by the decimal index of a group, so that "0" is
+the style of the whole match and "1" is the style of the first group.
+
+Spans are widened as needed so that they never split a UTF-8 encoded
+codepoint, which can happen when Unicode mode is disabled. When that makes the
+spans of groups overlap without nesting, the output is still well formed: HTML
+elements are closed and reopened as needed so that they nest, and ANSI styles
+are reset and set again at every boundary.
+*/
+package highlight
+
+import (
+	"fmt"
+	"html"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	rure "github.com/BurntSushi/rure-go"
+)
+
+// DefaultANSI is the style of whole matches when NewANSI is given no styles,
+// which is reverse video.
+const DefaultANSI = "7"
+
+// Highlighter renders text with the matches of a regex highlighted.
+//
+// It can be used safely from multiple goroutines simultaneously.
+type Highlighter struct {
+	re   *rure.Regex
+	html bool
+	// styles is the style of each group in re, where an empty style means
+	// the group is not highlighted.
+	styles []string
+}
+
+// NewANSI returns a Highlighter that renders text for a terminal. Each style
+// is the parameters of an ANSI SGR escape sequence, such as "1;31" for bold
+// red, and is set for the span of its group. If styles is nil, then whole
+// matches are highlighted with DefaultANSI.
+//
+// An error is returned if a key in styles is not the name or index of a
+// group in re.
+func NewANSI(re *rure.Regex, styles map[string]string) (*Highlighter, error) {
+	if styles == nil {
+		styles = map[string]string{"0": DefaultANSI}
+	}
+	return newHighlighter(re, false, styles)
+}
+
+// NewHTML returns a Highlighter that renders text as HTML. The span of each
+// group in classes is wrapped in a <mark> element whose class attribute is
+// the group's class, or in a <mark> element without a class attribute if the
+// class is empty. If classes is nil, then whole matches are wrapped in <mark>
+// elements without classes. All of the text is HTML escaped.
+//
+// An error is returned if a key in classes is not the name or index of a
+// group in re.
+func NewHTML(re *rure.Regex, classes map[string]string) (*Highlighter, error) {
+	if classes == nil {
+		classes = map[string]string{"0": ""}
+	}
+	return newHighlighter(re, true, classes)
+}
+
+func newHighlighter(
+	re *rure.Regex,
+	isHTML bool,
+	styles map[string]string,
+) (*Highlighter, error) {
+	names := re.CaptureNames()
+	h := &Highlighter{re: re, html: isHTML, styles: make([]string, len(names))}
+	// highlighted records which groups have a style, since an HTML class may
+	// be empty.
+	highlighted := make([]bool, len(names))
+	for key, style := range styles {
+		group := -1
+		for i, name := range names {
+			if name != "" && name == key || strconv.Itoa(i) == key {
+				group = i
+				break
+			}
+		}
+		if group < 0 {
+			return nil, fmt.Errorf("highlight: no group %q in %s", key, re)
+		}
+		h.styles[group], highlighted[group] = style, true
+	}
+	if isHTML {
+		for i, style := range h.styles {
+			if !highlighted[i] {
+				continue
+			}
+			if style == "" {
+				h.styles[i] = "<mark>"
+			} else {
+				h.styles[i] = `<mark class="` + html.EscapeString(style) + `">`
+			}
+		}
+	}
+	return h, nil
+}
+
+// Highlight returns text with every match of the regex highlighted.
+func (h *Highlighter) Highlight(text string) string {
+	return string(h.HighlightBytes([]byte(text)))
+}
+
+// HighlightBytes is like Highlight, but for a []byte.
+func (h *Highlighter) HighlightBytes(text []byte) []byte {
+	var spans []span
+	caps := h.re.NewCaptures()
+	it := h.re.IterBytes(text)
+	for it.Next(caps) {
+		for i, style := range h.styles {
+			if style == "" {
+				continue
+			}
+			start, end, ok := caps.Group(i)
+			if !ok {
+				continue
+			}
+			start, end = runeFloor(text, start), runeCeil(text, end)
+			if start < end {
+				spans = append(spans, span{start, end, i})
+			}
+		}
+	}
+	sort.SliceStable(spans, func(i, j int) bool {
+		if spans[i].start != spans[j].start {
+			return spans[i].start < spans[j].start
+		}
+		// Outer spans are opened first.
+		if spans[i].end != spans[j].end {
+			return spans[i].end > spans[j].end
+		}
+		return spans[i].group < spans[j].group
+	})
+	return h.render(make([]byte, 0, len(text)), text, spans)
+}
+
+// span is the location of a group that is highlighted.
+type span struct {
+	start, end, group int
+}
+
+// render appends text to dst with the given spans highlighted, which must be
+// sorted in the order they are opened.
+func (h *Highlighter) render(dst, text []byte, spans []span) []byte {
+	var stack []span
+	// styled is true if an ANSI style is set.
+	styled := false
+	pos, next := 0, 0
+	for pos < len(text) {
+		// Find the next boundary, where a span on the stack ends or the next
+		// span starts.
+		boundary := len(text)
+		for _, s := range stack {
+			if s.end < boundary {
+				boundary = s.end
+			}
+		}
+		if next < len(spans) && spans[next].start < boundary {
+			boundary = spans[next].start
+		}
+		dst = h.text(dst, text[pos:boundary])
+		pos = boundary
+		changed := false
+
+		// Close every span that ends here, along with the spans opened after
+		// it, and then reopen the ones that haven't ended.
+		closed := len(stack)
+		for i, s := range stack {
+			if s.end == pos {
+				closed = i
+				break
+			}
+		}
+		reopen := append([]span(nil), stack[closed:]...)
+		for i := len(stack) - 1; i >= closed; i-- {
+			if h.html {
+				dst = append(dst, "</mark>"...)
+			}
+			changed = true
+		}
+		stack = stack[:closed]
+		for _, s := range reopen {
+			if s.end != pos {
+				dst = h.open(dst, s)
+				stack = append(stack, s)
+			}
+		}
+		for next < len(spans) && spans[next].start == pos {
+			dst = h.open(dst, spans[next])
+			stack = append(stack, spans[next])
+			next++
+			changed = true
+		}
+
+		// ANSI styles don't nest, so the styles of every open span are set
+		// again whenever one changes.
+		if !h.html && changed {
+			if styled {
+				dst = append(dst, "\x1b[0m"...)
+			}
+			for _, s := range stack {
+				dst = append(dst, "\x1b["...)
+				dst = append(dst, h.styles[s.group]...)
+				dst = append(dst, 'm')
+			}
+			styled = len(stack) > 0
+		}
+	}
+	return dst
+}
+
+// open appends the start of the highlighting of s to dst. ANSI styles are
+// set by render instead.
+func (h *Highlighter) open(dst []byte, s span) []byte {
+	if !h.html {
+		return dst
+	}
+	return append(dst, h.styles[s.group]...)
+}
+
+// text appends text to dst, escaping it for HTML.
+func (h *Highlighter) text(dst, text []byte) []byte {
+	if !h.html {
+		return append(dst, text...)
+	}
+	return append(dst, html.EscapeString(string(text))...)
+}
+
+// runeFloor returns the start of the codepoint in text that contains i.
+func runeFloor(text []byte, i int) int {
+	for j := i - 1; j >= 0 && j > i-utf8.UTFMax; j-- {
+		if utf8.RuneStart(text[j]) {
+			if _, size := utf8.DecodeRune(text[j:]); j+size > i {
+				return j
+			}
+			return i
+		}
+	}
+	return i
+}
+
+// runeCeil returns the end of the codepoint in text that contains i, or i if
+// i doesn't split a codepoint.
+func runeCeil(text []byte, i int) int {
+	j := runeFloor(text, i)
+	if j == i {
+		return i
+	}
+	_, size := utf8.DecodeRune(text[j:])
+	return j + size
+}
@@ -0,0 +1,88 @@
+package highlight
+
+import (
+	"testing"
+
+	rure "github.com/BurntSushi/rure-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTML(t *testing.T) {
+	re := rure.MustCompile(`(?P<key>\w+)=(?P<value>[^ ]+)`)
+	h, err := NewHTML(re, nil)
+	require.NoError(t, err)
+	require.Equal(t,
+		`<mark>a=&lt;b&gt;</mark> &amp; <mark>c=&#34;d&#34;</mark>`,
+		h.Highlight(`a=<b> & c="d"`))
+
+	h, err = NewHTML(re, map[string]string{
+		"0": "m", "key": "k", "2": `"v"`,
+	})
+	require.NoError(t, err)
+	require.Equal(t,
+		`x <mark class="m"><mark class="k">a</mark>=`+
+			`<mark class="&#34;v&#34;">1</mark></mark>`,
+		h.Highlight("x a=1"))
+	require.Equal(t, []byte("none"), h.HighlightBytes([]byte("none")))
+}
+
+func TestANSI(t *testing.T) {
+	re := rure.MustCompile(`(?P<key>\w+)=(?P<value>\w+)`)
+	h, err := NewANSI(re, nil)
+	require.NoError(t, err)
+	require.Equal(t, "x \x1b[7ma=1\x1b[0m y", h.Highlight("x a=1 y"))
+
+	h, err = NewANSI(re, map[string]string{"0": "4", "value": "31"})
+	require.NoError(t, err)
+	require.Equal(t, "\x1b[4ma=\x1b[0m\x1b[4m\x1b[31m1\x1b[0m",
+		h.Highlight("a=1"))
+}
+
+func TestOverlapping(t *testing.T) {
+	// Spans of groups nest within a match, but they can overlap once they are
+	// widened to whole codepoints, so the rendering is tested directly.
+	re := rure.MustCompile(`(a)(b)`)
+	spans := []span{{0, 3, 1}, {1, 4, 2}}
+	h, err := NewHTML(re, map[string]string{"1": "one", "2": "two"})
+	require.NoError(t, err)
+	require.Equal(t,
+		`<mark class="one">a<mark class="two">bc</mark></mark>`+
+			`<mark class="two">d</mark>e`,
+		string(h.render(nil, []byte("abcde"), spans)))
+
+	h, err = NewANSI(re, map[string]string{"1": "1", "2": "2"})
+	require.NoError(t, err)
+	require.Equal(t,
+		"\x1b[1ma\x1b[0m\x1b[1m\x1b[2mbc\x1b[0m\x1b[2md\x1b[0me",
+		string(h.render(nil, []byte("abcde"), spans)))
+}
+
+func TestRuneBoundaries(t *testing.T) {
+	text := []byte("a\u2603b\xffc")
+	require.Equal(t, 0, runeFloor(text, 0))
+	require.Equal(t, 1, runeFloor(text, 1))
+	require.Equal(t, 1, runeFloor(text, 2))
+	require.Equal(t, 1, runeFloor(text, 3))
+	require.Equal(t, 4, runeFloor(text, 4))
+	require.Equal(t, 6, runeFloor(text, 6))
+	require.Equal(t, 4, runeCeil(text, 2))
+	require.Equal(t, 5, runeCeil(text, 5))
+
+	re, err := rure.CompileOptions(`(?-u:\xE2)`, 0, nil)
+	if err != nil {
+		t.Skip("byte matching is not supported:", err)
+	}
+	h, err := NewHTML(re, nil)
+	require.NoError(t, err)
+	require.Equal(t, "a<mark>\u2603</mark>b", h.Highlight("a\u2603b"))
+}
+
+func TestUnknownGroup(t *testing.T) {
+	re := rure.MustCompile(`(?P<a>x)`)
+	_, err := NewHTML(re, map[string]string{"b": ""})
+	require.Error(t, err)
+	_, err = NewANSI(re, map[string]string{"2": ""})
+	require.Error(t, err)
+	_, err = NewANSI(re, map[string]string{"a": "1", "1": "2", "0": "3"})
+	require.NoError(t, err)
+}
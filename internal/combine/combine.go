@@ -0,0 +1,51 @@
+// Package combine has the helpers that the packages of this module use to
+// combine patterns given by users into larger patterns.
+package combine
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrMatchesEmpty is the error for a pattern that matches the empty string,
+// which can't be an alternative of a combined pattern since it would match
+// at every position.
+var ErrMatchesEmpty = errors.New("pattern matches the empty string")
+
+// Wrap returns pattern between prefix and suffix, along with the error that
+// compile returns for it.
+//
+// When the ignore whitespace flag is enabled at the end of pattern, pattern
+// may end with a comment that would swallow suffix. In that case, and only in
+// that case, the wrapped pattern fails to compile, and a new line must be
+// inserted to end the comment. It can't be inserted otherwise, since outside
+// of a comment it is a literal new line.
+func Wrap(
+	pattern, prefix, suffix string,
+	compile func(pattern string) error,
+) (string, error) {
+	wrapped := prefix + pattern + suffix
+	err := compile(wrapped)
+	if err != nil {
+		wrapped = prefix + pattern + "\n" + suffix
+		err = compile(wrapped)
+	}
+	return wrapped, err
+}
+
+// WithoutNames returns pattern with the named capturing groups that start at
+// the given offsets replaced by unnamed ones, which keep the same indexes.
+// The offsets must be in increasing order.
+func WithoutNames(pattern string, starts []int) string {
+	var b strings.Builder
+	pos := 0
+	for _, start := range starts {
+		// Names can't contain >, so the name ends at the first one.
+		end := start + strings.IndexByte(pattern[start:], '>') + 1
+		b.WriteString(pattern[pos:start])
+		b.WriteString("(")
+		pos = end
+	}
+	b.WriteString(pattern[pos:])
+	return b.String()
+}
@@ -0,0 +1,47 @@
+// Package inlineflags converts between the flags of package rure and the
+// letters of its inline flags, such as "iu" for FlagCaseI|FlagUnicode, for
+// the packages of this module.
+package inlineflags
+
+import "fmt"
+
+// Letters are the letters of the inline flags, in the order they are
+// written, where the letter at index i is that of the flag 1<<i. For
+// example, 'i' is the letter of rure.FlagCaseI, which is 1<<0.
+const Letters = "imsUxu"
+
+// Flag returns the flag of an inline flag letter.
+func Flag(c rune) (uint32, bool) {
+	for i, letter := range Letters {
+		if letter == c {
+			return 1 << uint(i), true
+		}
+	}
+	return 0, false
+}
+
+// Parse returns the flags written as a string of inline flag letters. Every
+// flag that is set must be given, so "" has no flags set, which disables
+// Unicode mode.
+func Parse(letters string) (uint32, error) {
+	var flags uint32
+	for _, c := range letters {
+		flag, ok := Flag(c)
+		if !ok {
+			return 0, fmt.Errorf("unknown flag %q in %q", c, letters)
+		}
+		flags |= flag
+	}
+	return flags, nil
+}
+
+// Format returns the letters of the inline flags that are set in flags.
+func Format(flags uint32) string {
+	var letters []byte
+	for i := 0; i < len(Letters); i++ {
+		if flags&(1<<uint(i)) != 0 {
+			letters = append(letters, Letters[i])
+		}
+	}
+	return string(letters)
+}
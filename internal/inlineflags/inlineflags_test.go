@@ -0,0 +1,28 @@
+package inlineflags
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	flags, err := Parse("imsUxu")
+	require.NoError(t, err)
+	require.Equal(t, uint32(1<<6-1), flags)
+	require.Equal(t, "imsUxu", Format(flags))
+
+	flags, err = Parse("ui")
+	require.NoError(t, err)
+	require.Equal(t, uint32(1<<5|1<<0), flags)
+	require.Equal(t, "iu", Format(flags))
+
+	flags, err = Parse("")
+	require.NoError(t, err)
+	require.Equal(t, uint32(0), flags)
+	require.Equal(t, "", Format(flags))
+
+	_, err = Parse("iq")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `unknown flag 'q' in "iq"`)
+}
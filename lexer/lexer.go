@@ -0,0 +1,279 @@
+/*
+Package lexer builds tokenizers out of an ordered list of regular expression
+rules, using the rure package to search.
+
+All rules are compiled into a single regex: an alternation with one capturing
+group per rule. Each token then costs one search starting at the end of the
+previous token, rather than one search per rule. Like a leftmost-first
+alternation, when more than one rule matches at a position, the rule given
+first wins, even if a later rule would match more text. So rules for keywords
+should be given before the rule for identifiers, for example.
+
+Text that no rule matches is reported as a token with the Error kind, which
+covers all of the text up to the position where a rule matches again.
+*/
+package lexer
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	rure "github.com/BurntSushi/rure-go"
+	"github.com/BurntSushi/rure-go/internal/combine"
+)
+
+// Error is the kind of tokens that cover text that no rule matches.
+const Error = ""
+
+// Rule is a kind of token and the pattern that matches it.
+type Rule struct {
+	// Kind is reported in each token matched by the rule. It must not be
+	// empty, since that is the kind of error tokens. Kinds need not be
+	// unique.
+	Kind string
+	// Pattern is the regular expression that matches the rule's tokens. It
+	// must not match the empty string. Its capturing groups may have the
+	// same names as those of other rules.
+	Pattern string
+	// Skip is true for rules whose tokens are not reported, such as
+	// whitespace and comments.
+	Skip bool
+}
+
+// Token is a single token in the text given to a Lexer.
+type Token struct {
+	// Kind is the kind of the rule that matched, or Error if no rule matched.
+	Kind string
+	// Start is the byte offset of the start of the token in the text.
+	Start int
+	// End is the byte offset of the end of the token in the text.
+	End int
+	// Text is the text of the token.
+	Text string
+	// Line is the line number of the start of the token, starting at 1.
+	Line int
+	// Column is the number of codepoints from the start of Line to the start
+	// of the token, starting at 1.
+	Column int
+}
+
+// Lexer splits text into tokens.
+//
+// It can be used safely from multiple goroutines simultaneously.
+type Lexer struct {
+	rules []Rule
+	re    *rure.Regex
+	// groups is the index of the capturing group for each rule in re.
+	groups []int
+}
+
+// New compiles rules into a Lexer. Flags and options have the same meaning
+// as in rure.CompileOptions, and are used to compile every rule.
+//
+// An error is returned if any rule fails to compile, has an empty kind or
+// matches the empty string.
+func New(rules []Rule, flags uint32, options *rure.Options) (*Lexer, error) {
+	lx := &Lexer{rules: append([]Rule(nil), rules...)}
+	pattern := ""
+	group := 1
+	for i, rule := range rules {
+		if rule.Kind == Error {
+			return nil, fmt.Errorf("lexer: rule %d has an empty kind", i)
+		}
+		re, err := rure.CompileOptions(rule.Pattern, flags, options)
+		if err != nil {
+			return nil, fmt.Errorf("lexer: rule %q: %s", rule.Kind, err)
+		}
+		if re.IsFullMatch("") {
+			return nil, fmt.Errorf(
+				"lexer: rule %q: %s", rule.Kind, combine.ErrMatchesEmpty)
+		}
+		wrapped, err := combine.Wrap(
+			withoutNames(re, flags), "(", ")", func(pattern string) error {
+				_, err := rure.CompileOptions(pattern, flags, options)
+				return err
+			})
+		if err != nil {
+			return nil, fmt.Errorf("lexer: rule %q: %s", rule.Kind, err)
+		}
+		if i > 0 {
+			pattern += "|"
+		}
+		pattern += wrapped
+		lx.groups = append(lx.groups, group)
+		group += len(re.CaptureNames())
+	}
+	if len(rules) == 0 {
+		// Without any rules, all text is an error.
+		return lx, nil
+	}
+	re, err := rure.CompileOptions(pattern, flags, options)
+	if err != nil {
+		return nil, fmt.Errorf("lexer: %s", err)
+	}
+	lx.re = re
+	return lx, nil
+}
+
+// withoutNames returns the pattern of re, a rule compiled with flags, with
+// its named capturing groups replaced by unnamed ones, so that rules may use
+// the same names in the combined pattern.
+func withoutNames(re *rure.Regex, flags uint32) string {
+	named := false
+	for _, name := range re.CaptureNames() {
+		named = named || name != ""
+	}
+	if !named {
+		return re.String()
+	}
+	e, err := rure.Explain(re.String(), flags)
+	if err != nil {
+		return re.String()
+	}
+	var starts []int
+	var visit func(x *rure.ExplainNode)
+	visit = func(x *rure.ExplainNode) {
+		if x.Kind == rure.ExplainGroup && x.Name != "" {
+			starts = append(starts, x.Start)
+		}
+		for _, child := range x.Children {
+			visit(child)
+		}
+	}
+	visit(e.Root)
+	return combine.WithoutNames(re.String(), starts)
+}
+
+// Rules returns the rules the lexer was compiled with.
+func (lx *Lexer) Rules() []Rule {
+	return append([]Rule(nil), lx.rules...)
+}
+
+// Tokens returns every token in text that is not skipped.
+func (lx *Lexer) Tokens(text string) []Token {
+	var tokens []Token
+	sc := lx.Scan(text)
+	for sc.Next() {
+		tokens = append(tokens, sc.Token())
+	}
+	return tokens
+}
+
+// Scan returns a Scanner over the tokens in text.
+func (lx *Lexer) Scan(text string) *Scanner {
+	return &Scanner{lx: lx, text: text, line: 1, column: 1}
+}
+
+// Scanner is a stream of tokens in a text.
+//
+// It is not safe to use from multiple goroutines simultaneously.
+type Scanner struct {
+	lx   *Lexer
+	text string
+	pos  int
+	// line and column are the position of pos.
+	line   int
+	column int
+	token  Token
+	// rule is the index of the rule that matched token, or -1 for errors.
+	rule int
+	// pending is the end of a match found after an error token, or 0. The
+	// match starts at pos and is returned by the next call to scan.
+	pending     int
+	pendingRule int
+}
+
+// Next advances to the next token that is not skipped, which is then
+// available through Token. It returns false at the end of the text.
+func (sc *Scanner) Next() bool {
+	for sc.scan() {
+		if sc.rule < 0 || !sc.lx.rules[sc.rule].Skip {
+			return true
+		}
+	}
+	return false
+}
+
+// Token returns the most recent token found by Next.
+func (sc *Scanner) Token() Token {
+	return sc.token
+}
+
+// scan finds the next token, skipped or not. When there is text before the
+// next match that no rule matches, the error token is found first and the
+// match is kept for the next call.
+func (sc *Scanner) scan() bool {
+	if sc.pending > 0 {
+		sc.advance(sc.pendingRule, sc.pending)
+		sc.pending = 0
+		return true
+	}
+	if sc.pos >= len(sc.text) {
+		return false
+	}
+	var locs []int
+	if sc.lx.re != nil {
+		locs = sc.lx.re.FindSubmatchIndexAt(sc.text, sc.pos)
+	}
+	if locs == nil {
+		sc.advance(-1, len(sc.text))
+		return true
+	}
+	start, end := locs[0], locs[1]
+	if start == end {
+		// New rejects rules that match the empty string, but a rule can
+		// still match it depending on the text around it, such as with a
+		// word boundary. An empty token would never advance, so the
+		// codepoint after it is an error instead, once the text before it
+		// is.
+		if start > sc.pos {
+			sc.advance(-1, start)
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(sc.text[start:])
+		sc.advance(-1, start+size)
+		return true
+	}
+	rule := 0
+	for i, group := range sc.lx.groups {
+		if locs[2*group] >= 0 {
+			rule = i
+			break
+		}
+	}
+	if start > sc.pos {
+		sc.advance(-1, start)
+		sc.pending, sc.pendingRule = end, rule
+		return true
+	}
+	sc.advance(rule, end)
+	return true
+}
+
+// advance sets the current token to the text from pos to end, and moves pos
+// to end.
+func (sc *Scanner) advance(rule, end int) {
+	kind := Error
+	if rule >= 0 {
+		kind = sc.lx.rules[rule].Kind
+	}
+	text := sc.text[sc.pos:end]
+	sc.token = Token{
+		Kind:   kind,
+		Start:  sc.pos,
+		End:    end,
+		Text:   text,
+		Line:   sc.line,
+		Column: sc.column,
+	}
+	sc.rule = rule
+	sc.pos = end
+	for _, r := range text {
+		if r == '\n' {
+			sc.line++
+			sc.column = 1
+		} else {
+			sc.column++
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package lexer
+
+import (
+	"testing"
+
+	rure "github.com/BurntSushi/rure-go"
+	"github.com/stretchr/testify/require"
+)
+
+var calcRules = []Rule{
+	{Kind: "space", Pattern: `\s+`, Skip: true},
+	{Kind: "comment", Pattern: `#.*`, Skip: true},
+	{Kind: "let", Pattern: `let(?:[^\w]|$)`},
+	{Kind: "number", Pattern: `(\d+)(?:\.(\d+))?`},
+	{Kind: "ident", Pattern: `\w+`},
+	{Kind: "op", Pattern: `[-+*/=]`},
+}
+
+func kinds(tokens []Token) []string {
+	var out []string
+	for _, tok := range tokens {
+		out = append(out, tok.Kind+":"+tok.Text)
+	}
+	return out
+}
+
+func TestTokens(t *testing.T) {
+	lx, err := New(calcRules, rure.FlagDefault, nil)
+	require.NoError(t, err)
+
+	tokens := lx.Tokens("x = 1.5 + y2 # sum\nlettuce*3")
+	require.Equal(t, []string{
+		"ident:x", "op:=", "number:1.5", "op:+", "ident:y2",
+		"ident:lettuce", "op:*", "number:3",
+	}, kinds(tokens))
+	require.Equal(t, Token{
+		Kind: "ident", Start: 19, End: 26, Text: "lettuce",
+		Line: 2, Column: 1,
+	}, tokens[5])
+	require.Equal(t, Token{
+		Kind: "number", Start: 4, End: 7, Text: "1.5", Line: 1, Column: 5,
+	}, tokens[2])
+}
+
+func TestErrors(t *testing.T) {
+	lx, err := New(calcRules, rure.FlagDefault, nil)
+	require.NoError(t, err)
+
+	tokens := lx.Tokens("a ☃☃ b\n$")
+	require.Equal(t, []string{"ident:a", ":☃☃", "ident:b", ":$"},
+		kinds(tokens))
+	require.Equal(t, 3, tokens[1].Column)
+	require.Equal(t, 6, tokens[2].Column)
+	require.Equal(t, Token{
+		Kind: Error, Start: 11, End: 12, Text: "$", Line: 2, Column: 1,
+	}, tokens[3])
+
+	empty, err := New(nil, rure.FlagDefault, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{":abc"}, kinds(empty.Tokens("abc")))
+	require.Empty(t, empty.Tokens(""))
+}
+
+func TestEmptyMatch(t *testing.T) {
+	lx, err := New([]Rule{
+		{Kind: "edge", Pattern: `(?-u:\b)|x`},
+		{Kind: "word", Pattern: `\w+`},
+	}, rure.FlagDefault, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{":a", "word:b"}, kinds(lx.Tokens("ab")))
+	require.Equal(t, []string{": ", ":a", "word:b"},
+		kinds(lx.Tokens(" ab")))
+}
+
+func TestSameGroupNames(t *testing.T) {
+	lx, err := New([]Rule{
+		{Kind: "hex", Pattern: `0x(?P<n>[0-9a-f]+)`},
+		{Kind: "dec", Pattern: `(?P<n>[0-9]+)`},
+		{Kind: "space", Pattern: `(?x) \s+ # (?P<n>x)`, Skip: true},
+	}, rure.FlagDefault, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"hex:0xff", "dec:12"},
+		kinds(lx.Tokens("0xff 12")))
+}
+
+func TestScanner(t *testing.T) {
+	lx, err := New([]Rule{
+		{Kind: "comment", Pattern: `\#[a-z\ ]*  # a comment`},
+		{Kind: "word", Pattern: `[a-z]+`},
+	}, rure.FlagDefault|rure.FlagSpace, nil)
+	require.NoError(t, err)
+	sc := lx.Scan("#hi there")
+	require.True(t, sc.Next())
+	require.Equal(t, "comment", sc.Token().Kind)
+	require.Equal(t, "#hi there", sc.Token().Text)
+	require.False(t, sc.Next())
+	require.Len(t, lx.Rules(), 2)
+}
+
+func TestNewErrors(t *testing.T) {
+	_, err := New([]Rule{{Kind: "a", Pattern: `a*`}}, rure.FlagDefault, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "empty string")
+
+	_, err = New([]Rule{{Kind: "a", Pattern: `(`}}, rure.FlagDefault, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `rule "a"`)
+
+	_, err = New([]Rule{{Pattern: `a`}}, rure.FlagDefault, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,160 @@
+package rure
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/BurntSushi/rure-go/internal/inlineflags"
+)
+
+var errMarshalZero = errors.New("rure: cannot marshal a Regex that was " +
+	"never compiled")
+
+// MarshalText implements encoding.TextMarshaler. The text is the pattern re
+// was compiled with, prefixed by any flags it was compiled with written as
+// inline flags. e.g., a pattern `foo` compiled with FlagCaseI (and without
+// FlagUnicode) is written as `(?i-u)foo`.
+//
+// Compiling the text with Compile produces an equivalent regular expression,
+// but non-flag options such as size limits are not preserved.
+//
+// The zero value of Regex has no pattern, so marshaling it returns an error
+// rather than text that would compile to a regex matching everything.
+func (re *Regex) MarshalText() ([]byte, error) {
+	if !re.isCompiled() {
+		return nil, errMarshalZero
+	}
+	return []byte(inlineFlags(re.flags) + re.pattern), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler by compiling text with
+// default flags and default size limits, as if by Compile.
+//
+// If there was a problem compiling text, then an error is returned and re is
+// left unchanged.
+func (re *Regex) UnmarshalText(text []byte) error {
+	return re.compile(string(text), FlagDefault, nil, false)
+}
+
+// MarshalJSON implements json.Marshaler by encoding the result of
+// MarshalText as a JSON string.
+func (re *Regex) MarshalJSON() ([]byte, error) {
+	text, err := re.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(text))
+}
+
+// UnmarshalJSON implements json.Unmarshaler by decoding a JSON string and
+// compiling it as if by UnmarshalText. A JSON null leaves re unchanged.
+func (re *Regex) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	return re.UnmarshalText([]byte(text))
+}
+
+// inlineFlags returns flags written as a group of inline flags, or an empty
+// string when flags are the default flags.
+func inlineFlags(flags uint32) string {
+	on := inlineflags.Format(flags &^ FlagUnicode)
+	var off string
+	if flags&FlagUnicode == 0 {
+		off = "-u"
+	}
+	if on == "" && off == "" {
+		return ""
+	}
+	return "(?" + on + off + ")"
+}
+
+// Flag is a flag.Value that holds a regular expression. Setting it compiles
+// the value given with Compile, so that invalid patterns are reported by the
+// flag package as an invalid flag value.
+//
+// For example:
+//
+//	var match rure.Flag
+//	flag.Var(&match, "match", "only print lines matching this regex")
+//	flag.Parse()
+//	if match.Regex != nil && match.Regex.IsMatch(line) {
+//		...
+//	}
+type Flag struct {
+	// Regex is the regular expression most recently set, or nil if the flag
+	// was never set.
+	Regex *Regex
+}
+
+// String returns the text of the regular expression, as written by
+// MarshalText, or an empty string if it was never set.
+func (f *Flag) String() string {
+	if f == nil || f.Regex == nil {
+		return ""
+	}
+	text, _ := f.Regex.MarshalText()
+	return string(text)
+}
+
+// Set compiles pattern and, if it compiled successfully, replaces the
+// regular expression held by f.
+func (f *Flag) Set(pattern string) error {
+	re, err := Compile(pattern)
+	if err != nil {
+		return err
+	}
+	f.Regex = re
+	return nil
+}
+
+// Get implements flag.Getter by returning the *Regex held by f.
+func (f *Flag) Get() interface{} {
+	return f.Regex
+}
+
+// FlagList is a flag.Value that holds a list of regular expressions. Each
+// time the flag is given, its value is compiled with Compile and appended to
+// the list, so that invalid patterns are reported by the flag package as an
+// invalid flag value.
+//
+// For example:
+//
+//	var excludes rure.FlagList
+//	flag.Var(&excludes, "exclude", "skip files matching this regex (repeatable)")
+type FlagList []*Regex
+
+// String returns the text of every regular expression in the list, as
+// written by MarshalText, separated by commas.
+func (list *FlagList) String() string {
+	if list == nil {
+		return ""
+	}
+	texts := make([]string, len(*list))
+	for i, re := range *list {
+		text, _ := re.MarshalText()
+		texts[i] = string(text)
+	}
+	return strings.Join(texts, ",")
+}
+
+// Set compiles pattern and, if it compiled successfully, appends it to the
+// list.
+func (list *FlagList) Set(pattern string) error {
+	re, err := Compile(pattern)
+	if err != nil {
+		return err
+	}
+	*list = append(*list, re)
+	return nil
+}
+
+// Get implements flag.Getter by returning the list as a []*Regex.
+func (list *FlagList) Get() interface{} {
+	return []*Regex(*list)
+}
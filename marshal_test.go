@@ -0,0 +1,116 @@
+package rure
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalText(t *testing.T) {
+	tests := []struct {
+		pattern string
+		flags   uint32
+		want    string
+	}{
+		{`a+b`, FlagDefault, `a+b`},
+		{`a+b`, FlagCaseI | FlagMulti | FlagUnicode, `(?im)a+b`},
+		{`a+b`, FlagDotNL | FlagSwapGreed | FlagSpace, `(?sUx-u)a+b`},
+		{`a+b`, 0, `(?-u)a+b`},
+	}
+	for _, test := range tests {
+		re, err := CompileOptions(test.pattern, test.flags, nil)
+		require.NoError(t, err)
+		text, err := re.MarshalText()
+		require.NoError(t, err)
+		require.Equal(t, test.want, string(text))
+
+		var got Regex
+		require.NoError(t, got.UnmarshalText(text))
+		require.Equal(t, test.want, got.String())
+	}
+}
+
+func TestMarshalZero(t *testing.T) {
+	var re Regex
+	_, err := re.MarshalText()
+	require.Error(t, err)
+	_, err = json.Marshal(&struct{ P Regex }{})
+	require.Error(t, err)
+	_, err = re.Value()
+	require.Error(t, err)
+}
+
+func TestUnmarshalText(t *testing.T) {
+	var re Regex
+	require.NoError(t, re.UnmarshalText([]byte(`(?i)foo`)))
+	require.True(t, re.IsMatch("FOO"))
+
+	// Compiling again replaces the regex, and a failure leaves it as is.
+	require.NoError(t, re.UnmarshalText([]byte(`bar`)))
+	require.Error(t, re.UnmarshalText([]byte(`(`)))
+	runtime.GC()
+	require.Equal(t, "bar", re.String())
+	require.True(t, re.IsMatch("bar"))
+	require.False(t, re.IsMatch("FOO"))
+}
+
+func TestJSON(t *testing.T) {
+	type config struct {
+		Name     string
+		Pattern  Regex
+		Optional *Regex
+	}
+	var cfg config
+	err := json.Unmarshal(
+		[]byte(`{"Name": "x", "Pattern": "(?i)f\\w+", "Optional": null}`),
+		&cfg)
+	require.NoError(t, err)
+	require.True(t, cfg.Pattern.IsMatch("FOO"))
+	require.Nil(t, cfg.Optional)
+
+	cfg.Optional, err = CompileOptions(`"a"`, FlagCaseI|FlagUnicode, nil)
+	require.NoError(t, err)
+	data, err := json.Marshal(&cfg)
+	require.NoError(t, err)
+	require.JSONEq(t,
+		`{"Name": "x", "Pattern": "(?i)f\\w+", "Optional": "(?i)\"a\""}`,
+		string(data))
+
+	err = json.Unmarshal([]byte(`{"Pattern": "("}`), &cfg)
+	require.Error(t, err)
+	err = json.Unmarshal([]byte(`{"Pattern": 1}`), &cfg)
+	require.Error(t, err)
+}
+
+func TestFlag(t *testing.T) {
+	var match Flag
+	var excludes FlagList
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.Var(&match, "match", "")
+	fs.Var(&excludes, "exclude", "")
+
+	err := fs.Parse([]string{
+		"-match", `(?i)foo`, "-exclude", `\.go$`, "-exclude", `^vendor/`,
+	})
+	require.NoError(t, err)
+	require.Equal(t, `(?i)foo`, match.String())
+	require.True(t, match.Regex.IsMatch("FOO"))
+	require.Len(t, excludes, 2)
+	require.Equal(t, `\.go$,^vendor/`, excludes.String())
+	getter := fs.Lookup("exclude").Value.(flag.Getter)
+	require.Equal(t, []*Regex(excludes), getter.Get())
+
+	err = fs.Parse([]string{"-match", `(`})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `invalid value "(" for flag -match`)
+	require.Equal(t, `(?i)foo`, match.String())
+
+	err = fs.Parse([]string{"-exclude", `[`})
+	require.Error(t, err)
+	require.Len(t, excludes, 2)
+}
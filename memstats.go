@@ -0,0 +1,105 @@
+package rure
+
+import (
+	"sync/atomic"
+)
+
+// MemStats describes the memory allocated by the C library for the objects
+// of this package that are still live, which isn't included in the Go
+// runtime's memory statistics.
+//
+// The pure Go fallback doesn't allocate any C memory, so all of its
+// statistics are always zero.
+type MemStats struct {
+	// Regexes is the number of live Regex values.
+	Regexes int64
+	// Sets is the number of live RegexSet values.
+	Sets int64
+	// Captures is the number of live Captures values, including those pooled
+	// by Regex values for methods like FindSubmatchIndex.
+	Captures int64
+	// Iters is the number of live Iter values.
+	Iters int64
+	// Options is the number of live Options values.
+	Options int64
+	// Bytes is an estimate of the memory used by all of the live objects.
+	// It includes the compiled size of each Regex and RegexSet whose size
+	// has been measured, either by calling CompiledSize or because memory
+	// accounting was enabled with SetMemAccounting when it was compiled,
+	// along with the locations held by each Captures. It does not include
+	// the regexes that this package compiles internally, such as for
+	// IsFullMatch, nor the caches used while searching, which may grow up to
+	// the DFA size limit for each goroutine that is searching
+	// simultaneously.
+	Bytes int64
+}
+
+// memStats holds the counters reported by ReadMemStats, which are updated
+// atomically when C objects are allocated and freed.
+var memStats MemStats
+
+// memAccounting is 1 when every Regex should have its size measured when it
+// is compiled.
+var memAccounting int32
+
+// ReadMemStats returns the current memory statistics.
+//
+// The objects of this package are freed by finalizers, so the statistics
+// only go down after a garbage collection. A steady rise in a count across
+// collections, then, is a sign of a leak.
+func ReadMemStats() MemStats {
+	return MemStats{
+		Regexes:  atomic.LoadInt64(&memStats.Regexes),
+		Sets:     atomic.LoadInt64(&memStats.Sets),
+		Captures: atomic.LoadInt64(&memStats.Captures),
+		Iters:    atomic.LoadInt64(&memStats.Iters),
+		Options:  atomic.LoadInt64(&memStats.Options),
+		Bytes:    atomic.LoadInt64(&memStats.Bytes),
+	}
+}
+
+// SetMemAccounting sets whether the compiled size of every Regex and
+// RegexSet is measured as soon as it is compiled, so that it is included in
+// MemStats.Bytes. Measuring the size costs about a dozen extra compiles (see
+// Regex.CompiledSize), so it is disabled by default, and is never done for
+// the regexes that this package compiles internally.
+func SetMemAccounting(enabled bool) {
+	if enabled {
+		atomic.StoreInt32(&memAccounting, 1)
+	} else {
+		atomic.StoreInt32(&memAccounting, 0)
+	}
+}
+
+// trackMem adds delta objects, using bytes bytes, to a counter in memStats.
+func trackMem(count *int64, delta int64, bytes int64) {
+	atomic.AddInt64(count, delta)
+	if bytes != 0 {
+		atomic.AddInt64(&memStats.Bytes, bytes)
+	}
+}
+
+// measureSize returns the smallest size limit, within 1/16th, that a
+// pattern compiles within, where fits reports whether it compiles within a
+// limit. It starts small and doubles the limit until the pattern fits, and
+// then narrows it down with a binary search.
+func measureSize(fits func(limit int) bool) int64 {
+	lo, hi := 0, 1024
+	for !fits(hi) {
+		lo, hi = hi, 2*hi
+		if hi <= 0 {
+			// The pattern compiled originally, so this is impossible
+			// short of the size limit not being respected at all.
+			return 0
+		}
+	}
+	for hi-lo > hi/16 {
+		mid := lo + (hi-lo)/2
+		if fits(mid) {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return int64(hi)
+}
@@ -0,0 +1,96 @@
+//go:build cgo && !purego
+// +build cgo,!purego
+
+package rure
+
+import (
+	"runtime"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompiledSize(t *testing.T) {
+	small := MustCompile(`[a-z]+@[a-z]+`)
+	big := MustCompile(`\w{50}`)
+	require.Greater(t, small.CompiledSize(), 0)
+	require.Greater(t, big.CompiledSize(), 10*small.CompiledSize())
+	// The size is measured once and then cached.
+	require.Equal(t, big.CompiledSize(), big.CompiledSize())
+
+	// The pattern can't compile with a size limit below its size, and can
+	// with one at it.
+	size := big.CompiledSize()
+	opts := NewOptions()
+	opts.SetSizeLimit(size)
+	_, err := CompileOptions(`\w{50}`, FlagDefault, opts)
+	require.NoError(t, err)
+	opts.SetSizeLimit(size * 9 / 10)
+	_, err = CompileOptions(`\w{50}`, FlagDefault, opts)
+	require.Error(t, err)
+
+	set := MustCompileSet([]string{`[a-z]+@[a-z]+`, `\w{50}`})
+	require.GreaterOrEqual(t, set.CompiledSize(), size)
+	opts.SetSizeLimit(set.CompiledSize())
+	_, err = CompileSetOptions(set.Patterns(), FlagDefault, opts)
+	require.NoError(t, err)
+
+	require.Equal(t, 0, (&Regex{}).CompiledSize())
+	require.Equal(t, 0, (&RegexSet{}).CompiledSize())
+}
+
+// settledMemStats collects garbage until finalizers stop changing the
+// memory statistics, and then returns them.
+func settledMemStats() MemStats {
+	last := ReadMemStats()
+	for i, stable := 0, 0; i < 100 && stable < 3; i++ {
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+		stats := ReadMemStats()
+		if stats == last {
+			stable++
+		} else {
+			stable = 0
+		}
+		last = stats
+	}
+	return last
+}
+
+func TestMemStats(t *testing.T) {
+	// A collection while the objects are counted would run the finalizers
+	// of objects left behind by other tests.
+	settledMemStats()
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+	before := ReadMemStats()
+
+	SetMemAccounting(true)
+	re := MustCompile(`(\w+) (\d+)`)
+	set := MustCompileSet([]string{`\w`, `\d`})
+	SetMemAccounting(false)
+	caps := re.NewCaptures()
+	it := re.Iter("a 1")
+	opts := NewOptions()
+
+	after := ReadMemStats()
+	require.Equal(t, before.Regexes+1, after.Regexes)
+	require.Equal(t, before.Sets+1, after.Sets)
+	require.Equal(t, before.Captures+1, after.Captures)
+	require.Equal(t, before.Iters+1, after.Iters)
+	require.Equal(t, before.Options+1, after.Options)
+	require.Equal(t,
+		before.Bytes+int64(re.CompiledSize()+set.CompiledSize())+
+			captureBytes(3),
+		after.Bytes)
+
+	runtime.KeepAlive(set)
+	runtime.KeepAlive(caps)
+	runtime.KeepAlive(it)
+	runtime.KeepAlive(opts)
+	re, set, caps, it, opts = nil, nil, nil, nil, nil
+	after = settledMemStats()
+	require.LessOrEqual(t, after.Regexes, before.Regexes)
+	require.LessOrEqual(t, after.Bytes, before.Bytes)
+}
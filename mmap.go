@@ -0,0 +1,160 @@
+package rure
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// errNoMmap is returned by mmapFile on platforms without memory mapping.
+var errNoMmap = errors.New("rure: memory mapping is not supported")
+
+// MappedHaystack is the contents of a file, mapped into memory read-only
+// where possible so that it can be searched without being read into the Go
+// heap.
+//
+// Files that can't be mapped, such as pipes, devices, files that report a
+// size of zero like those in /proc, and all files on platforms without
+// memory mapping, are read into memory instead.
+//
+// Close must be called when the haystack is no longer needed, since mapped
+// memory is not managed by the garbage collector. After Close, the haystack
+// is empty, and any slice returned by Bytes, or Iter created by Iter, must
+// no longer be used. It is not safe to call Close while the haystack is being
+// searched, but it is otherwise safe to search it from multiple goroutines
+// simultaneously.
+//
+// If a mapped file is modified while it is mapped, then searches may see
+// the changes. If it is truncated, then searching it may crash the program.
+type MappedHaystack struct {
+	data   []byte
+	mapped bool
+}
+
+// OpenFile opens the file at path and maps it into memory.
+func OpenFile(path string) (*MappedHaystack, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	// The mapping, if any, stays valid after the file is closed.
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	if fi.Mode().IsRegular() && size > 0 {
+		if size != int64(int(size)) {
+			return nil, fmt.Errorf("rure: %s is too big to map (%d bytes)",
+				path, size)
+		}
+		data, err := mmapFile(f, int(size))
+		if err == nil {
+			return &MappedHaystack{data: data, mapped: true}, nil
+		}
+		if err != errNoMmap {
+			return nil, &os.PathError{Op: "mmap", Path: path, Err: err}
+		}
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return &MappedHaystack{data: data}, nil
+}
+
+// Close unmaps the file. It is safe to call more than once.
+func (h *MappedHaystack) Close() error {
+	data, mapped := h.data, h.mapped
+	h.data, h.mapped = nil, false
+	if !mapped {
+		return nil
+	}
+	return munmap(data)
+}
+
+// Bytes returns the contents of the file, which must not be modified or used
+// after Close.
+func (h *MappedHaystack) Bytes() []byte {
+	return h.data
+}
+
+// Len returns the size of the file in bytes.
+func (h *MappedHaystack) Len() int {
+	return len(h.data)
+}
+
+// Mapped returns true if the file is mapped into memory, or false if it was
+// read into memory instead.
+func (h *MappedHaystack) Mapped() bool {
+	return h.mapped
+}
+
+// IsMatch is like Regex.IsMatchBytes on the contents of the file.
+func (h *MappedHaystack) IsMatch(re *Regex) bool {
+	return re.IsMatchBytes(h.data)
+}
+
+// Find is like Regex.FindBytes on the contents of the file.
+func (h *MappedHaystack) Find(re *Regex) (start, end int, ok bool) {
+	return re.FindBytes(h.data)
+}
+
+// FindAll is like Regex.FindAllBytes on the contents of the file.
+func (h *MappedHaystack) FindAll(re *Regex) []int {
+	return re.FindAllBytes(h.data)
+}
+
+// Iter is like Regex.IterBytes on the contents of the file. The iterator must
+// not be used after Close.
+func (h *MappedHaystack) Iter(re *Regex) *Iter {
+	return re.IterBytes(h.data)
+}
+
+// LineMatch is a line of a file that contains a match.
+type LineMatch struct {
+	// Number is the line number, starting at 1.
+	Number int
+	// Start is the byte offset of the start of the line.
+	Start int
+	// End is the byte offset of the end of the line, not including its line
+	// terminator (\n or \r\n).
+	End int
+}
+
+// FindLines returns every line of the file that contains a match of re, like
+// grep. A match that spans more than one line counts for the line it starts
+// on. A line is reported once no matter how many matches it contains.
+func (h *MappedHaystack) FindLines(re *Regex) []LineMatch {
+	var lines []LineMatch
+	// counted is the offset up to which new lines have been counted in
+	// number, and next is the start of the first line not yet reported.
+	number, counted, next := 1, 0, 0
+	it := re.IterBytes(h.data)
+	for it.Next(nil) {
+		start, _ := it.Match()
+		if start < next {
+			continue
+		}
+		number += bytes.Count(h.data[counted:start], []byte{'\n'})
+		counted = start
+		lineStart := bytes.LastIndexByte(h.data[:start], '\n') + 1
+		lineEnd := len(h.data)
+		if i := bytes.IndexByte(h.data[start:], '\n'); i >= 0 {
+			lineEnd = start + i
+			next = lineEnd + 1
+		} else {
+			next = len(h.data) + 1
+		}
+		line := LineMatch{Number: number, Start: lineStart, End: lineEnd}
+		if line.End > line.Start && h.data[line.End-1] == '\r' {
+			line.End--
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,77 @@
+package rure
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rure")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "haystack")
+	contents := []byte("foo 1\nbar\r\nbaz 22 3\n\nqux 4")
+	require.NoError(t, ioutil.WriteFile(path, contents, 0644))
+
+	h, err := OpenFile(path)
+	require.NoError(t, err)
+	defer h.Close()
+	if runtime.GOOS == "linux" || runtime.GOOS == "darwin" {
+		require.True(t, h.Mapped())
+	}
+
+	re := MustCompile(`\d+`)
+	require.Equal(t, 26, h.Len())
+	require.True(t, h.IsMatch(re))
+	start, end, ok := h.Find(re)
+	require.True(t, ok)
+	require.Equal(t, []int{4, 5}, []int{start, end})
+	require.Equal(t, []int{4, 5, 15, 17, 18, 19, 25, 26}, h.FindAll(re))
+	it := h.Iter(re)
+	require.True(t, it.Next(nil))
+	start, end = it.Match()
+	require.Equal(t, []int{4, 5}, []int{start, end})
+	require.Equal(t, []LineMatch{
+		{Number: 1, Start: 0, End: 5},
+		{Number: 3, Start: 11, End: 19},
+		{Number: 5, Start: 21, End: 26},
+	}, h.FindLines(re))
+	require.Equal(t, []LineMatch{{Number: 2, Start: 6, End: 9}},
+		h.FindLines(MustCompile(`bar`)))
+	require.Empty(t, h.FindLines(MustCompile(`nope`)))
+
+	require.NoError(t, h.Close())
+	require.NoError(t, h.Close())
+	require.Equal(t, 0, h.Len())
+	require.False(t, h.IsMatch(re))
+}
+
+func TestOpenFileUnmapped(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rure")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "empty")
+	require.NoError(t, ioutil.WriteFile(path, nil, 0644))
+
+	h, err := OpenFile(path)
+	require.NoError(t, err)
+	require.False(t, h.Mapped())
+	require.Equal(t, 0, h.Len())
+	require.True(t, h.IsMatch(MustCompile(`^$`)))
+	require.NoError(t, h.Close())
+
+	if _, err := os.Stat(os.DevNull); err == nil {
+		h, err := OpenFile(os.DevNull)
+		require.NoError(t, err)
+		require.False(t, h.Mapped())
+		require.NoError(t, h.Close())
+	}
+
+	_, err = OpenFile(filepath.Join(dir, "missing"))
+	require.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,179 @@
+package rure
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ServeMux is an HTTP request multiplexer whose routes are regular
+// expressions matched against the path of each request.
+//
+// A route matches when its pattern matches the entire path, as if by
+// Regex.IsFullMatch, and its method (if any) is the method of the request.
+// The text matched by each named capturing group in the pattern is available
+// to the route's handler through PathValue and PathValues.
+//
+// Every route is compiled into a single RegexSet, so that a request is matched
+// against all routes in a single search no matter how many routes there are.
+// Only the winning route is searched again to find its captures.
+//
+// When more than one route matches a request, the route that was registered
+// first wins. If routes match the path of a request but none of them match
+// its method, then the response is 405 Method Not Allowed. If no route
+// matches the path, then the response is 404 Not Found.
+//
+// It can be used safely from multiple goroutines simultaneously.
+type ServeMux struct {
+	mu     sync.RWMutex
+	routes []muxRoute
+	rules  []Rule
+	// router is compiled from routes on the first request after a route is
+	// added.
+	router *Router
+}
+
+type muxRoute struct {
+	method  string
+	handler http.Handler
+}
+
+// NewServeMux returns a new ServeMux without any routes.
+func NewServeMux() *ServeMux {
+	return &ServeMux{}
+}
+
+// Handle registers handler for requests with the given method whose path
+// matches pattern. An empty method matches requests with any method.
+//
+// If pattern fails to compile, then Handle panics.
+func (mux *ServeMux) Handle(method, pattern string, handler http.Handler) {
+	if handler == nil {
+		panic("rure: nil handler for " + pattern)
+	}
+	if _, err := Compile(pattern); err != nil {
+		panic(fmt.Sprintf("rure: invalid route %s: %s", pattern, err))
+	}
+	_, anchored, _ := wrapPattern(
+		pattern, anchorPrefix, anchorSuffix(true), FlagDefault, nil)
+
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	mux.routes = append(mux.routes, muxRoute{method, handler})
+	mux.rules = append(mux.rules, Rule{Name: pattern, Pattern: anchored})
+	mux.router = nil
+}
+
+// HandleFunc is like Handle, but takes a handler function.
+func (mux *ServeMux) HandleFunc(
+	method, pattern string,
+	handler func(http.ResponseWriter, *http.Request),
+) {
+	mux.Handle(method, pattern, http.HandlerFunc(handler))
+}
+
+// ServeHTTP dispatches the request to the handler of the route that wins.
+func (mux *ServeMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	router, routes := mux.compiled()
+	path := r.URL.Path
+	matches := router.finder.Set().MatchesBytes(noCopyBytes(path))
+	var allowed []string
+	for i, ok := range matches {
+		if !ok {
+			continue
+		}
+		if routes[i].method != "" && routes[i].method != r.Method {
+			allowed = append(allowed, routes[i].method)
+			continue
+		}
+		route, ok := router.route(i, noCopyBytes(path))
+		if !ok {
+			continue
+		}
+		ctx := r.Context()
+		ctx = context.WithValue(ctx, pathValuesKey{}, route.Captures)
+		routes[i].handler.ServeHTTP(w, r.WithContext(ctx))
+		return
+	}
+	if len(allowed) > 0 {
+		sort.Strings(allowed)
+		w.Header().Set("Allow", strings.Join(dedup(allowed), ", "))
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// compiled returns the router for the routes registered so far, compiling it
+// if necessary.
+func (mux *ServeMux) compiled() (*Router, []muxRoute) {
+	mux.mu.RLock()
+	router, routes := mux.router, mux.routes
+	mux.mu.RUnlock()
+	if router != nil {
+		return router, routes
+	}
+
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	if mux.router == nil {
+		router, err := NewRouter(mux.rules, FlagDefault, nil)
+		if err != nil {
+			// Each pattern was compiled when it was registered, so the only
+			// way this can fail is if the set exceeds the size limit.
+			panic(fmt.Sprintf("rure: compiling routes failed: %s", err))
+		}
+		mux.router = router
+	}
+	return mux.router, mux.routes
+}
+
+func dedup(sorted []string) []string {
+	out := sorted[:0]
+	for i, s := range sorted {
+		if i == 0 || s != sorted[i-1] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+type pathValuesKey struct{}
+
+// PathValue returns the text matched by the named capturing group name in
+// the route that matched r, which must be a request given to a handler by a
+// ServeMux. An empty string is returned if the group did not participate in
+// the match or if there is no such group.
+func PathValue(r *http.Request, name string) string {
+	values, _ := r.Context().Value(pathValuesKey{}).(map[string]string)
+	return values[name]
+}
+
+// PathValues returns the text matched by every named capturing group that
+// participated in the match of the route that matched r, which must be a
+// request given to a handler by a ServeMux.
+func PathValues(r *http.Request) map[string]string {
+	values, _ := r.Context().Value(pathValuesKey{}).(map[string]string)
+	return values
+}
+
+// Filter returns middleware that responds with 403 Forbidden to requests
+// whose path matches any pattern in deny, and passes all other requests to
+// the next handler. The path is searched for a match anywhere, as if by
+// RegexSet.IsMatch.
+func Filter(deny *RegexSet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if deny.IsMatch(r.URL.Path) {
+				http.Error(w, http.StatusText(http.StatusForbidden),
+					http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
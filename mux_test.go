@@ -0,0 +1,98 @@
+package rure
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func serve(h http.Handler, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestServeMux(t *testing.T) {
+	mux := NewServeMux()
+	mux.HandleFunc("GET", `/users/(?P<id>\d+)`,
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "get user %s", PathValue(r, "id"))
+		})
+	mux.HandleFunc("DELETE", `/users/(?P<id>\d+)`,
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "delete user %s", PathValue(r, "id"))
+		})
+	mux.HandleFunc("", `/users/(?P<user>\w+)/posts/(?P<post>\d+)?`,
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %v", r.Method, PathValues(r))
+		})
+	mux.HandleFunc("GET", `/files/(?P<path>.*)`,
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "file %q", PathValue(r, "path"))
+		})
+
+	w := serve(mux, "GET", "/users/42")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "get user 42", w.Body.String())
+
+	w = serve(mux, "DELETE", "/users/42")
+	require.Equal(t, "delete user 42", w.Body.String())
+
+	w = serve(mux, "PUT", "/users/42")
+	require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	require.Equal(t, "DELETE, GET", w.Header().Get("Allow"))
+
+	w = serve(mux, "POST", "/users/bob/posts/7")
+	require.Equal(t, "POST map[post:7 user:bob]", w.Body.String())
+	w = serve(mux, "GET", "/users/bob/posts/")
+	require.Equal(t, "GET map[user:bob]", w.Body.String())
+
+	// Routes must match the whole path.
+	w = serve(mux, "GET", "/users/42/")
+	require.Equal(t, http.StatusNotFound, w.Code)
+	w = serve(mux, "GET", "/api/users/42")
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	w = serve(mux, "GET", "/files/a/b.txt")
+	require.Equal(t, `file "a/b.txt"`, w.Body.String())
+}
+
+func TestServeMuxTieBreak(t *testing.T) {
+	mux := NewServeMux()
+	handler := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, name)
+		}
+	}
+	mux.Handle("GET", `/a/(?P<x>.*)`, handler("first"))
+	mux.Handle("", `/a/b`, handler("second"))
+	mux.Handle("POST", `/a/.*`, handler("third"))
+	mux.Handle("", "(?x)/c | /d # comment", handler("fourth"))
+
+	require.Equal(t, "first", serve(mux, "GET", "/a/b").Body.String())
+	require.Equal(t, "second", serve(mux, "PUT", "/a/b").Body.String())
+	require.Equal(t, "third", serve(mux, "POST", "/a/c").Body.String())
+
+	// Routes can be added after the mux has served requests.
+	mux.Handle("", `/b`, handler("fifth"))
+	require.Equal(t, "fifth", serve(mux, "GET", "/b").Body.String())
+	require.Equal(t, "fourth", serve(mux, "GET", "/d").Body.String())
+
+	require.Panics(t, func() { mux.Handle("", `(`, handler("bad")) })
+}
+
+func TestFilter(t *testing.T) {
+	mux := NewServeMux()
+	mux.HandleFunc("", `/.*`, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	})
+	h := Filter(MustCompileSet([]string{`\.\.`, `^/admin(/|$)`}))(mux)
+
+	require.Equal(t, "ok", serve(h, "GET", "/files/a.txt").Body.String())
+	require.Equal(t, http.StatusForbidden, serve(h, "GET", "/a/../b").Code)
+	require.Equal(t, http.StatusForbidden, serve(h, "GET", "/admin/x").Code)
+	require.Equal(t, "ok", serve(h, "GET", "/administrator").Body.String())
+}
@@ -0,0 +1,205 @@
+package rure
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Observer is notified of compiles and searches, such as to find out which
+// patterns are expensive in production.
+//
+// Its methods are called synchronously, on the goroutine doing the compile
+// or search, so they should be fast. They may be called from multiple
+// goroutines simultaneously.
+type Observer interface {
+	// OnCompile is called after a Regex is compiled, whether or not the
+	// compile succeeded.
+	OnCompile(event CompileEvent)
+	// OnSearch is called after a search with a Regex.
+	OnSearch(event SearchEvent)
+}
+
+// CompileEvent describes a compile of a Regex.
+type CompileEvent struct {
+	// Pattern is the pattern that was compiled.
+	Pattern string
+	// Flags are the flags the pattern was compiled with.
+	Flags uint32
+	// Size is the approximate size of the compiled program in bytes, as
+	// returned by Regex.CompiledSize. It is only measured when memory
+	// accounting is enabled with SetMemAccounting and Internal is false, and
+	// is 0 otherwise or when the compile failed.
+	Size int
+	// Duration is how long the compile took, not including measuring Size.
+	Duration time.Duration
+	// Err is the error that the compile failed with, if any.
+	Err error
+	// Internal is true for compiles of patterns that this package builds out
+	// of patterns given to it, rather than patterns compiled by a user. For
+	// example, the pattern wrapped in \A(?:...)\z that IsFullMatch uses, and
+	// the alternation of all patterns that a Redactor uses.
+	Internal bool
+}
+
+// SearchEvent describes a search with a Regex.
+type SearchEvent struct {
+	// Pattern is the pattern of the Regex that searched.
+	Pattern string
+	// Patterns are the patterns of the RegexSet that searched, for searches
+	// with a set, in which case Pattern is empty. They must not be modified.
+	Patterns []string
+	// Method is the name of the kind of search. For a Regex, it is one of
+	// IsMatch, ShortestMatch, Find, FindAll, Captures, FindSubmatchIndex,
+	// Count, Iter, IsMatchMany, FindMany or FindAllParallel, and for a
+	// RegexSet, it is IsMatch or Matches. Variants of a method, such as
+	// FindBytes and IsMatchAt, have the same name as the method they are a
+	// variant of.
+	//
+	// Iter is reported for each call to Iter.Next. IsMatchMany, FindMany and
+	// FindAllParallel are reported once for each call, however many
+	// haystacks or goroutines they search.
+	Method string
+	// HaystackLen is the length of the haystack in bytes, or the total
+	// length of the haystacks of IsMatchMany and FindMany.
+	HaystackLen int
+	// Matched is true if the search found a match, in any of the haystacks
+	// of IsMatchMany and FindMany.
+	Matched bool
+	// Duration is how long the search took.
+	Duration time.Duration
+}
+
+// observing is 1 when there is a global observer. It is checked before the
+// observer itself so that searches without an observer only pay for an atomic
+// load.
+var observing int32
+
+var globalObserver atomic.Value // observerBox
+
+// observerBox allows a nil Observer to be stored in an atomic.Value.
+type observerBox struct {
+	observer Observer
+}
+
+// SetObserver sets the observer that is notified of every compile, of every
+// search with a Regex that doesn't have its own observer, and of every search
+// with a RegexSet. A nil observer removes the global observer.
+//
+// It is safe to call at any time, including while other goroutines are
+// compiling and searching.
+func SetObserver(observer Observer) {
+	globalObserver.Store(observerBox{observer})
+	if observer == nil {
+		atomic.StoreInt32(&observing, 0)
+	} else {
+		atomic.StoreInt32(&observing, 1)
+	}
+}
+
+func loadObserver() Observer {
+	box, _ := globalObserver.Load().(observerBox)
+	return box.observer
+}
+
+// SetObserver sets the observer that is notified of every search with re,
+// in place of the global observer. A nil observer makes re use the global
+// observer again. Compiles are only reported to the global observer.
+//
+// Methods that search more than one haystack or on multiple goroutines, such
+// as IsMatchMany and FindAllParallel, report a single search for each call.
+//
+// It must not be called while re is in use by other goroutines.
+func (re *Regex) SetObserver(observer Observer) {
+	re.observer = observer
+}
+
+// startCompile returns the time a compile starts, or the zero time if no
+// observer is set.
+func startCompile() time.Time {
+	if atomic.LoadInt32(&observing) == 0 {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// endCompile notifies the global observer of a compile that started at
+// start, unless start is the zero time. The duration of event is set from
+// start, unless it is already set.
+func endCompile(start time.Time, event CompileEvent) {
+	if start.IsZero() {
+		return
+	}
+	if event.Duration == 0 {
+		event.Duration = time.Since(start)
+	}
+	if observer := loadObserver(); observer != nil {
+		observer.OnCompile(event)
+	}
+}
+
+// startSearch returns the time a search with re starts, or the zero time if
+// no observer is set.
+func (re *Regex) startSearch() time.Time {
+	if re.observer == nil && atomic.LoadInt32(&observing) == 0 {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// endSearch notifies the observer of re of a search that started at start,
+// unless start is the zero time.
+func (re *Regex) endSearch(
+	start time.Time,
+	method string,
+	haystackLen int,
+	matched bool,
+) {
+	if start.IsZero() {
+		return
+	}
+	observer := re.observer
+	if observer == nil {
+		observer = loadObserver()
+	}
+	if observer == nil {
+		return
+	}
+	observer.OnSearch(SearchEvent{
+		Pattern:     re.pattern,
+		Method:      method,
+		HaystackLen: haystackLen,
+		Matched:     matched,
+		Duration:    time.Since(start),
+	})
+}
+
+// startSearch returns the time a search with set starts, or the zero time if
+// no observer is set.
+func (set *RegexSet) startSearch() time.Time {
+	if atomic.LoadInt32(&observing) == 0 {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// endSearch notifies the global observer of a search with set that started
+// at start, unless start is the zero time.
+func (set *RegexSet) endSearch(
+	start time.Time,
+	method string,
+	haystackLen int,
+	matched bool,
+) {
+	if start.IsZero() {
+		return
+	}
+	if observer := loadObserver(); observer != nil {
+		observer.OnSearch(SearchEvent{
+			Patterns:    set.patterns,
+			Method:      method,
+			HaystackLen: haystackLen,
+			Matched:     matched,
+			Duration:    time.Since(start),
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package rure
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	mu       sync.Mutex
+	compiles []CompileEvent
+	searches []SearchEvent
+}
+
+func (r *recorder) OnCompile(event CompileEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.compiles = append(r.compiles, event)
+}
+
+func (r *recorder) OnSearch(event SearchEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.searches = append(r.searches, event)
+}
+
+func (r *recorder) methods() []string {
+	var methods []string
+	for _, event := range r.searches {
+		methods = append(methods, event.Method)
+	}
+	return methods
+}
+
+func TestObserver(t *testing.T) {
+	global := &recorder{}
+	SetObserver(global)
+	defer SetObserver(nil)
+
+	re, err := CompileOptions(`\w+`, FlagUnicode, nil)
+	require.NoError(t, err)
+	_, err = Compile(`(`)
+	require.Error(t, err)
+	require.Len(t, global.compiles, 2)
+	require.Equal(t, `\w+`, global.compiles[0].Pattern)
+	require.Equal(t, uint32(FlagUnicode), global.compiles[0].Flags)
+	require.NoError(t, global.compiles[0].Err)
+	require.Error(t, global.compiles[1].Err)
+
+	require.True(t, re.IsMatch("ab"))
+	require.False(t, re.IsMatchAt("ab", 2))
+	_, _, ok := re.Find("!")
+	require.False(t, ok)
+	re.ShortestMatch("a")
+	re.FindAll("a b")
+	re.Captures(re.NewCaptures(), "a")
+	re.FindSubmatchIndex("a")
+	re.CountLimit("a b", 1)
+	require.Equal(t, []string{
+		"IsMatch", "IsMatch", "Find", "ShortestMatch", "FindAll",
+		"Captures", "FindSubmatchIndex", "Count",
+	}, global.methods())
+	require.Equal(t, SearchEvent{
+		Pattern:     `\w+`,
+		Method:      "IsMatch",
+		HaystackLen: 2,
+		Matched:     true,
+		Duration:    global.searches[0].Duration,
+	}, global.searches[0])
+	require.False(t, global.searches[2].Matched)
+
+	// An observer for a Regex takes the place of the global one.
+	local := &recorder{}
+	re.SetObserver(local)
+	re.IsMatch("a")
+	require.Len(t, global.searches, 8)
+	require.Equal(t, []string{"IsMatch"}, local.methods())
+
+	SetObserver(nil)
+	re.SetObserver(nil)
+	MustCompile(`a`).IsMatch("a")
+	require.Len(t, global.compiles, 2)
+	require.Len(t, global.searches, 8)
+}
+
+func TestObserverCompiles(t *testing.T) {
+	global := &recorder{}
+	SetObserver(global)
+	defer SetObserver(nil)
+	SetMemAccounting(true)
+	defer SetMemAccounting(false)
+
+	re := MustCompile(`\w+`)
+	require.Len(t, global.compiles, 1)
+	require.Equal(t, re.CompiledSize(), global.compiles[0].Size)
+	require.False(t, global.compiles[0].Internal)
+
+	// Patterns built by the package are reported as internal.
+	re.IsFullMatch("ab")
+	_, err := NewRedactor([]Redaction{{Pattern: `a`}}, FlagDefault, nil)
+	require.NoError(t, err)
+	var user []string
+	for _, event := range global.compiles[1:] {
+		if !event.Internal {
+			user = append(user, event.Pattern)
+		} else {
+			// Internal compiles aren't measured.
+			require.Zero(t, event.Size, event.Pattern)
+		}
+	}
+	require.Equal(t, []string{`a`}, user)
+	require.Greater(t, len(global.compiles), 3)
+}
+
+func TestObserverBatches(t *testing.T) {
+	global := &recorder{}
+	SetObserver(global)
+	defer SetObserver(nil)
+
+	re := MustCompile(`\d+`)
+	re.IsMatchMany([]string{"a", "1"})
+	re.IsMatchManyBytes([][]byte{[]byte("a")})
+	re.FindMany([]string{"ab", "c"})
+	re.FindAllParallel([]byte("1 2"), 2)
+	it := re.Iter("1 2")
+	for it.Next(nil) {
+	}
+	require.Equal(t, []string{
+		"IsMatchMany", "IsMatchMany", "FindMany", "FindAllParallel",
+		"Iter", "Iter", "Iter",
+	}, global.methods())
+	require.Equal(t, 2, global.searches[0].HaystackLen)
+	require.True(t, global.searches[0].Matched)
+	require.False(t, global.searches[1].Matched)
+	require.Equal(t, 3, global.searches[2].HaystackLen)
+	require.False(t, global.searches[2].Matched)
+	require.True(t, global.searches[5].Matched)
+	require.False(t, global.searches[6].Matched)
+
+	// Searches with a set are reported with its patterns, and a SetFinder
+	// reports the searches of its set and of its regexes.
+	global.searches = nil
+	patterns := []string{`a`, `b`}
+	set := MustCompileSet(patterns)
+	require.True(t, set.IsMatch("a"))
+	set.Matches("b")
+	f, err := NewSetFinder(patterns, FlagDefault, nil)
+	require.NoError(t, err)
+	f.Find("a")
+	require.Equal(t,
+		[]string{"IsMatch", "Matches", "Matches", "Find"}, global.methods())
+	require.Equal(t, SearchEvent{
+		Patterns:    patterns,
+		Method:      "IsMatch",
+		HaystackLen: 1,
+		Matched:     true,
+		Duration:    global.searches[0].Duration,
+	}, global.searches[0])
+	require.Equal(t, "a", global.searches[3].Pattern)
+}
@@ -0,0 +1,188 @@
+package rure
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// offsetBlock is the number of bytes between the checkpoints of an
+// OffsetMapper, which bounds how much of the haystack is decoded to convert
+// an offset.
+const offsetBlock = 64
+
+// Position is a location in a haystack in the units used by editors and
+// protocols that don't work with UTF-8 byte offsets, such as the language
+// server protocol. Everything in a Position counts from 0.
+//
+// Invalid UTF-8 is counted as one codepoint, and one UTF-16 code unit, per
+// byte, as if each byte were replaced with U+FFFD.
+type Position struct {
+	// Offset is the byte offset.
+	Offset int
+	// Rune is the number of codepoints before Offset.
+	Rune int
+	// UTF16 is the number of UTF-16 code units before Offset.
+	UTF16 int
+	// Line is the number of new lines (\n) before Offset.
+	Line int
+	// Column is the number of codepoints between the start of Line and
+	// Offset.
+	Column int
+	// UTF16Column is the number of UTF-16 code units between the start of
+	// Line and Offset.
+	UTF16Column int
+}
+
+// Span is a range of a haystack, such as a match, given as Positions.
+type Span struct {
+	Start Position
+	End   Position
+}
+
+// OffsetMapper converts the byte offsets of a haystack, such as those
+// reported by Find, Captures.Group and Iter.Match, into Positions.
+//
+// It is built once for a haystack, in a single pass over it, after which
+// every conversion takes constant time: at most a small, fixed number of
+// bytes are decoded, no matter where the offset is.
+//
+// It can be used safely from multiple goroutines simultaneously.
+type OffsetMapper struct {
+	text []byte
+	// checkpoints has the position of the first codepoint that starts at or
+	// after every multiple of offsetBlock, and lines has the position of the
+	// start of every line.
+	checkpoints []Position
+	lines       []Position
+}
+
+// NewOffsetMapper returns an OffsetMapper for text.
+func NewOffsetMapper(text string) *OffsetMapper {
+	return NewOffsetMapperBytes(noCopyBytes(text))
+}
+
+// NewOffsetMapperBytes returns an OffsetMapper for text, which must not be
+// modified while the OffsetMapper is in use.
+func NewOffsetMapperBytes(text []byte) *OffsetMapper {
+	m := &OffsetMapper{
+		text:        text,
+		checkpoints: make([]Position, 0, len(text)/offsetBlock+1),
+		lines:       []Position{{}},
+	}
+	var pos Position
+	for {
+		if pos.Offset >= len(m.checkpoints)*offsetBlock {
+			m.checkpoints = append(m.checkpoints, pos)
+		}
+		if pos.Offset >= len(text) {
+			break
+		}
+		if m.advance(&pos) == '\n' {
+			m.lines = append(m.lines, pos)
+		}
+	}
+	return m
+}
+
+// advance moves pos past the codepoint that starts at it, and returns the
+// codepoint.
+func (m *OffsetMapper) advance(pos *Position) rune {
+	r, size := utf8.DecodeRune(m.text[pos.Offset:])
+	units := 1
+	if r >= 0x10000 {
+		units = 2
+	}
+	pos.Offset += size
+	pos.Rune++
+	pos.UTF16 += units
+	pos.Column++
+	pos.UTF16Column += units
+	if r == '\n' {
+		pos.Line++
+		pos.Column, pos.UTF16Column = 0, 0
+	}
+	return r
+}
+
+// Position returns the position of the byte offset in the haystack. An
+// offset inside a codepoint is treated as the start of that codepoint.
+//
+// It panics if offset is not in the range [0, len(haystack)].
+func (m *OffsetMapper) Position(offset int) Position {
+	if offset < 0 || offset > len(m.text) {
+		panic(fmt.Sprintf("rure: offset %d out of range [0, %d]",
+			offset, len(m.text)))
+	}
+	i := offset / offsetBlock
+	if m.checkpoints[i].Offset > offset {
+		// The checkpoint was pushed past offset by a codepoint that spans a
+		// multiple of offsetBlock.
+		i--
+	}
+	pos := m.checkpoints[i]
+	for pos.Offset < offset {
+		_, size := utf8.DecodeRune(m.text[pos.Offset:])
+		if pos.Offset+size > offset {
+			break
+		}
+		m.advance(&pos)
+	}
+	return pos
+}
+
+// Span returns the positions of the start and end byte offsets of a range of
+// the haystack.
+func (m *OffsetMapper) Span(start, end int) Span {
+	return Span{Start: m.Position(start), End: m.Position(end)}
+}
+
+// Lines returns the number of lines in the haystack, which is one more than
+// the number of new lines in it.
+func (m *OffsetMapper) Lines() int {
+	return len(m.lines)
+}
+
+// LineStart returns the position of the start of the given line, which counts
+// from 0.
+func (m *OffsetMapper) LineStart(line int) Position {
+	return m.lines[line]
+}
+
+// Find is like Regex.Find on the haystack, but returns the match as a Span.
+func (m *OffsetMapper) Find(re *Regex) (span Span, ok bool) {
+	start, end, ok := re.FindBytes(m.text)
+	if !ok {
+		return Span{}, false
+	}
+	return m.Span(start, end), true
+}
+
+// FindAll is like Regex.FindAll on the haystack, but returns each match as a
+// Span.
+func (m *OffsetMapper) FindAll(re *Regex) []Span {
+	matches := re.FindAllBytes(m.text)
+	if len(matches) == 0 {
+		return nil
+	}
+	spans := make([]Span, 0, len(matches)/2)
+	for i := 0; i < len(matches); i += 2 {
+		spans = append(spans, m.Span(matches[i], matches[i+1]))
+	}
+	return spans
+}
+
+// Group is like Captures.Group, but returns the group as a Span. The captures
+// must be from a search of the haystack.
+func (m *OffsetMapper) Group(caps *Captures, i int) (span Span, ok bool) {
+	start, end, ok := caps.Group(i)
+	if !ok {
+		return Span{}, false
+	}
+	return m.Span(start, end), true
+}
+
+// Match is like Iter.Match, but returns the match as a Span. The iterator
+// must be over the haystack.
+func (m *OffsetMapper) Match(it *Iter) Span {
+	return m.Span(it.Match())
+}
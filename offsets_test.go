@@ -0,0 +1,90 @@
+package rure
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOffsetMapper(t *testing.T) {
+	text := "aé\U0001F600\nx\xffy\n\n☃"
+	m := NewOffsetMapper(text)
+	require.Equal(t, 4, m.Lines())
+	require.Equal(t, Position{Offset: 8, Rune: 4, UTF16: 5, Line: 1},
+		m.LineStart(1))
+
+	require.Equal(t, Position{}, m.Position(0))
+	require.Equal(t, Position{
+		Offset: 3, Rune: 2, UTF16: 2, Column: 2, UTF16Column: 2,
+	}, m.Position(3))
+	// Offsets inside a codepoint are rounded down to its start.
+	require.Equal(t, m.Position(3), m.Position(5))
+	require.Equal(t, Position{
+		Offset: 7, Rune: 3, UTF16: 4, Column: 3, UTF16Column: 4,
+	}, m.Position(7))
+	require.Equal(t, Position{
+		Offset: 10, Rune: 6, UTF16: 7, Line: 1, Column: 2, UTF16Column: 2,
+	}, m.Position(10))
+	require.Equal(t, Position{
+		Offset: 16, Rune: 10, UTF16: 11, Line: 3, Column: 1, UTF16Column: 1,
+	}, m.Position(len(text)))
+	require.Panics(t, func() { m.Position(len(text) + 1) })
+	require.Panics(t, func() { m.Position(-1) })
+}
+
+func TestOffsetMapperLong(t *testing.T) {
+	// Compare every offset against a naive conversion, with codepoints that
+	// span the checkpoints.
+	text := strings.Repeat("abé\U0001F600\n☃", 50)
+	m := NewOffsetMapper(text)
+	for offset := 0; offset <= len(text); offset++ {
+		if !utf8.RuneStart(text[offset%len(text)]) && offset < len(text) {
+			continue
+		}
+		before := text[:offset]
+		line := strings.Count(before, "\n")
+		lineText := before[strings.LastIndex(before, "\n")+1:]
+		require.Equal(t, Position{
+			Offset:      offset,
+			Rune:        utf8.RuneCountInString(before),
+			UTF16:       len(utf16.Encode([]rune(before))),
+			Line:        line,
+			Column:      utf8.RuneCountInString(lineText),
+			UTF16Column: len(utf16.Encode([]rune(lineText))),
+		}, m.Position(offset), "offset %d", offset)
+	}
+}
+
+func TestOffsetMapperMatches(t *testing.T) {
+	text := "é1\n\U0001F600 22"
+	m := NewOffsetMapper(text)
+	re := MustCompile(`(\d)+`)
+
+	span, ok := m.Find(re)
+	require.True(t, ok)
+	require.Equal(t, 1, span.Start.Rune)
+	require.Equal(t, 2, span.End.UTF16)
+
+	spans := m.FindAll(re)
+	require.Len(t, spans, 2)
+	require.Equal(t, 1, spans[1].Start.Line)
+	require.Equal(t, 3, spans[1].Start.UTF16Column)
+	require.Equal(t, 2, spans[1].Start.Column)
+
+	caps := re.NewCaptures()
+	require.True(t, re.Captures(caps, text))
+	span, ok = m.Group(caps, 1)
+	require.True(t, ok)
+	require.Equal(t, 1, span.Start.Column)
+
+	it := re.Iter(text)
+	require.True(t, it.Next(nil))
+	require.Equal(t, 0, m.Match(it).Start.Line)
+
+	_, ok = m.Find(MustCompile(`z`))
+	require.False(t, ok)
+	require.Nil(t, m.FindAll(MustCompile(`z`)))
+}
@@ -0,0 +1,398 @@
+package rure
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode/utf8"
+)
+
+// DefaultRedactWindow is the window of a Redactor that hasn't been given one
+// with SetWindow.
+const DefaultRedactWindow = 4096
+
+// Redaction is a pattern to scrub from a stream and what to replace its
+// matches with.
+type Redaction struct {
+	// Pattern is the regular expression whose matches are redacted.
+	Pattern string
+	// Replacement is the template that each match is replaced with. Within
+	// it, $name or ${name} is replaced by the text of the capturing group
+	// called name, where name is either a group's name or its index, and $$
+	// is a literal $. Groups that don't exist or didn't participate in the
+	// match are replaced by the empty string. As with regexp.Expand, $name
+	// takes the longest name possible, so use ${1}x rather than $1x.
+	Replacement string
+	// Func, if not nil, is called with each match and returns its
+	// replacement, and Replacement is ignored. The match must not be
+	// retained or modified.
+	Func func(match []byte) []byte
+}
+
+// Redactor replaces the matches of a list of patterns in streams of text,
+// such as to scrub secrets from logs before they are shipped elsewhere.
+//
+// All patterns are compiled into a single alternation of capturing groups,
+// so that the text is searched once no matter how many patterns there are.
+// Like a leftmost-first alternation, when more than one pattern matches at
+// the same position, the pattern given first wins.
+//
+// Since a match may span more than one write to a stream, a Redactor holds
+// back the last window bytes of the stream until it has seen what follows
+// them. So matches longer than the window may be missed when they span
+// writes.
+//
+// It can be used safely from multiple goroutines simultaneously, but each
+// RedactWriter and RedactReader it returns cannot.
+type Redactor struct {
+	redactions []Redaction
+	re         *Regex
+	window     int
+	// groups is the index of the capturing group for each redaction in re,
+	// and names are the names of the groups in each redaction's pattern.
+	groups []int
+	names  [][]string
+}
+
+// NewRedactor compiles redactions into a Redactor. Flags and options have
+// the same meaning as in CompileOptions.
+//
+// An error is returned if any pattern fails to compile or matches the empty
+// string.
+func NewRedactor(
+	redactions []Redaction,
+	flags uint32,
+	options *Options,
+) (*Redactor, error) {
+	r := &Redactor{
+		redactions: append([]Redaction(nil), redactions...),
+		window:     DefaultRedactWindow,
+	}
+	pattern := ""
+	group := 1
+	for i, red := range redactions {
+		re, wrapped, err := groupPattern(red.Pattern, flags, options)
+		if err != nil {
+			return nil, fmt.Errorf("rure: redaction %d: %w", i, err)
+		}
+		if i > 0 {
+			pattern += "|"
+		}
+		pattern += wrapped
+		r.groups = append(r.groups, group)
+		r.names = append(r.names, re.CaptureNames())
+		group += len(re.CaptureNames())
+	}
+	if len(redactions) > 0 {
+		re, err := compileInternal(pattern, flags, options)
+		if err != nil {
+			return nil, err
+		}
+		r.re = re
+	}
+	return r, nil
+}
+
+// SetWindow sets the number of bytes at the end of a stream that are held
+// back until more of the stream is seen, which should be at least as long as
+// the longest match to redact. It must not be called once the Redactor is in
+// use.
+func (r *Redactor) SetWindow(n int) {
+	if n < 0 {
+		n = 0
+	}
+	r.window = n
+}
+
+// Redact returns text with every match replaced, and the number of matches
+// of each redaction.
+func (r *Redactor) Redact(text string) (string, []int) {
+	out, counts := r.RedactBytes(noCopyBytes(text))
+	return string(out), counts
+}
+
+// RedactBytes is like Redact, but for a []byte.
+func (r *Redactor) RedactBytes(text []byte) ([]byte, []int) {
+	st := r.newStream()
+	st.buf = text
+	return st.process(nil, true), st.counts
+}
+
+// Writer returns a RedactWriter that redacts everything written to it before
+// writing it to w.
+func (r *Redactor) Writer(w io.Writer) *RedactWriter {
+	return &RedactWriter{stream: r.newStream(), w: w}
+}
+
+// Reader returns a RedactReader that reads from src and redacts what it
+// reads.
+func (r *Redactor) Reader(src io.Reader) *RedactReader {
+	return &RedactReader{stream: r.newStream(), src: src}
+}
+
+func (r *Redactor) newStream() redactStream {
+	return redactStream{r: r, counts: make([]int, len(r.redactions))}
+}
+
+var errRedactWriterClosed = errors.New("rure: write to closed RedactWriter")
+
+// RedactWriter is an io.WriteCloser that redacts a stream before writing it
+// to another io.Writer.
+//
+// Up to the Redactor's window of bytes are held back after each write, so
+// Close must be called at the end of the stream to write them.
+type RedactWriter struct {
+	stream redactStream
+	w      io.Writer
+	out    []byte
+	err    error
+}
+
+// Write redacts p and writes as much of the stream as can be redacted so far.
+// Once writing to the underlying writer fails, every call returns the same
+// error.
+func (rw *RedactWriter) Write(p []byte) (int, error) {
+	if rw.err != nil {
+		return 0, rw.err
+	}
+	rw.stream.buf = append(rw.stream.buf, p...)
+	if err := rw.flush(false); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close redacts and writes the rest of the stream. It does not close the
+// underlying writer.
+func (rw *RedactWriter) Close() error {
+	if rw.err == errRedactWriterClosed {
+		return nil
+	}
+	if rw.err != nil {
+		return rw.err
+	}
+	if err := rw.flush(true); err != nil {
+		return err
+	}
+	rw.err = errRedactWriterClosed
+	return nil
+}
+
+func (rw *RedactWriter) flush(final bool) error {
+	rw.out = rw.stream.process(rw.out[:0], final)
+	if len(rw.out) == 0 {
+		return nil
+	}
+	if _, err := rw.w.Write(rw.out); err != nil {
+		rw.err = err
+		return err
+	}
+	return nil
+}
+
+// Counts returns the number of matches of each redaction so far.
+func (rw *RedactWriter) Counts() []int {
+	return append([]int(nil), rw.stream.counts...)
+}
+
+// RedactReader is an io.Reader that redacts the stream read from another
+// io.Reader.
+type RedactReader struct {
+	stream redactStream
+	src    io.Reader
+	// out is the redacted text that hasn't been read yet, and pending is the
+	// buffer it is a part of.
+	out     []byte
+	pending []byte
+	err     error
+}
+
+// Read reads redacted text into p. The error from the underlying reader,
+// including io.EOF, is returned once all of the text read before it has
+// been redacted and read.
+func (rr *RedactReader) Read(p []byte) (int, error) {
+	for len(rr.out) == 0 && rr.err == nil {
+		st := &rr.stream
+		if cap(st.buf)-len(st.buf) < 512 {
+			grown := make([]byte, len(st.buf), 2*cap(st.buf)+4096)
+			st.buf = grown[:copy(grown, st.buf)]
+		}
+		n, err := rr.src.Read(st.buf[len(st.buf):cap(st.buf)])
+		st.buf = st.buf[:len(st.buf)+n]
+		rr.pending = st.process(rr.pending[:0], err != nil)
+		rr.out = rr.pending
+		rr.err = err
+	}
+	n := copy(p, rr.out)
+	rr.out = rr.out[n:]
+	if len(rr.out) == 0 && rr.err != nil {
+		return n, rr.err
+	}
+	return n, nil
+}
+
+// Counts returns the number of matches of each redaction so far.
+func (rr *RedactReader) Counts() []int {
+	return append([]int(nil), rr.stream.counts...)
+}
+
+// redactStream is the state of redacting a stream that is shared by
+// RedactWriter and RedactReader.
+type redactStream struct {
+	r *Redactor
+	// buf is the part of the stream that hasn't been redacted yet, starting
+	// at done. The bytes before done have already been redacted, and are kept
+	// so that assertions like \b see the text before done.
+	buf    []byte
+	done   int
+	counts []int
+}
+
+// process appends the redacted text of as much of buf as can be redacted
+// to dst. If final is true, then buf is the end of the stream, and all of it
+// is redacted.
+func (st *redactStream) process(dst []byte, final bool) []byte {
+	r, buf := st.r, st.buf
+	pos, at := st.done, st.done
+	// stop is where the text that can't be redacted yet starts.
+	stop := len(buf)
+	for r.re != nil && at <= len(buf) {
+		locs := r.re.FindSubmatchIndexBytesAt(buf, at)
+		if locs == nil {
+			break
+		}
+		start, end := locs[0], locs[1]
+		// A match that starts in the window might turn out differently once
+		// more of the stream is seen, and so might a match that ends at the
+		// end of buf, where \b or $ might not match once more is seen.
+		if !final && (start > len(buf)-r.window || end == len(buf)) {
+			stop = start
+			break
+		}
+		if start == end {
+			// NewRedactor rejects patterns that match the empty string, but one can
+			// still match it depending on the text around it. Nothing is
+			// redacted then.
+			_, size := utf8.DecodeRune(buf[end:])
+			at = end + size
+			if size == 0 {
+				break
+			}
+			continue
+		}
+		rule := 0
+		for i, group := range r.groups {
+			if locs[2*group] >= 0 {
+				rule = i
+				break
+			}
+		}
+		dst = append(dst, buf[pos:start]...)
+		dst = r.replace(dst, buf, locs, rule)
+		st.counts[rule]++
+		pos, at = end, end
+	}
+	if !final && stop > len(buf)-r.window {
+		stop = len(buf) - r.window
+	}
+	if stop < pos {
+		stop = pos
+	}
+	dst = append(dst, buf[pos:stop]...)
+	st.done = stop
+
+	// Keep a codepoint of context before done for assertions. At the end of
+	// the stream, buf may be the caller's, so it is left alone.
+	if keep := st.done - utf8.UTFMax; keep > 0 && !final {
+		st.buf = append(st.buf[:0], st.buf[keep:]...)
+		st.done -= keep
+	}
+	return dst
+}
+
+// replace appends the replacement for the match of the given redaction in
+// text to dst.
+func (r *Redactor) replace(dst, text []byte, locs []int, rule int) []byte {
+	red := r.redactions[rule]
+	base, names := r.groups[rule], r.names[rule]
+	locs = locs[2*base : 2*(base+len(names))]
+	if red.Func != nil {
+		return append(dst, red.Func(text[locs[0]:locs[1]])...)
+	}
+
+	template := red.Replacement
+	for len(template) > 0 {
+		i := 0
+		for i < len(template) && template[i] != '$' {
+			i++
+		}
+		dst = append(dst, template[:i]...)
+		template = template[i:]
+		if len(template) == 0 {
+			break
+		}
+		name, rest, ok := templateName(template)
+		if !ok {
+			// Not a reference, so the $ is literal.
+			dst = append(dst, '$')
+			template = template[1:]
+			continue
+		}
+		template = rest
+		if name == "$" {
+			dst = append(dst, '$')
+			continue
+		}
+		group := -1
+		if n, err := strconv.Atoi(name); err == nil {
+			group = n
+		} else {
+			for j, groupName := range names {
+				if groupName == name {
+					group = j
+					break
+				}
+			}
+		}
+		if group >= 0 && group < len(names) && locs[2*group] >= 0 {
+			dst = append(dst, text[locs[2*group]:locs[2*group+1]]...)
+		}
+	}
+	return dst
+}
+
+// templateName parses the reference at the start of template, which starts
+// with a $, and returns its name and the rest of the template after it.
+func templateName(template string) (name, rest string, ok bool) {
+	if len(template) < 2 {
+		return "", "", false
+	}
+	if template[1] == '$' {
+		return "$", template[2:], true
+	}
+	if template[1] == '{' {
+		for i := 2; i < len(template); i++ {
+			if template[i] == '}' {
+				if i == 2 {
+					return "", "", false
+				}
+				return template[2:i], template[i+1:], true
+			}
+		}
+		return "", "", false
+	}
+	i := 1
+	for i < len(template) && isNameByte(template[i]) {
+		i++
+	}
+	if i == 1 {
+		return "", "", false
+	}
+	return template[1:i], template[i:], true
+}
+
+func isNameByte(b byte) bool {
+	return b == '_' || '0' <= b && b <= '9' || 'a' <= b && b <= 'z' ||
+		'A' <= b && b <= 'Z'
+}
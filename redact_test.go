@@ -0,0 +1,124 @@
+package rure
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testRedactor(t *testing.T) *Redactor {
+	r, err := NewRedactor([]Redaction{
+		{Pattern: `(?P<user>[a-z]+)@[a-z]+\.com`, Replacement: "$user@…"},
+		{Pattern: `\d{3}-\d{2}-(\d{4})`, Replacement: "***-**-${1}"},
+		{Pattern: `(?i)token=\w+`, Func: func(match []byte) []byte {
+			return bytes.ToUpper(match[:6])
+		}},
+	}, FlagDefault, nil)
+	require.NoError(t, err)
+	return r
+}
+
+const (
+	redactInput = "mail bob@example.com ssn 123-45-6789 Token=abc123 " +
+		"cost $5 and $$"
+	redactOutput = "mail bob@… ssn ***-**-6789 TOKEN= cost $5 and $$"
+)
+
+func TestRedact(t *testing.T) {
+	r := testRedactor(t)
+	out, counts := r.Redact(redactInput)
+	require.Equal(t, redactOutput, out)
+	require.Equal(t, []int{1, 1, 1}, counts)
+
+	out, counts = r.Redact("nothing to see")
+	require.Equal(t, "nothing to see", out)
+	require.Equal(t, []int{0, 0, 0}, counts)
+}
+
+func TestRedactTemplate(t *testing.T) {
+	r, err := NewRedactor([]Redaction{
+		{Pattern: `(?P<k>\w+)=(\w+)`, Replacement: "[$k|$2|$$|$9|${k}x|$kx|$]"},
+	}, FlagDefault, nil)
+	require.NoError(t, err)
+	out, _ := r.Redact("a=b")
+	require.Equal(t, "[a|b|$||ax||$]", out)
+
+	// Redactions may use the same group names.
+	r, err = NewRedactor([]Redaction{
+		{Pattern: `user=(?P<v>\w+)`, Replacement: "user=<$v>"},
+		{Pattern: `id=(?P<v>\d+)`, Replacement: "id=#$v"},
+	}, FlagDefault, nil)
+	require.NoError(t, err)
+	out, _ = r.Redact("user=bob id=7")
+	require.Equal(t, "user=<bob> id=#7", out)
+}
+
+func TestRedactWriter(t *testing.T) {
+	r := testRedactor(t)
+	r.SetWindow(16)
+	for size := 1; size <= len(redactInput); size++ {
+		var buf bytes.Buffer
+		w := r.Writer(&buf)
+		for i := 0; i < len(redactInput); i += size {
+			end := i + size
+			if end > len(redactInput) {
+				end = len(redactInput)
+			}
+			n, err := w.Write([]byte(redactInput[i:end]))
+			require.NoError(t, err)
+			require.Equal(t, end-i, n)
+		}
+		require.NoError(t, w.Close())
+		require.Equal(t, redactOutput, buf.String(), "write size %d", size)
+		require.Equal(t, []int{1, 1, 1}, w.Counts())
+
+		require.NoError(t, w.Close())
+		_, err := w.Write([]byte("x"))
+		require.Error(t, err)
+	}
+}
+
+func TestRedactReader(t *testing.T) {
+	r := testRedactor(t)
+	r.SetWindow(16)
+	rd := r.Reader(iotest.OneByteReader(strings.NewReader(redactInput)))
+	out, err := ioutil.ReadAll(iotest.HalfReader(rd))
+	require.NoError(t, err)
+	require.Equal(t, redactOutput, string(out))
+	require.Equal(t, []int{1, 1, 1}, rd.Counts())
+}
+
+func TestRedactAssertions(t *testing.T) {
+	// A match at the end of a write must wait for what follows it, and the
+	// text before a write is still seen by \b.
+	r, err := NewRedactor([]Redaction{
+		{Pattern: `(?-u:\b)key(?-u:\b)`, Replacement: "K"},
+	}, FlagDefault, nil)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	w := r.Writer(&buf)
+	for _, s := range []string{"key", "s monkey", " key", " key"} {
+		_, err := w.Write([]byte(s))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	require.Equal(t, "keys monkey K K", buf.String())
+	require.Equal(t, []int{2}, w.Counts())
+}
+
+func TestRedactErrors(t *testing.T) {
+	_, err := NewRedactor([]Redaction{{Pattern: `a*`}}, FlagDefault, nil)
+	require.Error(t, err)
+	_, err = NewRedactor([]Redaction{{Pattern: `(`}}, FlagDefault, nil)
+	require.Error(t, err)
+
+	r, err := NewRedactor(nil, FlagDefault, nil)
+	require.NoError(t, err)
+	out, counts := r.Redact("abc")
+	require.Equal(t, "abc", out)
+	require.Empty(t, counts)
+}
@@ -0,0 +1,127 @@
+package rure
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+// Flags for modifying regex behavior. All flags can be modified in the
+// expression itself using standard syntax. e.g., `(?i)` enables case
+// insensitivity and `(?-i)` disables it.
+const (
+	// FlagCaseI is the case insensitive (i) flag.
+	FlagCaseI = 1 << 0
+	// FlagMulti is the multi-line matching (m) flag.
+	// (^ and $ match new line boundaries.)
+	FlagMulti = 1 << 1
+	// FlagDotNL is the any character (s) flag. (. matches new line.)
+	FlagDotNL = 1 << 2
+	// FlagSwapGreed is the greedy swap (U) flag.
+	// (e.g., + is ungreedy and +? is greedy.)
+	FlagSwapGreed = 1 << 3
+	// FlagSpace is the ignore whitespace (x) flag.
+	FlagSpace = 1 << 4
+	// FlagUnicode is the Unicode (u) flag.
+	FlagUnicode = 1 << 5
+	// FlagDefault is used when calling MustCompile or Compile.
+	FlagDefault = FlagUnicode
+)
+
+// MustCompile is like Compile, but if there was a problem compiling the
+// pattern, then it will panic.
+func MustCompile(pattern string) *Regex {
+	re, err := Compile(pattern)
+	if err != nil {
+		panic(fmt.Sprintf("regex.MustCompile failed on %s: %s", pattern, err))
+	}
+	return re
+}
+
+// Compile is like CompileOptions, but uses default flags (Unicode enabled)
+// and default size limits.
+//
+// If there was a problem compiling the pattern, then no Regex is returned and
+// a non-nil error is returned.
+func Compile(pattern string) (*Regex, error) {
+	return CompileOptions(pattern, FlagDefault, nil)
+}
+
+func (re *Regex) String() string {
+	return re.pattern
+}
+
+// FindSubmatch returns the text of the leftmost-first match of re in text,
+// followed by the text of each capturing group. Groups that did not
+// participate in the match are empty. If there is no match, then nil is
+// returned.
+//
+// Like FindSubmatchIndex, it may be called from multiple goroutines
+// simultaneously.
+func (re *Regex) FindSubmatch(text string) []string {
+	locs := re.FindSubmatchIndex(text)
+	if locs == nil {
+		return nil
+	}
+	groups := make([]string, len(locs)/2)
+	for i := range groups {
+		if locs[2*i] >= 0 {
+			groups[i] = text[locs[2*i]:locs[2*i+1]]
+		}
+	}
+	return groups
+}
+
+// FindSubmatchBytes is like FindSubmatch, but for a []byte haystack. Each
+// group is a slice of text, and groups that did not participate in the match
+// are nil.
+func (re *Regex) FindSubmatchBytes(text []byte) [][]byte {
+	locs := re.FindSubmatchIndexBytes(text)
+	if locs == nil {
+		return nil
+	}
+	groups := make([][]byte, len(locs)/2)
+	for i := range groups {
+		if locs[2*i] >= 0 {
+			groups[i] = text[locs[2*i]:locs[2*i+1]:locs[2*i+1]]
+		}
+	}
+	return groups
+}
+
+// MustCompileSet is like CompileSet, but if there was a problem compiling
+// any of the patterns, then it will panic.
+func MustCompileSet(patterns []string) *RegexSet {
+	set, err := CompileSet(patterns)
+	if err != nil {
+		panic(fmt.Sprintf("regex.MustCompileSet failed on %q: %s",
+			patterns, err))
+	}
+	return set
+}
+
+// CompileSet is like CompileSetOptions, but uses default flags (Unicode
+// enabled) and default size limits.
+func CompileSet(patterns []string) (*RegexSet, error) {
+	return CompileSetOptions(patterns, FlagDefault, nil)
+}
+
+// Patterns returns the patterns the set was compiled with, in the order they
+// were given.
+func (set *RegexSet) Patterns() []string {
+	return append([]string(nil), set.patterns...)
+}
+
+// Converts a string to a []byte without allocating.
+//
+// This is very dangerous and must be handled with care. In particular, the
+// input given must be kept alive for the duration of the return value.
+func noCopyBytes(s string) []byte {
+	sh := (*reflect.StringHeader)(unsafe.Pointer(&s))
+	bh := reflect.SliceHeader{
+		Data: sh.Data,
+		Len:  sh.Len,
+		Cap:  sh.Len,
+	}
+	return *(*[]byte)(unsafe.Pointer(&bh))
+}
@@ -0,0 +1,169 @@
+package rure
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Rule is a named pattern given to a Router.
+type Rule struct {
+	// Name identifies the rule in the routes reported by a Router. Names
+	// need not be unique.
+	Name string
+	// Pattern is the regular expression that the rule matches.
+	Pattern string
+	// Priority decides which rule wins when more than one rule matches. The
+	// rule with the highest priority wins, and ties are won by the rule
+	// given first.
+	Priority int
+}
+
+// Route is a rule that matched a haystack given to a Router.
+type Route struct {
+	// Name is the name of the rule that matched.
+	Name string
+	// Rule is the index of the rule that matched, in the order the rules were
+	// given to NewRouter.
+	Rule int
+	// Start is the start offset of the leftmost-first match of the rule.
+	Start int
+	// End is the end offset of the leftmost-first match of the rule.
+	End int
+	// Captures maps the name of each named capturing group in the rule's
+	// pattern that participated in the match to the text it matched.
+	Captures map[string]string
+}
+
+// Router matches a haystack against an ordered list of rules, such as the
+// routes of an HTTP server or the topics of a message bus.
+//
+// All rules are compiled into a single RegexSet, so that finding which rules
+// match takes a single search. Only the rules that win are then searched
+// again, with an individually compiled Regex, to find their captures.
+//
+// It can be used safely from multiple goroutines simultaneously.
+type Router struct {
+	rules  []Rule
+	finder *SetFinder
+	// order is the index of every rule, from highest priority to lowest.
+	order []int
+	names []lazyNames
+}
+
+type lazyNames struct {
+	once  sync.Once
+	names []string
+}
+
+// NewRouter compiles rules into a Router. Flags and options have the same
+// meaning as in CompileSetOptions, and options must not be modified after
+// calling NewRouter.
+//
+// If there was a problem compiling any of the patterns, then an error that
+// names the offending rule is returned.
+func NewRouter(rules []Rule, flags uint32, options *Options) (*Router, error) {
+	patterns := make([]string, len(rules))
+	for i, rule := range rules {
+		patterns[i] = rule.Pattern
+	}
+	finder, err := NewSetFinder(patterns, flags, options)
+	if err != nil {
+		for _, rule := range rules {
+			if _, err := CompileOptions(rule.Pattern, flags, options); err != nil {
+				return nil, fmt.Errorf("rure: rule %q: %w", rule.Name, err)
+			}
+		}
+		return nil, err
+	}
+	r := &Router{
+		rules:  append([]Rule(nil), rules...),
+		finder: finder,
+		order:  make([]int, len(rules)),
+		names:  make([]lazyNames, len(rules)),
+	}
+	for i := range r.order {
+		r.order[i] = i
+	}
+	sort.SliceStable(r.order, func(i, j int) bool {
+		return r.rules[r.order[i]].Priority > r.rules[r.order[j]].Priority
+	})
+	return r, nil
+}
+
+// Rules returns the rules the router was compiled with.
+func (r *Router) Rules() []Rule {
+	return append([]Rule(nil), r.rules...)
+}
+
+// Route returns the winning rule that matches text. If no rule matches, then
+// ok is false.
+func (r *Router) Route(text string) (route Route, ok bool) {
+	return r.RouteBytes(noCopyBytes(text))
+}
+
+// RouteBytes returns the winning rule that matches text. If no rule matches,
+// then ok is false.
+func (r *Router) RouteBytes(text []byte) (route Route, ok bool) {
+	matches := r.finder.Set().MatchesBytes(text)
+	for _, i := range r.order {
+		if matches[i] {
+			return r.route(i, text)
+		}
+	}
+	return Route{}, false
+}
+
+// RouteAll returns every rule that matches text, from the winner to the
+// lowest priority rule.
+//
+// If no rule matches, then nil is returned.
+func (r *Router) RouteAll(text string) []Route {
+	return r.RouteAllBytes(noCopyBytes(text))
+}
+
+// RouteAllBytes returns every rule that matches text, from the winner to the
+// lowest priority rule.
+//
+// If no rule matches, then nil is returned.
+func (r *Router) RouteAllBytes(text []byte) []Route {
+	var routes []Route
+	matches := r.finder.Set().MatchesBytes(text)
+	for _, i := range r.order {
+		if !matches[i] {
+			continue
+		}
+		if route, ok := r.route(i, text); ok {
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+func (r *Router) route(i int, text []byte) (Route, bool) {
+	locs := r.finder.Regex(i).FindSubmatchIndexBytes(text)
+	if locs == nil {
+		return Route{}, false
+	}
+	route := Route{
+		Name:     r.rules[i].Name,
+		Rule:     i,
+		Start:    locs[0],
+		End:      locs[1],
+		Captures: map[string]string{},
+	}
+	for group, name := range r.captureNames(i) {
+		if name != "" && locs[2*group] >= 0 {
+			route.Captures[name] = string(text[locs[2*group]:locs[2*group+1]])
+		}
+	}
+	return route, true
+}
+
+func (r *Router) captureNames(i int) []string {
+	lazy := &r.names[i]
+	lazy.once.Do(func() {
+		lazy.names = r.finder.Regex(i).CaptureNames()
+	})
+	return lazy.names
+}
@@ -0,0 +1,82 @@
+package rure
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouter(t *testing.T) {
+	r, err := NewRouter([]Rule{
+		{Name: "user", Pattern: `^/users/(?P<id>\d+)$`},
+		{Name: "post", Pattern: `^/users/(?P<user>\d+)/posts/(?P<post>\d+)$`},
+		{Name: "any-user", Pattern: `^/users/(?P<rest>.*)`},
+		{Name: "static", Pattern: `^/static/`, Priority: 1},
+		{Name: "catch-all", Pattern: `^/(?P<path>.*)$`, Priority: -1},
+	}, FlagDefault, nil)
+	require.NoError(t, err)
+	require.Len(t, r.Rules(), 5)
+
+	route, ok := r.Route("/users/42")
+	require.True(t, ok)
+	require.Equal(t, Route{
+		Name:     "user",
+		Rule:     0,
+		Start:    0,
+		End:      9,
+		Captures: map[string]string{"id": "42"},
+	}, route)
+
+	route, ok = r.RouteBytes([]byte("/users/42/posts/7"))
+	require.True(t, ok)
+	require.Equal(t, "post", route.Name)
+	require.Equal(t,
+		map[string]string{"user": "42", "post": "7"}, route.Captures)
+
+	route, ok = r.Route("/users/me")
+	require.True(t, ok)
+	require.Equal(t, "any-user", route.Name)
+
+	route, ok = r.Route("/static/users/1")
+	require.True(t, ok)
+	require.Equal(t, "static", route.Name)
+	require.Equal(t, map[string]string{}, route.Captures)
+
+	route, ok = r.Route("/about")
+	require.True(t, ok)
+	require.Equal(t, "catch-all", route.Name)
+	require.Equal(t, map[string]string{"path": "about"}, route.Captures)
+
+	_, ok = r.Route("about")
+	require.False(t, ok)
+}
+
+func TestRouterAll(t *testing.T) {
+	r, err := NewRouter([]Rule{
+		{Name: "a", Pattern: `(?P<x>a)|(?P<y>b)`},
+		{Name: "b", Pattern: `b`, Priority: 2},
+		{Name: "c", Pattern: `c`},
+	}, FlagDefault, nil)
+	require.NoError(t, err)
+
+	routes := r.RouteAll("xb")
+	require.Len(t, routes, 2)
+	require.Equal(t, "b", routes[0].Name)
+	require.Equal(t, "a", routes[1].Name)
+	require.Equal(t, 1, routes[1].Start)
+	require.Equal(t, map[string]string{"y": "b"}, routes[1].Captures)
+
+	require.Nil(t, r.RouteAllBytes([]byte("xyz")))
+}
+
+func TestRouterError(t *testing.T) {
+	_, err := NewRouter([]Rule{
+		{Name: "ok", Pattern: `a`},
+		{Name: "bad", Pattern: `(`},
+	}, FlagDefault, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `rule "bad"`)
+	var compileErr *Error
+	require.True(t, errors.As(err, &compileErr))
+}
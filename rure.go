@@ -1,3 +1,6 @@
+//go:build cgo && !purego
+// +build cgo,!purego
+
 package rure
 
 // #cgo LDFLAGS: -lrure
@@ -42,43 +45,179 @@ package rure
 //     }
 //     *num_matches = len;
 // }
+//
+// /*
+//  * rure_iter_count exhausts the given iterator over the given haystack, and
+//  * returns the number of successive non-overlapping matches, which are the
+//  * same matches reported by rure_iter_collect. It stops early once limit
+//  * matches are found.
+//  */
+// size_t rure_iter_count(rure_iter *it,
+//                        const uint8_t *haystack, size_t length,
+//                        size_t limit)
+// {
+//     rure_match m = {0};
+//     size_t count = 0;
+//     while (count < limit && rure_iter_next(it, haystack, length, &m)) {
+//         count++;
+//     }
+//     return count;
+// }
+//
+// /*
+//  * rure_find_collect is like rure_iter_collect, except it starts searching
+//  * at the offset start and stops once it finds a match that begins at or
+//  * after the offset end. The match that stops the search is not reported.
+//  *
+//  * Empty matches are handled the same way as rure_iter_next: an empty match
+//  * that immediately follows the previous match is skipped. Since the search
+//  * begins at start, there is no previous match when the search begins.
+//  */
+// void rure_find_collect(rure *re,
+//                        const uint8_t *haystack, size_t length,
+//                        size_t start, size_t end,
+//                        size_t **matches, size_t *num_matches)
+// {
+//     rure_match m = {0};
+//     size_t len = 0;
+//     size_t cap = 64;
+//     size_t last_end = start;
+//     size_t last_match = 0;
+//     bool have_last = false;
+//     *matches = malloc(cap * sizeof(size_t));
+//     if (NULL == *matches) {
+//         fprintf(stderr, "rure_find_collect: out of memory, aborting\n");
+//         abort();
+//     }
+//     while (last_end <= length
+//            && rure_find(re, haystack, length, last_end, &m)
+//            && m.start < end) {
+//         if (m.start == m.end) {
+//             last_end = m.end + 1;
+//             if (have_last && m.end == last_match) {
+//                 continue;
+//             }
+//         } else {
+//             last_end = m.end;
+//         }
+//         have_last = true;
+//         last_match = m.end;
+//         if ((len * 2 + 1) >= cap) {
+//             cap *= 2;
+//             *matches = realloc(*matches, cap * sizeof(size_t));
+//             if (NULL == *matches) {
+//                 fprintf(
+//                     stderr, "rure_find_collect: out of memory, aborting\n");
+//                 abort();
+//             }
+//         }
+//         (*matches)[len * 2 + 0] = m.start;
+//         (*matches)[len * 2 + 1] = m.end;
+//         len++;
+//     }
+//     *num_matches = len;
+// }
+//
+// /*
+//  * rure_is_match_many runs rure_is_match on each of count haystacks packed
+//  * contiguously into haystacks. The haystack i is the range of bytes from
+//  * offsets[i] to offsets[i+1], so offsets must have count + 1 entries.
+//  *
+//  * matches[i] is set to the result for haystack i.
+//  */
+// void rure_is_match_many(rure *re,
+//                         const uint8_t *haystacks, const size_t *offsets,
+//                         size_t count, bool *matches)
+// {
+//     for (size_t i = 0; i < count; i++) {
+//         matches[i] = rure_is_match(
+//             re, haystacks + offsets[i], offsets[i + 1] - offsets[i], 0);
+//     }
+// }
+//
+// /*
+//  * rure_find_many is like rure_is_match_many, except it runs rure_find on
+//  * each haystack. found[i] is set to whether haystack i matched, and if it
+//  * did, matches[i] is set to the location of the match.
+//  */
+// void rure_find_many(rure *re,
+//                     const uint8_t *haystacks, const size_t *offsets,
+//                     size_t count, bool *found, rure_match *matches)
+// {
+//     for (size_t i = 0; i < count; i++) {
+//         found[i] = rure_find(
+//             re, haystacks + offsets[i], offsets[i + 1] - offsets[i], 0,
+//             &matches[i]);
+//     }
+// }
+//
+// /*
+//  * rure_find_captures_locs is like rure_find_captures, except that if a
+//  * match is found, then the location of every capture group in caps is also
+//  * written to locs, which must have room for 2 * rure_captures_len(caps)
+//  * offsets. The offsets of a group that did not participate in the match
+//  * are set to -1.
+//  */
+// bool rure_find_captures_locs(rure *re,
+//                              const uint8_t *haystack, size_t length,
+//                              size_t start,
+//                              rure_captures *caps, int64_t *locs)
+// {
+//     rure_match m = {0};
+//     if (!rure_find_captures(re, haystack, length, start, caps)) {
+//         return false;
+//     }
+//     for (size_t i = 0; i < rure_captures_len(caps); i++) {
+//         if (rure_captures_at(caps, i, &m)) {
+//             locs[i * 2 + 0] = (int64_t)m.start;
+//             locs[i * 2 + 1] = (int64_t)m.end;
+//         } else {
+//             locs[i * 2 + 0] = -1;
+//             locs[i * 2 + 1] = -1;
+//         }
+//     }
+//     return true;
+// }
 import "C"
 
 import (
-	"fmt"
+	"bytes"
 	"reflect"
 	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
-// Flags for modifying regex behavior. All flags can be modified in the
-// expression itself using standard syntax. e.g., `(?i)` enables case
-// insensitivity and `(?-i)` disables it.
-const (
-	// FlagCaseI is the case insensitive (i) flag.
-	FlagCaseI = C.RURE_FLAG_CASEI
-	// FlagMulti is the multi-line matching (m) flag.
-	// (^ and $ match new line boundaries.)
-	FlagMulti = C.RURE_FLAG_MULTI
-	// FlagDotNL is the any character (s) flag. (. matches new line.)
-	FlagDotNL = C.RURE_FLAG_DOTNL
-	// FlagSwapGreed is the greedy swap (U) flag.
-	// (e.g., + is ungreedy and +? is greedy.)
-	FlagSwapGreed = C.RURE_FLAG_SWAP_GREED
-	// FlagSpace is the ignore whitespace (x) flag.
-	FlagSpace = C.RURE_FLAG_SPACE
-	// FlagUnicode is the Unicode (u) flag.
-	FlagUnicode = C.RURE_FLAG_UNICODE
-	// FlagDefault is used when calling MustCompile or Compile.
-	FlagDefault = FlagUnicode
-)
-
 // Regex is a compiled regular expression.
 //
 // It can be used safely from multiple goroutines simultaneously.
 type Regex struct {
-	pattern string
-	p       *C.rure
+	pattern  string
+	flags    uint32
+	observer Observer
+	*compiled
+}
+
+// compiled owns a regular expression compiled by the C library. It is kept
+// apart from Regex so that its memory can be freed by a finalizer even when a
+// Regex is compiled in place, e.g., as a field of a struct being decoded by
+// UnmarshalText.
+type compiled struct {
+	p *C.rure
+	// caps is a pool of *Captures for p, used by methods that don't take a
+	// Captures from the caller.
+	caps sync.Pool
+	// options and anchored are used to compile anchored variants of p.
+	options  *Options
+	anchored anchoredRegexes
+	// decoders caches a *decoder for each struct type given to Unmarshal.
+	decoders sync.Map
+	// size is the compiled size of p, measured once by CompiledSize, and
+	// accessed atomically since it is read by the finalizer.
+	sizeOnce sync.Once
+	size     int64
 }
 
 // Options represents non-flag compile time options.
@@ -92,7 +231,9 @@ type Options struct {
 // Captures represents start and end locations for every matching capture group
 // in a regular expression match.
 //
-// It is not safe to use from multiple goroutines simultaneously.
+// It is not safe to use from multiple goroutines simultaneously. Use
+// FindSubmatchIndex or FindSubmatch to extract capture groups from multiple
+// goroutines without managing a Captures per goroutine.
 type Captures struct {
 	re *Regex
 	p  *C.rure_captures
@@ -117,25 +258,6 @@ type Error struct {
 	p *C.rure_error
 }
 
-// MustCompile is like Compile, but if there was a problem compiling the
-// pattern, then it will panic.
-func MustCompile(pattern string) *Regex {
-	re, err := Compile(pattern)
-	if err != nil {
-		panic(fmt.Sprintf("regex.MustCompile failed on %s: %s", pattern, err))
-	}
-	return re
-}
-
-// Compile is like CompileOptions, but uses default flags (Unicode enabled)
-// and default size limits.
-//
-// If there was a problem compiling the pattern, then no Regex is returned and
-// a non-nil error is returned.
-func Compile(pattern string) (*Regex, error) {
-	return CompileOptions(pattern, FlagDefault, nil)
-}
-
 // CompileOptions compiles a pattern (in UTF-8) to a regular expression
 // suitable for searching text.
 //
@@ -156,11 +278,29 @@ func CompileOptions(
 	flags uint32,
 	options *Options,
 ) (*Regex, error) {
-	re := &Regex{pattern: pattern}
-	runtime.SetFinalizer(re, func(re *Regex) {
-		if re.p != nil {
-			C.rure_free(re.p)
-			re.p = nil
+	re := &Regex{}
+	if err := re.compile(pattern, flags, options, false); err != nil {
+		return nil, err
+	}
+	return re, nil
+}
+
+// compile compiles pattern into re, replacing anything re previously held.
+// If there was a problem, then re is left unchanged. internal is reported to
+// observers as CompileEvent.Internal.
+func (re *Regex) compile(
+	pattern string,
+	flags uint32,
+	options *Options,
+	internal bool,
+) error {
+	start := startCompile()
+	c := &compiled{options: options}
+	runtime.SetFinalizer(c, func(c *compiled) {
+		if c.p != nil {
+			C.rure_free(c.p)
+			c.p = nil
+			trackMem(&memStats.Regexes, -1, -atomic.LoadInt64(&c.size))
 		}
 	})
 
@@ -169,21 +309,84 @@ func CompileOptions(
 		optp = options.p
 	}
 	err := newError()
-	re.p = C.rure_compile(
+	c.p = C.rure_compile(
 		asUint8Ptr(noCopyBytes(pattern)),
 		C.size_t(len(pattern)),
 		C.uint(flags),
 		optp,
 		err.p,
 	)
-	if re.p == nil {
-		return nil, err
+	event := CompileEvent{Pattern: pattern, Flags: flags, Internal: internal}
+	if c.p == nil {
+		event.Err = err
+		endCompile(start, event)
+		return err
 	}
-	return re, nil
+	if !start.IsZero() {
+		event.Duration = time.Since(start)
+	}
+	trackMem(&memStats.Regexes, 1, 0)
+	re.pattern, re.flags, re.compiled = pattern, flags, c
+	if !internal && atomic.LoadInt32(&memAccounting) == 1 {
+		event.Size = re.CompiledSize()
+	}
+	endCompile(start, event)
+	return nil
+}
+
+// isCompiled returns true if re was compiled, as opposed to being the zero
+// value of Regex.
+func (re *Regex) isCompiled() bool {
+	return re.compiled != nil
+}
+
+// CompiledSize returns the approximate number of bytes used by the compiled
+// program of re in the C library, which isn't included in the Go runtime's
+// memory statistics. It does not include the caches used while searching.
+//
+// The C library has no way to report the size directly, so the first call
+// measures it by compiling the pattern again with smaller and smaller size
+// limits (see Options.SetSizeLimit) until it no longer fits, which takes
+// about a dozen compiles. The result is accurate to within about 6%, and is
+// cached, and included in MemStats.Bytes from then on. Patterns that the C
+// library searches without a compiled program, such as plain literals, have
+// a size of 0, as does the zero value of Regex.
+func (re *Regex) CompiledSize() int {
+	c := re.compiled
+	if c == nil {
+		return 0
+	}
+	c.sizeOnce.Do(func() {
+		size := measureSize(func(limit int) bool {
+			return compilesWithin(re.pattern, re.flags, limit)
+		})
+		atomic.StoreInt64(&c.size, size)
+		atomic.AddInt64(&memStats.Bytes, size)
+	})
+	return int(atomic.LoadInt64(&c.size))
 }
 
-func (re *Regex) String() string {
-	return re.pattern
+// compilesWithin returns true if pattern compiles within the given size
+// limit.
+func compilesWithin(pattern string, flags uint32, limit int) bool {
+	options := C.rure_options_new()
+	defer C.rure_options_free(options)
+	C.rure_options_size_limit(options, C.size_t(limit))
+
+	err := C.rure_error_new()
+	defer C.rure_error_free(err)
+	p := C.rure_compile(
+		asUint8Ptr(noCopyBytes(pattern)),
+		C.size_t(len(pattern)),
+		C.uint(flags),
+		options,
+		err,
+	)
+	if p == nil {
+		return false
+	}
+	C.rure_free(p)
+	return true
 }
 
 // IsMatch returns true if text matches re.
@@ -203,8 +406,11 @@ func (re *Regex) IsMatchAt(text string, i int) bool {
 
 // IsMatchBytesAt returns true if text matches re starting at index i.
 func (re *Regex) IsMatchBytesAt(text []byte, i int) bool {
-	return bool(C.rure_is_match(
+	start := re.startSearch()
+	ok := bool(C.rure_is_match(
 		re.p, asUint8Ptr(text), C.size_t(len(text)), C.size_t(i)))
+	re.endSearch(start, "IsMatch", len(text), ok)
+	return ok
 }
 
 // ShortestMatch returns the end location of a match in text if it exists. This
@@ -228,10 +434,12 @@ func (re *Regex) ShortestMatch(text string) (end int, ok bool) {
 // For example, matching `a+` against `aaaaa` will return `1` (while `Find`
 // will report `5` as the end).
 func (re *Regex) ShortestMatchBytes(text []byte) (end int, ok bool) {
+	start := re.startSearch()
 	var cend C.size_t
 	ok = bool(C.rure_shortest_match(
 		re.p, asUint8Ptr(text), C.size_t(len(text)), 0, &cend))
 	end = int(cend)
+	re.endSearch(start, "ShortestMatch", len(text), ok)
 	return
 }
 
@@ -248,12 +456,14 @@ func (re *Regex) Find(text string) (start, end int, ok bool) {
 //
 // If no match exists, false is returned.
 func (re *Regex) FindBytes(text []byte) (start, end int, ok bool) {
+	began := re.startSearch()
 	match := C.rure_match{}
 	ok = bool(C.rure_find(
 		re.p, asUint8Ptr(text), C.size_t(len(text)), 0, &match))
 	if ok {
 		start, end = int(match.start), int(match.end)
 	}
+	re.endSearch(began, "Find", len(text), ok)
 	return
 }
 
@@ -278,6 +488,7 @@ func (re *Regex) FindAll(text string) []int {
 // This may be faster than using Iter since the slice of matches is built in
 // C code.
 func (re *Regex) FindAllBytes(text []byte) []int {
+	start := re.startSearch()
 	it := C.rure_iter_new(re.p)
 	defer C.rure_iter_free(it)
 
@@ -292,11 +503,229 @@ func (re *Regex) FindAllBytes(text []byte) []int {
 	}()
 
 	C.rure_iter_collect(it, haystack, len, &matches, &nmatches)
+	re.endSearch(start, "FindAll", int(len), nmatches > 0)
+	return copyMatches(matches, nmatches)
+}
+
+// Count returns the number of successive non-overlapping matches of re in
+// text, which are the matches that FindAll would return.
+//
+// This is faster than FindAll when only the number of matches is needed,
+// since the matches are counted in C code without recording their offsets.
+func (re *Regex) Count(text string) int {
+	return re.CountBytes(noCopyBytes(text))
+}
+
+// CountBytes is like Count, but for a []byte haystack.
+func (re *Regex) CountBytes(text []byte) int {
+	return re.count(text, ^C.size_t(0))
+}
+
+// CountLimit is like Count, but stops searching once limit matches are
+// found, so it returns at most limit. This is useful for checking whether a
+// pattern occurs at least some number of times.
+func (re *Regex) CountLimit(text string, limit int) int {
+	return re.CountLimitBytes(noCopyBytes(text), limit)
+}
+
+// CountLimitBytes is like CountLimit, but for a []byte haystack.
+func (re *Regex) CountLimitBytes(text []byte, limit int) int {
+	if limit <= 0 {
+		return 0
+	}
+	return re.count(text, C.size_t(limit))
+}
+
+func (re *Regex) count(text []byte, limit C.size_t) int {
+	start := re.startSearch()
+	it := C.rure_iter_new(re.p)
+	defer C.rure_iter_free(it)
+
+	count := int(C.rure_iter_count(
+		it, asUint8Ptr(text), C.size_t(len(text)), limit))
+	re.endSearch(start, "Count", len(text), count > 0)
+	return count
+}
+
+// minParallelChunk is the smallest chunk of a haystack that FindAllParallel
+// will hand to a single worker. Below this, the cost of starting goroutines
+// and crossing into C dominates the search itself.
+const minParallelChunk = 64 * 1024
+
+// FindAllParallel is like FindAllBytes, but splits text into chunks and
+// searches them on up to workers goroutines simultaneously. If workers is
+// less than 1, then runtime.GOMAXPROCS(0) workers are used.
+//
+// The slice returned is always identical to the one returned by FindAllBytes.
+// Chunks are split just after a new line when one is nearby, since most
+// patterns don't match across lines. Otherwise, or when a match does cross a
+// chunk boundary, the results of neighboring chunks are stitched together by
+// searching sequentially from the end of the crossing match until the
+// results agree again.
+//
+// Small haystacks are searched on the calling goroutine.
+func (re *Regex) FindAllParallel(text []byte, workers int) []int {
+	start := re.startSearch()
+	matches := re.findAllParallel(text, workers)
+	re.endSearch(start, "FindAllParallel", len(text), matches != nil)
+	return matches
+}
+
+func (re *Regex) findAllParallel(text []byte, workers int) []int {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if n := len(text) / minParallelChunk; n < workers {
+		workers = n
+	}
+	if workers <= 1 {
+		return re.findAllRange(text, 0, len(text)+1)
+	}
+
+	bounds := parallelBounds(text, workers)
+	chunks := make([][]int, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			chunks[i] = re.findAllRange(
+				text, bounds[i], rangeEnd(text, bounds, i))
+		}(i)
+	}
+	wg.Wait()
+	return re.stitch(text, bounds, chunks)
+}
+
+// parallelBounds returns workers+1 offsets splitting text into workers
+// chunks of roughly equal size. Each interior boundary is moved forward to
+// just after the next new line, if that new line is in the same chunk.
+func parallelBounds(text []byte, workers int) []int {
+	bounds := make([]int, workers+1)
+	size := len(text) / workers
+	for i := 1; i < workers; i++ {
+		at := i * size
+		if nl := bytes.IndexByte(text[at:at+size], '\n'); nl >= 0 {
+			at += nl + 1
+		}
+		bounds[i] = at
+	}
+	bounds[workers] = len(text)
+	return bounds
+}
+
+// findAllRange returns all successive non-overlapping matches of re in text
+// that start in the range [start, end), as if iteration began at start.
+//
+// The full text is given to the regex engine, so matches may extend past end
+// and assertions like \b see the bytes on either side of the range.
+func (re *Regex) findAllRange(text []byte, start, end int) []int {
+	nmatches := C.size_t(0)
+	matches := (*C.size_t)(nil)
+	defer func() {
+		if matches != nil {
+			C.free(unsafe.Pointer(matches))
+		}
+	}()
+
+	C.rure_find_collect(
+		re.p, asUint8Ptr(text), C.size_t(len(text)),
+		C.size_t(start), C.size_t(end),
+		&matches, &nmatches)
+	return copyMatches(matches, nmatches)
+}
+
+// stitch merges the matches found in each chunk into the sequence that a
+// single sequential scan over text would produce. bounds are the offsets
+// used to split text into chunks.
+//
+// A chunk's matches are correct so long as the previous match ends before
+// the chunk begins, since the sequential scan would then begin searching the
+// chunk with the same state as the search that produced the chunk's matches.
+// When the previous match crosses into the chunk, matches are instead found
+// sequentially until a match is found that the chunk also reports. From that
+// point on, both searches are in the same state and the rest of the chunk's
+// matches can be reused.
+func (re *Regex) stitch(text []byte, bounds []int, chunks [][]int) []int {
+	var all []int
+	lastEnd, lastMatch := 0, -1
+	for i, chunk := range chunks {
+		if lastMatch >= bounds[i] {
+			for {
+				start, end, ok := re.findNext(text, &lastEnd, &lastMatch)
+				if !ok {
+					return all
+				}
+				for len(chunk) > 0 && chunk[0] < start {
+					chunk = chunk[2:]
+				}
+				if len(chunk) > 0 && chunk[0] == start && chunk[1] == end {
+					break
+				}
+				all = append(all, start, end)
+				if start >= rangeEnd(text, bounds, i) {
+					break
+				}
+			}
+		}
+		if len(chunk) > 0 {
+			all = append(all, chunk...)
+			start, end := chunk[len(chunk)-2], chunk[len(chunk)-1]
+			lastEnd, lastMatch = end, end
+			if start == end {
+				lastEnd++
+			}
+		}
+	}
+	return all
+}
+
+// rangeEnd returns the exclusive upper bound on the start offsets of matches
+// in the chunk i. The last chunk includes an empty match at the end of text.
+func rangeEnd(text []byte, bounds []int, i int) int {
+	if i == len(bounds)-2 {
+		return len(text) + 1
+	}
+	return bounds[i+1]
+}
+
+// findNext finds the next match of re in text using the same rules for
+// empty matches as Iter. lastEnd and lastMatch are updated in place, where
+// lastMatch is -1 if there is no previous match.
+func (re *Regex) findNext(
+	text []byte,
+	lastEnd, lastMatch *int,
+) (start, end int, ok bool) {
+	for *lastEnd <= len(text) {
+		match := C.rure_match{}
+		if !bool(C.rure_find(
+			re.p, asUint8Ptr(text), C.size_t(len(text)),
+			C.size_t(*lastEnd), &match)) {
+			break
+		}
+		start, end = int(match.start), int(match.end)
+		if start == end {
+			*lastEnd = end + 1
+			if end == *lastMatch {
+				continue
+			}
+		} else {
+			*lastEnd = end
+		}
+		*lastMatch = end
+		return start, end, true
+	}
+	*lastEnd = len(text) + 1
+	return 0, 0, false
+}
+
+// copyMatches copies nmatches pairs of start and end offsets from C memory
+// to Go memory.
+func copyMatches(matches *C.size_t, nmatches C.size_t) []int {
 	if nmatches == 0 {
 		return nil
 	}
 
-	// Copy the matches from C memory to Go memory.
 	matchesInts := make([]int, 2*nmatches)
 	p := uintptr(unsafe.Pointer(matches))
 	stride := unsafe.Sizeof(C.size_t(0))
@@ -310,6 +739,131 @@ func (re *Regex) FindAllBytes(text []byte) []int {
 	return matchesInts
 }
 
+// IsMatchMany returns, for each string in texts, whether it matches re.
+//
+// All of texts are searched with a single call into C, which makes this
+// much faster than calling IsMatch in a loop when texts are short.
+func (re *Regex) IsMatchMany(texts []string) []bool {
+	haystacks, offsets := packStrings(texts)
+	return re.isMatchMany(haystacks, offsets)
+}
+
+// IsMatchManyBytes returns, for each byte slice in texts, whether it matches
+// re.
+//
+// All of texts are searched with a single call into C, which makes this
+// much faster than calling IsMatchBytes in a loop when texts are short.
+func (re *Regex) IsMatchManyBytes(texts [][]byte) []bool {
+	haystacks, offsets := packBytes(texts)
+	return re.isMatchMany(haystacks, offsets)
+}
+
+func (re *Regex) isMatchMany(haystacks []byte, offsets []C.size_t) []bool {
+	count := len(offsets) - 1
+	if count == 0 {
+		return nil
+	}
+	start := re.startSearch()
+	matches := make([]C.bool, count)
+	C.rure_is_match_many(
+		re.p, asUint8Ptr(haystacks), &offsets[0], C.size_t(count),
+		&matches[0])
+
+	results := make([]bool, count)
+	matched := false
+	for i, ok := range matches {
+		results[i] = bool(ok)
+		matched = matched || results[i]
+	}
+	re.endSearch(start, "IsMatchMany", len(haystacks), matched)
+	return results
+}
+
+// FindMany returns the start and end location of the leftmost-first match
+// in each string in texts.
+//
+// The slice returned contains a pair of start and end offsets for each
+// string in texts. The start and end offset for texts[i] is indexed by i*2
+// and i*2+1, respectively. If texts[i] has no match, then both offsets are
+// -1.
+//
+// All of texts are searched with a single call into C, which makes this
+// much faster than calling Find in a loop when texts are short.
+func (re *Regex) FindMany(texts []string) []int {
+	haystacks, offsets := packStrings(texts)
+	return re.findMany(haystacks, offsets)
+}
+
+// FindManyBytes returns the start and end location of the leftmost-first
+// match in each byte slice in texts.
+//
+// The slice returned contains a pair of start and end offsets for each byte
+// slice in texts. The start and end offset for texts[i] is indexed by i*2
+// and i*2+1, respectively. If texts[i] has no match, then both offsets are
+// -1.
+//
+// All of texts are searched with a single call into C, which makes this
+// much faster than calling FindBytes in a loop when texts are short.
+func (re *Regex) FindManyBytes(texts [][]byte) []int {
+	haystacks, offsets := packBytes(texts)
+	return re.findMany(haystacks, offsets)
+}
+
+func (re *Regex) findMany(haystacks []byte, offsets []C.size_t) []int {
+	count := len(offsets) - 1
+	if count == 0 {
+		return nil
+	}
+	start := re.startSearch()
+	found := make([]C.bool, count)
+	matches := make([]C.rure_match, count)
+	C.rure_find_many(
+		re.p, asUint8Ptr(haystacks), &offsets[0], C.size_t(count),
+		&found[0], &matches[0])
+
+	results := make([]int, 2*count)
+	matched := false
+	for i, ok := range found {
+		if ok {
+			results[2*i] = int(matches[i].start)
+			results[2*i+1] = int(matches[i].end)
+			matched = true
+		} else {
+			results[2*i], results[2*i+1] = -1, -1
+		}
+	}
+	re.endSearch(start, "FindMany", len(haystacks), matched)
+	return results
+}
+
+// packStrings is like packBytes, but for strings.
+func packStrings(texts []string) (haystacks []byte, offsets []C.size_t) {
+	views := make([][]byte, len(texts))
+	for i, text := range texts {
+		views[i] = noCopyBytes(text)
+	}
+	return packBytes(views)
+}
+
+// packBytes copies texts into a single contiguous buffer. The text i
+// occupies the range of bytes from offsets[i] to offsets[i+1].
+//
+// This permits passing many haystacks to C at once, which is otherwise
+// forbidden since a slice of byte slices contains Go pointers.
+func packBytes(texts [][]byte) (haystacks []byte, offsets []C.size_t) {
+	total := 0
+	for _, text := range texts {
+		total += len(text)
+	}
+	haystacks = make([]byte, 0, total)
+	offsets = make([]C.size_t, 1, len(texts)+1)
+	for _, text := range texts {
+		haystacks = append(haystacks, text...)
+		offsets = append(offsets, C.size_t(len(haystacks)))
+	}
+	return
+}
+
 // NewCaptures allocates room for storing the start and end offset of each
 // capturing group in re.
 //
@@ -321,10 +875,13 @@ func (re *Regex) NewCaptures() *Captures {
 	caps := &Captures{re: re, p: C.rure_captures_new(re.p)}
 	runtime.SetFinalizer(caps, func(caps *Captures) {
 		if caps.p != nil {
+			bytes := captureBytes(caps.Len())
 			C.rure_captures_free(caps.p)
 			caps.p = nil
+			trackMem(&memStats.Captures, -1, -bytes)
 		}
 	})
+	trackMem(&memStats.Captures, 1, captureBytes(caps.Len()))
 	return caps
 }
 
@@ -349,11 +906,66 @@ func (re *Regex) Captures(caps *Captures, text string) bool {
 //
 // caps must not be nil.
 func (re *Regex) CapturesBytes(caps *Captures, text []byte) bool {
+	start := re.startSearch()
 	caps.ok = bool(C.rure_find_captures(
 		re.p, asUint8Ptr(text), C.size_t(len(text)), 0, caps.p))
+	re.endSearch(start, "Captures", len(text), caps.ok)
 	return caps.ok
 }
 
+// FindSubmatchIndex returns the start and end locations of the leftmost-first
+// match of re in text, followed by the start and end locations of each
+// capturing group. Groups that did not participate in the match have
+// locations of -1. If there is no match, then nil is returned.
+//
+// Unlike Captures, it may be called from multiple goroutines simultaneously,
+// since the Captures it needs are drawn from a pool owned by re.
+func (re *Regex) FindSubmatchIndex(text string) []int {
+	return re.FindSubmatchIndexBytes(noCopyBytes(text))
+}
+
+// FindSubmatchIndexBytes is like FindSubmatchIndex, but for a []byte
+// haystack.
+func (re *Regex) FindSubmatchIndexBytes(text []byte) []int {
+	return re.FindSubmatchIndexBytesAt(text, 0)
+}
+
+// FindSubmatchIndexAt is like FindSubmatchIndex, but starts searching text
+// at index i. Like IsMatchAt, assertions such as ^ and \b see the text
+// before i, and locations are relative to the start of text.
+func (re *Regex) FindSubmatchIndexAt(text string, i int) []int {
+	return re.FindSubmatchIndexBytesAt(noCopyBytes(text), i)
+}
+
+// FindSubmatchIndexBytesAt is like FindSubmatchIndexBytes, but starts
+// searching text at index i.
+func (re *Regex) FindSubmatchIndexBytesAt(text []byte, i int) []int {
+	if i > len(text) {
+		return nil
+	}
+	c := re.compiled
+	caps, _ := c.caps.Get().(*Captures)
+	if caps == nil {
+		caps = re.NewCaptures()
+	}
+	defer c.caps.Put(caps)
+
+	start := re.startSearch()
+	locs := make([]C.int64_t, 2*caps.Len())
+	ok := bool(C.rure_find_captures_locs(
+		c.p, asUint8Ptr(text), C.size_t(len(text)), C.size_t(i),
+		caps.p, &locs[0]))
+	re.endSearch(start, "FindSubmatchIndex", len(text), ok)
+	if !ok {
+		return nil
+	}
+	result := make([]int, len(locs))
+	for i := range locs {
+		result[i] = int(locs[i])
+	}
+	return result
+}
+
 // Iter returns an iterator over successive non-overlapping matches of re
 // in text.
 //
@@ -401,8 +1013,10 @@ func NewOptions() *Options {
 		if opts.p != nil {
 			C.rure_options_free(opts.p)
 			opts.p = nil
+			trackMem(&memStats.Options, -1, 0)
 		}
 	})
+	trackMem(&memStats.Options, 1, 0)
 	return opts
 }
 
@@ -466,6 +1080,12 @@ func (caps *Captures) Len() int {
 	return int(C.rure_captures_len(caps.p))
 }
 
+// captureBytes estimates the bytes used by a Captures with n groups, which
+// holds a start and end offset for each group.
+func captureBytes(n int) int64 {
+	return int64(n) * 2 * int64(unsafe.Sizeof(C.size_t(0)))
+}
+
 func newIter(re *Regex, haystack []byte) *Iter {
 	it := &Iter{
 		re:       re,
@@ -475,8 +1095,10 @@ func newIter(re *Regex, haystack []byte) *Iter {
 	runtime.SetFinalizer(it, func(it *Iter) {
 		if it.p != nil {
 			C.rure_iter_free(it.p)
+			trackMem(&memStats.Iters, -1, 0)
 		}
 	})
+	trackMem(&memStats.Iters, 1, 0)
 	return it
 }
 
@@ -489,15 +1111,20 @@ func newIter(re *Regex, haystack []byte) *Iter {
 // nil, then the start and end offsets of each matching capturing group are
 // stored in caps.
 func (it *Iter) Next(caps *Captures) bool {
+	start := it.re.startSearch()
 	haystack := asUint8Ptr(it.haystack)
 	len := C.size_t(len(it.haystack))
 
+	var ok bool
 	if caps == nil {
-		return bool(C.rure_iter_next(it.p, haystack, len, &it.match))
+		ok = bool(C.rure_iter_next(it.p, haystack, len, &it.match))
+	} else {
+		caps.ok = bool(C.rure_iter_next_captures(it.p, haystack, len, caps.p))
+		C.rure_captures_at(caps.p, 0, &it.match)
+		ok = caps.ok
 	}
-	caps.ok = bool(C.rure_iter_next_captures(it.p, haystack, len, caps.p))
-	C.rure_captures_at(caps.p, 0, &it.match)
-	return caps.ok
+	it.re.endSearch(start, "Iter", int(len), ok)
+	return ok
 }
 
 // Match returns the start and end offsets of the current match in the
@@ -506,6 +1133,18 @@ func (it *Iter) Match() (start, end int) {
 	return int(it.match.start), int(it.match.end)
 }
 
+func _() {
+	// An "invalid array index" compiler error signifies that the flag
+	// constants in regex.go no longer agree with rure.h.
+	var x [1]struct{}
+	_ = x[FlagCaseI-C.RURE_FLAG_CASEI]
+	_ = x[FlagMulti-C.RURE_FLAG_MULTI]
+	_ = x[FlagDotNL-C.RURE_FLAG_DOTNL]
+	_ = x[FlagSwapGreed-C.RURE_FLAG_SWAP_GREED]
+	_ = x[FlagSpace-C.RURE_FLAG_SPACE]
+	_ = x[FlagUnicode-C.RURE_FLAG_UNICODE]
+}
+
 func newError() *Error {
 	err := &Error{C.rure_error_new()}
 	runtime.SetFinalizer(err, func(err *Error) {
@@ -521,20 +1160,6 @@ func (err *Error) Error() string {
 	return C.GoString(C.rure_error_message(err.p))
 }
 
-// Converts a string to a []byte without allocating.
-//
-// This is very dangerous and must be handled with care. In particular, the
-// input given must be kept alive for the duration of the return value.
-func noCopyBytes(s string) []byte {
-	sh := (*reflect.StringHeader)(unsafe.Pointer(&s))
-	bh := reflect.SliceHeader{
-		Data: sh.Data,
-		Len:  sh.Len,
-		Cap:  sh.Len,
-	}
-	return *(*[]byte)(unsafe.Pointer(&bh))
-}
-
 // Converts a byte slice to a *C.uint8_t.
 //
 // This works even for empty slices.
@@ -542,3 +1167,8 @@ func asUint8Ptr(bs []byte) *C.uint8_t {
 	bh := (*reflect.SliceHeader)(unsafe.Pointer(&bs))
 	return (*C.uint8_t)(unsafe.Pointer(bh.Data))
 }
+
+// anchorAtInvalidPrefix is the prefix of a pattern used by FindAnchoredAt and
+// IsFullMatchAt to match a byte of invalid UTF-8 before where the match
+// starts.
+const anchorAtInvalidPrefix = `\A(?s-u:.)(?:`
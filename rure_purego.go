@@ -0,0 +1,631 @@
+//go:build !cgo || purego
+// +build !cgo purego
+
+package rure
+
+import (
+	"regexp"
+	"sync"
+	"unicode/utf8"
+)
+
+// This file is a fallback implementation of this package's API backed by
+// Go's regexp package. It is used when cgo is disabled or when building with
+// the purego tag, which permits building without Rust's regex library.
+//
+// Patterns are translated from Rust's syntax to Go's syntax. Patterns using
+// syntax that Go does not support, or that Go supports with a different
+// meaning, fail to compile. See the package documentation for details.
+
+// Regex is a compiled regular expression.
+//
+// It can be used safely from multiple goroutines simultaneously.
+type Regex struct {
+	pattern  string
+	flags    uint32
+	observer Observer
+	re       *regexp.Regexp
+
+	atOnce sync.Once
+	at     *regexp.Regexp
+
+	options  *Options
+	anchored anchoredRegexes
+	decoders sync.Map
+}
+
+// Options represents non-flag compile time options.
+//
+// The pure Go fallback has no size limits, so options are accepted but
+// ignored.
+type Options struct {
+	sizeLimit    int
+	dfaSizeLimit int
+}
+
+// Captures represents start and end locations for every matching capture group
+// in a regular expression match.
+//
+// It is not safe to use from multiple goroutines simultaneously. Use
+// FindSubmatchIndex or FindSubmatch to extract capture groups from multiple
+// goroutines without managing a Captures per goroutine.
+type Captures struct {
+	re   *Regex
+	locs []int
+	ok   bool
+}
+
+// Iter is an iterator over successive non-overlapping matches in a haystack.
+//
+// It is not safe to use from multiple goroutines simultaneously.
+type Iter struct {
+	re        *Regex
+	haystack  []byte
+	lastEnd   int
+	lastMatch int
+	match     [2]int
+}
+
+// Error is an error that caused compilation of a regular expression to fail.
+//
+// Most errors are syntax errors, but an error is also returned if the pattern
+// uses syntax that the pure Go fallback does not support.
+type Error struct {
+	msg string
+}
+
+// CompileOptions compiles a pattern (in UTF-8) to a regular expression
+// suitable for searching text.
+//
+// Flags is a bitfield of the Flag constants in this package. A value of `0`
+// disables all flags.
+//
+// Options is a set non-flag configuration settings for the compiled regular
+// expression. It is ignored by the pure Go fallback.
+//
+// If there was a problem compiling the pattern (including if it is not valid
+// UTF-8 or uses syntax not supported by the pure Go fallback), then an error
+// is returned.
+func CompileOptions(
+	pattern string,
+	flags uint32,
+	options *Options,
+) (*Regex, error) {
+	re := &Regex{}
+	if err := re.compile(pattern, flags, options, false); err != nil {
+		return nil, err
+	}
+	return re, nil
+}
+
+// compile compiles pattern into re, replacing anything re previously held.
+// If there was a problem, then re is left unchanged. internal is reported to
+// observers as CompileEvent.Internal.
+func (re *Regex) compile(
+	pattern string,
+	flags uint32,
+	options *Options,
+	internal bool,
+) error {
+	start := startCompile()
+	event := CompileEvent{Pattern: pattern, Flags: flags, Internal: internal}
+	translated, err := translate(pattern, flags)
+	if err != nil {
+		event.Err = err
+		endCompile(start, event)
+		return err
+	}
+	compiled, err := regexp.Compile(translated)
+	if err != nil {
+		err = &Error{msg: err.Error()}
+		event.Err = err
+		endCompile(start, event)
+		return err
+	}
+	endCompile(start, event)
+	re.pattern, re.flags, re.re = pattern, flags, compiled
+	re.atOnce, re.at = sync.Once{}, nil
+	re.options, re.anchored = options, anchoredRegexes{}
+	re.decoders = sync.Map{}
+	return nil
+}
+
+// isCompiled returns true if re was compiled, as opposed to being the zero
+// value of Regex.
+func (re *Regex) isCompiled() bool {
+	return re.re != nil
+}
+
+// CompiledSize returns the approximate number of bytes used by the compiled
+// program of re in the C library. The pure Go fallback doesn't use the C
+// library, so it always returns 0.
+func (re *Regex) CompiledSize() int {
+	return 0
+}
+
+// IsMatch returns true if text matches re.
+func (re *Regex) IsMatch(text string) bool {
+	return re.IsMatchBytesAt(noCopyBytes(text), 0)
+}
+
+// IsMatchBytes returns true if text matches re.
+func (re *Regex) IsMatchBytes(text []byte) bool {
+	return re.IsMatchBytesAt(text, 0)
+}
+
+// IsMatchAt returns true if text matches re starting at index i.
+func (re *Regex) IsMatchAt(text string, i int) bool {
+	return re.IsMatchBytesAt(noCopyBytes(text), i)
+}
+
+// IsMatchBytesAt returns true if text matches re starting at index i.
+func (re *Regex) IsMatchBytesAt(text []byte, i int) bool {
+	start := re.startSearch()
+	ok := re.isMatchAt(text, i)
+	re.endSearch(start, "IsMatch", len(text), ok)
+	return ok
+}
+
+// isMatchAt is IsMatchBytesAt without notifying observers.
+func (re *Regex) isMatchAt(text []byte, i int) bool {
+	if i == 0 {
+		return re.re.Match(text)
+	}
+	return re.findAt(text, i) != nil
+}
+
+// ShortestMatch returns the end location of a match in text if it exists.
+//
+// The pure Go fallback always returns the end of the leftmost-first match.
+func (re *Regex) ShortestMatch(text string) (end int, ok bool) {
+	return re.ShortestMatchBytes(noCopyBytes(text))
+}
+
+// ShortestMatchBytes returns the end location of a match in text if it exists.
+//
+// The pure Go fallback always returns the end of the leftmost-first match.
+func (re *Regex) ShortestMatchBytes(text []byte) (end int, ok bool) {
+	start := re.startSearch()
+	if loc := re.re.FindIndex(text); loc != nil {
+		end, ok = loc[1], true
+	}
+	re.endSearch(start, "ShortestMatch", len(text), ok)
+	return
+}
+
+// Find returns the start and end location of the leftmost-first match in text
+// if it exists.
+//
+// If no match exists, false is returned.
+func (re *Regex) Find(text string) (start, end int, ok bool) {
+	return re.FindBytes(noCopyBytes(text))
+}
+
+// FindBytes returns the start and end location of the leftmost-first match in
+// text if it exists.
+//
+// If no match exists, false is returned.
+func (re *Regex) FindBytes(text []byte) (start, end int, ok bool) {
+	began := re.startSearch()
+	loc := re.re.FindIndex(text)
+	re.endSearch(began, "Find", len(text), loc != nil)
+	if loc == nil {
+		return
+	}
+	return loc[0], loc[1], true
+}
+
+// FindAll returns all successive non-overlapping matches of re in text.
+//
+// The slice returned contains a pair of start and end offsets for each match
+// found. The start and end offset for match i is indexed by i*2 and i*2+1,
+// respectively.
+func (re *Regex) FindAll(text string) []int {
+	return re.FindAllBytes(noCopyBytes(text))
+}
+
+// FindAllBytes returns all successive non-overlapping matches of re in text.
+//
+// The slice returned contains a pair of start and end offsets for each match
+// found. The start and end offset for match i is indexed by i*2 and i*2+1,
+// respectively.
+func (re *Regex) FindAllBytes(text []byte) []int {
+	start := re.startSearch()
+	matches := re.findAll(text)
+	re.endSearch(start, "FindAll", len(text), matches != nil)
+	return matches
+}
+
+// findAll is FindAllBytes without notifying observers.
+func (re *Regex) findAll(text []byte) []int {
+	locs := re.re.FindAllIndex(text, -1)
+	if locs == nil {
+		return nil
+	}
+	matches := make([]int, 0, 2*len(locs))
+	for _, loc := range locs {
+		matches = append(matches, loc[0], loc[1])
+	}
+	return matches
+}
+
+// Count returns the number of successive non-overlapping matches of re in
+// text, which are the matches that FindAll would return.
+func (re *Regex) Count(text string) int {
+	return re.CountBytes(noCopyBytes(text))
+}
+
+// CountBytes is like Count, but for a []byte haystack.
+func (re *Regex) CountBytes(text []byte) int {
+	return re.count(text, -1)
+}
+
+// CountLimit is like Count, but stops searching once limit matches are
+// found, so it returns at most limit.
+func (re *Regex) CountLimit(text string, limit int) int {
+	return re.CountLimitBytes(noCopyBytes(text), limit)
+}
+
+// CountLimitBytes is like CountLimit, but for a []byte haystack.
+func (re *Regex) CountLimitBytes(text []byte, limit int) int {
+	if limit <= 0 {
+		return 0
+	}
+	return re.count(text, limit)
+}
+
+func (re *Regex) count(text []byte, limit int) int {
+	start := re.startSearch()
+	count := len(re.re.FindAllIndex(text, limit))
+	re.endSearch(start, "Count", len(text), count > 0)
+	return count
+}
+
+// FindAllParallel is like FindAllBytes. The pure Go fallback always searches
+// text on the calling goroutine.
+func (re *Regex) FindAllParallel(text []byte, workers int) []int {
+	start := re.startSearch()
+	matches := re.findAll(text)
+	re.endSearch(start, "FindAllParallel", len(text), matches != nil)
+	return matches
+}
+
+// IsMatchMany returns, for each string in texts, whether it matches re.
+func (re *Regex) IsMatchMany(texts []string) []bool {
+	if len(texts) == 0 {
+		return nil
+	}
+	start := re.startSearch()
+	results := make([]bool, len(texts))
+	total, matched := 0, false
+	for i, text := range texts {
+		results[i] = re.re.MatchString(text)
+		total += len(text)
+		matched = matched || results[i]
+	}
+	re.endSearch(start, "IsMatchMany", total, matched)
+	return results
+}
+
+// IsMatchManyBytes returns, for each byte slice in texts, whether it matches
+// re.
+func (re *Regex) IsMatchManyBytes(texts [][]byte) []bool {
+	if len(texts) == 0 {
+		return nil
+	}
+	start := re.startSearch()
+	results := make([]bool, len(texts))
+	total, matched := 0, false
+	for i, text := range texts {
+		results[i] = re.re.Match(text)
+		total += len(text)
+		matched = matched || results[i]
+	}
+	re.endSearch(start, "IsMatchMany", total, matched)
+	return results
+}
+
+// FindMany returns the start and end location of the leftmost-first match
+// in each string in texts. See FindManyBytes for the layout of the slice
+// returned.
+func (re *Regex) FindMany(texts []string) []int {
+	if len(texts) == 0 {
+		return nil
+	}
+	start := re.startSearch()
+	results := make([]int, 0, 2*len(texts))
+	total, matched := 0, false
+	for _, text := range texts {
+		loc := re.re.FindStringIndex(text)
+		results = appendFind(results, loc)
+		total += len(text)
+		matched = matched || loc != nil
+	}
+	re.endSearch(start, "FindMany", total, matched)
+	return results
+}
+
+// FindManyBytes returns the start and end location of the leftmost-first
+// match in each byte slice in texts.
+//
+// The slice returned contains a pair of start and end offsets for each byte
+// slice in texts. The start and end offset for texts[i] is indexed by i*2
+// and i*2+1, respectively. If texts[i] has no match, then both offsets are
+// -1.
+func (re *Regex) FindManyBytes(texts [][]byte) []int {
+	if len(texts) == 0 {
+		return nil
+	}
+	start := re.startSearch()
+	results := make([]int, 0, 2*len(texts))
+	total, matched := 0, false
+	for _, text := range texts {
+		loc := re.re.FindIndex(text)
+		results = appendFind(results, loc)
+		total += len(text)
+		matched = matched || loc != nil
+	}
+	re.endSearch(start, "FindMany", total, matched)
+	return results
+}
+
+func appendFind(results []int, loc []int) []int {
+	if loc == nil {
+		return append(results, -1, -1)
+	}
+	return append(results, loc[0], loc[1])
+}
+
+// NewCaptures allocates room for storing the start and end offset of each
+// capturing group in re.
+//
+// Captures may be reused in subsequent calls. When it is reused, its internal
+// state is reset.
+//
+// Captures may not be used from multiple threads simultaneously.
+func (re *Regex) NewCaptures() *Captures {
+	return &Captures{re: re}
+}
+
+// Captures populates caps with the start and end locations of all matching
+// capturing groups in re for text.
+//
+// If no match is found, then false is returned.
+//
+// caps must not be nil.
+func (re *Regex) Captures(caps *Captures, text string) bool {
+	return re.CapturesBytes(caps, noCopyBytes(text))
+}
+
+// CapturesBytes populates caps with the start and end locations of all
+// matching capturing groups in re for text.
+//
+// If no match is found, then false is returned.
+//
+// caps must not be nil.
+func (re *Regex) CapturesBytes(caps *Captures, text []byte) bool {
+	start := re.startSearch()
+	caps.locs = re.re.FindSubmatchIndex(text)
+	caps.ok = caps.locs != nil
+	re.endSearch(start, "Captures", len(text), caps.ok)
+	return caps.ok
+}
+
+// FindSubmatchIndex returns the start and end locations of the leftmost-first
+// match of re in text, followed by the start and end locations of each
+// capturing group. Groups that did not participate in the match have
+// locations of -1. If there is no match, then nil is returned.
+//
+// Unlike Captures, it may be called from multiple goroutines simultaneously.
+func (re *Regex) FindSubmatchIndex(text string) []int {
+	return re.FindSubmatchIndexBytes(noCopyBytes(text))
+}
+
+// FindSubmatchIndexBytes is like FindSubmatchIndex, but for a []byte
+// haystack.
+func (re *Regex) FindSubmatchIndexBytes(text []byte) []int {
+	return re.FindSubmatchIndexBytesAt(text, 0)
+}
+
+// FindSubmatchIndexAt is like FindSubmatchIndex, but starts searching text
+// at index i. Like IsMatchAt, assertions such as ^ and \b see the text
+// before i, and locations are relative to the start of text.
+func (re *Regex) FindSubmatchIndexAt(text string, i int) []int {
+	return re.FindSubmatchIndexBytesAt(noCopyBytes(text), i)
+}
+
+// FindSubmatchIndexBytesAt is like FindSubmatchIndexBytes, but starts
+// searching text at index i.
+func (re *Regex) FindSubmatchIndexBytesAt(text []byte, i int) []int {
+	start := re.startSearch()
+	locs := re.findAt(text, i)
+	re.endSearch(start, "FindSubmatchIndex", len(text), locs != nil)
+	return locs
+}
+
+// Iter returns an iterator over successive non-overlapping matches of re
+// in text.
+//
+// Next must be called on the iterator before accessing match information.
+func (re *Regex) Iter(text string) *Iter {
+	return re.IterBytes(noCopyBytes(text))
+}
+
+// IterBytes returns an iterator over successive non-overlapping matches of re
+// in text.
+//
+// Next must be called on the iterator before accessing match information.
+func (re *Regex) IterBytes(text []byte) *Iter {
+	return &Iter{re: re, haystack: text, lastMatch: -1}
+}
+
+// CaptureNames returns a slice of the names of call capturing groups in this
+// regex. The slice has the same order as the order of the appearance of each
+// capturing group. Index 0 corresponds to the entire regex match, and is
+// therefore always unnamed. Unnamed capturing groups are always represented by
+// an empty string.
+func (re *Regex) CaptureNames() []string {
+	return append([]string(nil), re.re.SubexpNames()...)
+}
+
+// findAt returns the start and end locations of all capturing groups in the
+// leftmost-first match of re in text that begins at or after index i, in the
+// same format as regexp.Regexp.FindSubmatchIndex.
+//
+// Unlike searching text[i:], assertions like ^ and \b observe the byte before
+// i, and \A does not match at i when i > 0. This is done by searching from
+// i - 1 with a variant of re that first consumes exactly one codepoint.
+// Consequently, if i splits a codepoint, the search begins at the end of
+// that codepoint instead.
+func (re *Regex) findAt(text []byte, i int) []int {
+	if i <= 0 {
+		return re.re.FindSubmatchIndex(text)
+	}
+	if i > len(text) {
+		return nil
+	}
+	re.atOnce.Do(func() {
+		re.at = regexp.MustCompile(`\A(?s:.)(?s:.*?)(` + re.re.String() + `)`)
+	})
+	locs := re.at.FindSubmatchIndex(text[i-1:])
+	if locs == nil {
+		return nil
+	}
+	locs = locs[2:]
+	for j := range locs {
+		if locs[j] >= 0 {
+			locs[j] += i - 1
+		}
+	}
+	return locs
+}
+
+// NewOptions returns a fresh options value for configuring non-flag options
+// of a regex.
+//
+// The pure Go fallback ignores all options.
+func NewOptions() *Options {
+	return &Options{}
+}
+
+// SetSizeLimit sets the approximate size limit (in bytes) of the compiled
+// regular expression. It is ignored by the pure Go fallback.
+func (opts *Options) SetSizeLimit(limit int) {
+	opts.sizeLimit = limit
+}
+
+// SetDFASizeLimit sets the approximate size limit (in bytes) of the DFA's
+// cache size. It is ignored by the pure Go fallback.
+func (opts *Options) SetDFASizeLimit(limit int) {
+	opts.dfaSizeLimit = limit
+}
+
+// IsMatch returns true if caps corresponds to a match in a regular expression.
+func (caps *Captures) IsMatch() bool {
+	return caps.ok
+}
+
+// Group returns the start and end offsets for the capturing group indexed by
+// i. Capturing groups are indexed by the appearance of their opening
+// parenthesis in the pattern.
+//
+// If the capturing group was not part of the match, then this returns false.
+//
+// Note that capture group 0 always corresponds to the full match of the
+// regular expression and is always unnamed.
+func (caps *Captures) Group(i int) (start, end int, ok bool) {
+	if i < 0 || 2*i+1 >= len(caps.locs) || caps.locs[2*i] < 0 {
+		return
+	}
+	return caps.locs[2*i], caps.locs[2*i+1], true
+}
+
+// GroupName is like Group, but uses the name of a capturing group instead of
+// its index. Named capture groups look like (?P<foo>re) in the pattern.
+//
+// If no such named capture group exists or if it wasn't part of the match
+// of the regular expression, GroupName returns false.
+func (caps *Captures) GroupName(name string) (start, end int, ok bool) {
+	if name == "" {
+		return
+	}
+	for i, n := range caps.re.re.SubexpNames() {
+		if n == name {
+			return caps.Group(i)
+		}
+	}
+	return
+}
+
+// Len returns the number of capturing groups.
+//
+// Once caps is created, this never changes.
+func (caps *Captures) Len() int {
+	return caps.re.re.NumSubexp() + 1
+}
+
+// Next advances the iterator. If it finds a match, it returns true, and
+// otherwise returns false. Once it returns false, it will always return false.
+//
+// This must be called before a call to Match.
+//
+// If caps is nil, then capture information is not extracted. If caps is not
+// nil, then the start and end offsets of each matching capturing group are
+// stored in caps.
+//
+// Like Go's regexp package, the pure Go fallback moves forward by a whole
+// codepoint after an empty match.
+func (it *Iter) Next(caps *Captures) bool {
+	start := it.re.startSearch()
+	ok := it.next(caps)
+	it.re.endSearch(start, "Iter", len(it.haystack), ok)
+	return ok
+}
+
+func (it *Iter) next(caps *Captures) bool {
+	for it.lastEnd <= len(it.haystack) {
+		locs := it.re.findAt(it.haystack, it.lastEnd)
+		if locs == nil {
+			break
+		}
+		start, end := locs[0], locs[1]
+		if start == end {
+			_, size := utf8.DecodeRune(it.haystack[end:])
+			it.lastEnd = end + size
+			if end == len(it.haystack) {
+				it.lastEnd++
+			}
+			if end == it.lastMatch {
+				continue
+			}
+		} else {
+			it.lastEnd = end
+		}
+		it.lastMatch = end
+		it.match = [2]int{start, end}
+		if caps != nil {
+			caps.locs, caps.ok = locs, true
+		}
+		return true
+	}
+	it.lastEnd = len(it.haystack) + 1
+	if caps != nil {
+		caps.locs, caps.ok = nil, false
+	}
+	return false
+}
+
+// Match returns the start and end offsets of the current match in the
+// iterator.
+func (it *Iter) Match() (start, end int) {
+	return it.match[0], it.match[1]
+}
+
+func (err *Error) Error() string {
+	return err.msg
+}
+
+// anchorAtInvalidPrefix is the prefix of a pattern used by FindAnchoredAt and
+// IsFullMatchAt to match a byte of invalid UTF-8 before where the match
+// starts. Go's regexp package matches such a byte as a codepoint of its own.
+const anchorAtInvalidPrefix = anchorAtValidPrefix
@@ -0,0 +1,214 @@
+//go:build !cgo || purego
+// +build !cgo purego
+
+package rure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		pattern string
+		flags   uint32
+		want    string
+	}{
+		{`a+b`, FlagDefault, `a+b`},
+		{`a+b`, FlagCaseI | FlagMulti | FlagUnicode, `(?im)a+b`},
+		{`(?<name>a)(?P<other>b)`, FlagDefault, `(?P<name>a)(?P<other>b)`},
+		{`\d\D`, FlagDefault, `\p{Nd}\P{Nd}`},
+		{`[\d\s]`, FlagDefault, `[\p{Nd}\x{9}-\x{D} \x{85}\x{A0}\x{1680}` +
+			`\x{2000}-\x{200A}\x{2028}\x{2029}\x{202F}\x{205F}\x{3000}]`},
+		{`\w`, FlagDefault,
+			`[\p{L}\p{Nl}\p{M}\p{Nd}\p{Pc}\x{200C}\x{200D}Ⓐ-ⓩ🄰-🅉🅐-🅩🅰-🆉]`},
+		{`(?-u:\d\w)\d`, FlagDefault, `(?:[0-9][0-9A-Z_a-z])\p{Nd}`},
+		{`(?-u)\b\w\b`, FlagDefault, `\b[0-9A-Z_a-z]\b`},
+		{`\x41\x{2603}\u00E9\U0001F600`, FlagDefault, `A☃é😀`},
+		{`\p{Greek}\p{sc=Latin}\p{Script=Greek}`, FlagDefault,
+			`\p{Greek}\p{Latin}\p{Greek}`},
+		{`\p{Uppercase_Letter}\P{gc=Lu}\pN`, FlagDefault, `\p{Lu}\P{Lu}\p{N}`},
+		{"(?x) a b # comment\n c", FlagDefault, `abc`},
+		{"a  b", FlagSpace | FlagUnicode, `ab`},
+		{"(?x:a b) c", FlagDefault, `(?:ab) c`},
+		{`(?x)a\ b\#`, FlagDefault, `a b\#`},
+		{`(?x)a{ 1 , 2 }`, FlagDefault, `a{1,2}`},
+		{`(?i-s:a)(?ux)b`, FlagDefault, `(?i:a)b`},
+		{`[]a]`, FlagDefault, `[\]a]`},
+		{`[[:alpha:]]`, FlagDefault, `[[:alpha:]]`},
+		{`[a[bc]][a-z&&[^aeiou]]`, FlagDefault, `[a-c][b-df-hj-np-tv-z]`},
+		{`(?R)a`, FlagDefault, `a`},
+	}
+	for _, test := range tests {
+		got, err := translate(test.pattern, test.flags)
+		require.NoError(t, err, "pattern %q", test.pattern)
+		require.Equal(t, test.want, got, "pattern %q", test.pattern)
+	}
+}
+
+func TestTranslateError(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{`\bfoo`, "Unicode-aware word boundaries"},
+		{`(?-u).`, "arbitrary bytes"},
+		{`(?-u)\xFF`, `byte \xFF`},
+		{`(?-u)[^a]`, "arbitrary bytes"},
+		{`(?-u)\W`, "arbitrary bytes"},
+		{`(?=a)`, "look-around"},
+		{`(?<!a)`, "look-around"},
+		{`(a)\1`, "backreferences"},
+		{`\Qa\E`, "unrecognized escape"},
+		{`\<a`, "word boundary"},
+		{`(?Rm)^a`, "CRLF mode"},
+		{`\p{Emoji}`, "no equivalent"},
+		{`[a`, "unclosed character class"},
+	}
+	for _, test := range tests {
+		re, err := Compile(test.pattern)
+		require.Nil(t, re, "pattern %q", test.pattern)
+		require.Error(t, err, "pattern %q", test.pattern)
+		require.Contains(t, err.Error(), test.want, "pattern %q", test.pattern)
+	}
+}
+
+func TestPureGoError(t *testing.T) {
+	re, err := Compile(`(`)
+	require.Nil(t, re)
+	require.IsType(t, &Error{}, err)
+	require.Contains(t, err.Error(), "unclosed group")
+}
+
+func TestPureGoFind(t *testing.T) {
+	re := MustCompile(`\p{So}`)
+	require.True(t, re.IsMatch("snowman: ☃"))
+	start, end, ok := re.Find("snowman: ☃")
+	require.True(t, ok)
+	require.Equal(t, 9, start)
+	require.Equal(t, 12, end)
+
+	end, ok = MustCompile(`a+`).ShortestMatch("aaaaa")
+	require.True(t, ok)
+	require.Equal(t, 5, end)
+}
+
+func TestPureGoUnicodeClasses(t *testing.T) {
+	re := MustCompile(`^\w+\s\d+$`)
+	require.True(t, re.IsMatch("δέλτα\u00A0٣"))
+	re = MustCompile(`(?-u)^\w+$`)
+	require.False(t, re.IsMatch("δέλτα"))
+}
+
+func TestPureGoCaptures(t *testing.T) {
+	re := MustCompile(`.(.*(?P<snowman>\p{So}))$`)
+	caps := re.NewCaptures()
+	require.Equal(t, 3, caps.Len())
+	require.Equal(t, []string{"", "", "snowman"}, re.CaptureNames())
+
+	require.True(t, re.Captures(caps, "snowman: ☃"))
+	start, end, ok := caps.Group(2)
+	require.True(t, ok)
+	require.Equal(t, 9, start)
+	require.Equal(t, 12, end)
+
+	start, end, ok = caps.GroupName("snowman")
+	require.True(t, ok)
+	require.Equal(t, 9, start)
+	require.Equal(t, 12, end)
+
+	_, _, ok = caps.GroupName("nope")
+	require.False(t, ok)
+	_, _, ok = caps.Group(3)
+	require.False(t, ok)
+}
+
+func TestPureGoIter(t *testing.T) {
+	re := MustCompile(`\w+(\w)`)
+	it := re.Iter("abc xyz")
+
+	require.True(t, it.Next(nil))
+	start, end := it.Match()
+	require.Equal(t, 0, start)
+	require.Equal(t, 3, end)
+
+	caps := re.NewCaptures()
+	require.True(t, it.Next(caps))
+	start, end, ok := caps.Group(1)
+	require.True(t, ok)
+	require.Equal(t, 6, start)
+	require.Equal(t, 7, end)
+
+	require.False(t, it.Next(nil))
+	require.False(t, it.Next(nil))
+}
+
+func TestPureGoIterAgreesWithFindAll(t *testing.T) {
+	for _, pattern := range []string{``, `a*`, `\w+`, `(?m)^`, `☃*`} {
+		re := MustCompile(pattern)
+		haystack := "aa ☃ b\nab"
+		var got []int
+		it := re.Iter(haystack)
+		for it.Next(nil) {
+			start, end := it.Match()
+			got = append(got, start, end)
+		}
+		require.Equal(t, re.FindAll(haystack), got, "pattern %q", pattern)
+	}
+}
+
+func TestPureGoAt(t *testing.T) {
+	re := MustCompile(`(?-u:\b)bar`)
+	haystack := "foobar"
+	require.True(t, re.IsMatch(haystack[3:]))
+	require.False(t, re.IsMatchAt(haystack, 3))
+	require.True(t, re.IsMatchAt("foo bar", 3))
+
+	re = MustCompile(`\Afoo`)
+	require.False(t, re.IsMatchAt("foofoo", 3))
+	re = MustCompile(`(?m)^foo`)
+	require.True(t, re.IsMatchAt("x\nfoo", 2))
+	require.False(t, re.IsMatchAt("x\nfoo", 7))
+}
+
+func TestPureGoMany(t *testing.T) {
+	re := MustCompile(`\p{So}`)
+	require.Equal(t,
+		[]bool{true, false}, re.IsMatchMany([]string{"☃", "abc"}))
+	require.Equal(t,
+		[]int{9, 12, -1, -1},
+		re.FindManyBytes([][]byte{[]byte("snowman: ☃"), nil}))
+}
+
+func TestPureGoCount(t *testing.T) {
+	re := MustCompile(`\w+`)
+	require.Equal(t, 3, re.Count("abc xyz ☃ w"))
+	require.Equal(t, 2, re.CountLimitBytes([]byte("a b c"), 2))
+	require.Equal(t, 0, re.CountLimit("a b", 0))
+}
+
+func TestPureGoSet(t *testing.T) {
+	set := MustCompileSet([]string{`\w+`, `\d+`, `\p{So}`, `z`})
+	require.Equal(t, 4, set.Len())
+	require.True(t, set.IsMatch("snowman: ☃"))
+	require.Equal(t,
+		[]bool{true, false, true, false}, set.Matches("snowman: ☃"))
+
+	f, err := NewSetFinder([]string{`\d+`, `[a-z]+`}, FlagDefault, nil)
+	require.NoError(t, err)
+	require.Equal(t, []SetMatch{
+		{Pattern: 0, Start: 2, End: 3},
+		{Pattern: 1, Start: 0, End: 1},
+	}, f.Find("a 1"))
+}
+
+func TestPureGoFindSubmatch(t *testing.T) {
+	re := MustCompile(`(\w+)(?:-(\d+))?`)
+	require.Equal(t, []int{2, 5, 2, 5, -1, -1}, re.FindSubmatchIndex("  abc"))
+	require.Equal(t, []string{"abc-1", "abc", "1"}, re.FindSubmatch("abc-1"))
+	require.Equal(t,
+		[][]byte{[]byte("abc"), []byte("abc"), nil},
+		re.FindSubmatchBytes([]byte("abc")))
+	require.Nil(t, re.FindSubmatchBytes(nil))
+}
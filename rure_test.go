@@ -1,6 +1,13 @@
+//go:build cgo && !purego
+// +build cgo,!purego
+
 package rure
 
 import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -84,6 +91,19 @@ func TestFindAll(t *testing.T) {
 	require.Equal(t, []int{0, 3, 4, 7}, matches)
 }
 
+func TestCount(t *testing.T) {
+	re := MustCompile(`\w+`)
+	require.Equal(t, 3, re.Count("abc xyz ☃ w"))
+	require.Equal(t, 0, re.CountBytes([]byte("!!")))
+	require.Equal(t, 2, re.CountLimit("a b c d", 2))
+	require.Equal(t, 1, re.CountLimitBytes([]byte("a"), 5))
+	require.Equal(t, 0, re.CountLimit("a b", 0))
+
+	// Empty matches are counted the same way as by FindAll.
+	re = MustCompile(`a*`)
+	require.Equal(t, len(re.FindAll("baaab"))/2, re.Count("baaab"))
+}
+
 func TestAt(t *testing.T) {
 	re := MustCompile(`\bbar`)
 	haystack := "foobar"
@@ -95,3 +115,100 @@ func TestCaptureNames(t *testing.T) {
 	re := MustCompile(`(?P<foo>zzz)(zzz)(?:zzz)(?P<bar>zzz)`)
 	require.Equal(t, []string{"", "foo", "", "bar"}, re.CaptureNames())
 }
+
+func TestFindAllParallel(t *testing.T) {
+	haystack, err := ioutil.ReadFile("testdata/sherlock.txt")
+	require.NoError(t, err)
+
+	patterns := []string{
+		`Sherlock`,
+		`(?i)the`,
+		`\w+\s+\w+`,
+		`(?s)Sherlock.*?Holmes`,
+		`(?s)[^Q]*Q`,
+		`[^Z]*`,
+		`a*`,
+		``,
+		`\b`,
+		`(?m)^$`,
+	}
+	for _, pattern := range patterns {
+		re := MustCompile(pattern)
+		want := re.FindAllBytes(haystack)
+		for _, workers := range []int{0, 1, 2, 3, 7, 100} {
+			got := re.FindAllParallel(haystack, workers)
+			require.Equal(t, want, got, "pattern %q, workers %d", pattern, workers)
+		}
+	}
+}
+
+func TestIsMatchMany(t *testing.T) {
+	re := MustCompile(`^\w+$`)
+	require.Equal(t,
+		[]bool{true, false, false, true},
+		re.IsMatchMany([]string{"abc", "", "a b", "δ"}))
+	require.Equal(t,
+		[]bool{false, true},
+		re.IsMatchManyBytes([][]byte{nil, []byte("xyz")}))
+	require.Nil(t, re.IsMatchMany(nil))
+}
+
+func TestFindMany(t *testing.T) {
+	re := MustCompile(`\p{So}`)
+	require.Equal(t,
+		[]int{9, 12, -1, -1, 0, 3},
+		re.FindMany([]string{"snowman: ☃", "", "☃"}))
+	require.Equal(t,
+		[]int{-1, -1, 1, 4},
+		re.FindManyBytes([][]byte{[]byte("abc"), []byte("a☃")}))
+	require.Nil(t, re.FindManyBytes(nil))
+}
+
+func TestFindSubmatchIndex(t *testing.T) {
+	re := MustCompile(`(\w+)(?:-(\d+))?( ☃)?`)
+	require.Equal(t,
+		[]int{2, 8, 2, 5, 6, 8, -1, -1}, re.FindSubmatchIndex("  abc-12 x"))
+	require.Equal(t,
+		[]int{0, 3, 0, 3, -1, -1, -1, -1},
+		re.FindSubmatchIndexBytes([]byte("abc")))
+	require.Nil(t, re.FindSubmatchIndex("!!"))
+	require.Nil(t, re.FindSubmatchIndexBytes(nil))
+
+	require.Equal(t,
+		[]string{"abc-12", "abc", "12", ""}, re.FindSubmatch("  abc-12 x"))
+	require.Equal(t,
+		[][]byte{[]byte("abc ☃"), []byte("abc"), nil, []byte(" ☃")},
+		re.FindSubmatchBytes([]byte("abc ☃")))
+	require.Nil(t, re.FindSubmatch(""))
+
+	// Recompiling in place must not reuse Captures from the old regex.
+	require.NoError(t, re.UnmarshalText([]byte(`(a)(b)(c)(d)`)))
+	require.Equal(t,
+		[]string{"abcd", "a", "b", "c", "d"}, re.FindSubmatch("abcd"))
+}
+
+func TestFindSubmatchConcurrent(t *testing.T) {
+	re := MustCompile(`(\d+)-(\d+)`)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				text := fmt.Sprintf("x %d-%d", i, j)
+				want := []string{
+					fmt.Sprintf("%d-%d", i, j),
+					fmt.Sprint(i),
+					fmt.Sprint(j),
+				}
+				got := re.FindSubmatch(text)
+				if !reflect.DeepEqual(want, got) {
+					t.Errorf("FindSubmatch(%q) = %q, want %q",
+						text, got, want)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
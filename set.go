@@ -0,0 +1,235 @@
+//go:build cgo && !purego
+// +build cgo,!purego
+
+package rure
+
+// #include <stdio.h>
+// #include <stdlib.h>
+// #include "rure.h"
+//
+// /*
+//  * rure_compile_set_packed is like rure_compile_set, except the count
+//  * patterns are packed contiguously into patterns. The pattern i is the
+//  * range of bytes from offsets[i] to offsets[i+1], so offsets must have
+//  * count + 1 entries.
+//  */
+// rure_set *rure_compile_set_packed(const uint8_t *patterns,
+//                                   const size_t *offsets,
+//                                   size_t count,
+//                                   uint32_t flags,
+//                                   rure_options *options,
+//                                   rure_error *error)
+// {
+//     const uint8_t **ptrs = malloc((count + 1) * sizeof(uint8_t *));
+//     size_t *lens = malloc((count + 1) * sizeof(size_t));
+//     if (NULL == ptrs || NULL == lens) {
+//         fprintf(
+//             stderr, "rure_compile_set_packed: out of memory, aborting\n");
+//         abort();
+//     }
+//     for (size_t i = 0; i < count; i++) {
+//         ptrs[i] = patterns + offsets[i];
+//         lens[i] = offsets[i + 1] - offsets[i];
+//     }
+//     rure_set *set = rure_compile_set(
+//         ptrs, lens, count, flags, options, error);
+//     free(ptrs);
+//     free(lens);
+//     return set;
+// }
+import "C"
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// RegexSet is a set of compiled regular expressions that are searched
+// simultaneously in a single scan of a haystack.
+//
+// A RegexSet reports which of its patterns match, but not where they match.
+// Use SetFinder to find the location of each match.
+//
+// It can be used safely from multiple goroutines simultaneously.
+type RegexSet struct {
+	patterns []string
+	p        *C.rure_set
+
+	flags    uint32
+	options  *Options
+	anchored anchoredSets
+	// size is the compiled size of p, measured once by CompiledSize, and
+	// accessed atomically since it is read by the finalizer.
+	sizeOnce sync.Once
+	size     int64
+}
+
+// CompileSetOptions compiles each of patterns (in UTF-8) into a single set of
+// regular expressions that can be searched in a single scan.
+//
+// Flags and options are applied to every pattern in the set, with the same
+// meaning as in CompileOptions.
+//
+// If there was a problem compiling any of the patterns, then an error is
+// returned.
+func CompileSetOptions(
+	patterns []string,
+	flags uint32,
+	options *Options,
+) (*RegexSet, error) {
+	return compileSet(patterns, flags, options, false)
+}
+
+// compileSet is CompileSetOptions, where internal is true for sets built by
+// this package, whose size isn't measured by memory accounting.
+func compileSet(
+	patterns []string,
+	flags uint32,
+	options *Options,
+	internal bool,
+) (*RegexSet, error) {
+	set := &RegexSet{
+		patterns: append([]string(nil), patterns...),
+		flags:    flags,
+		options:  options,
+	}
+	runtime.SetFinalizer(set, func(set *RegexSet) {
+		if set.p != nil {
+			C.rure_set_free(set.p)
+			set.p = nil
+			trackMem(&memStats.Sets, -1, -atomic.LoadInt64(&set.size))
+		}
+	})
+
+	var optp *C.rure_options
+	if options != nil {
+		optp = options.p
+	}
+	packed, offsets := packStrings(patterns)
+	err := newError()
+	set.p = C.rure_compile_set_packed(
+		asUint8Ptr(packed),
+		&offsets[0],
+		C.size_t(len(patterns)),
+		C.uint32_t(flags),
+		optp,
+		err.p,
+	)
+	if set.p == nil {
+		return nil, err
+	}
+	trackMem(&memStats.Sets, 1, 0)
+	if !internal && atomic.LoadInt32(&memAccounting) == 1 {
+		set.CompiledSize()
+	}
+	return set, nil
+}
+
+// CompiledSize returns the approximate number of bytes used by the compiled
+// program of set in the C library, which is measured like
+// Regex.CompiledSize. It returns 0 for the zero value of RegexSet.
+func (set *RegexSet) CompiledSize() int {
+	if set.p == nil {
+		return 0
+	}
+	set.sizeOnce.Do(func() {
+		size := measureSize(func(limit int) bool {
+			return setCompilesWithin(set.patterns, set.flags, limit)
+		})
+		atomic.StoreInt64(&set.size, size)
+		atomic.AddInt64(&memStats.Bytes, size)
+	})
+	return int(atomic.LoadInt64(&set.size))
+}
+
+// setCompilesWithin returns true if patterns compile into a set within the
+// given size limit.
+func setCompilesWithin(patterns []string, flags uint32, limit int) bool {
+	options := C.rure_options_new()
+	defer C.rure_options_free(options)
+	C.rure_options_size_limit(options, C.size_t(limit))
+
+	err := C.rure_error_new()
+	defer C.rure_error_free(err)
+	packed, offsets := packStrings(patterns)
+	p := C.rure_compile_set_packed(
+		asUint8Ptr(packed),
+		&offsets[0],
+		C.size_t(len(patterns)),
+		C.uint32_t(flags),
+		options,
+		err,
+	)
+	if p == nil {
+		return false
+	}
+	C.rure_set_free(p)
+	return true
+}
+
+// Len returns the number of patterns in the set.
+func (set *RegexSet) Len() int {
+	return int(C.rure_set_len(set.p))
+}
+
+// IsMatch returns true if any pattern in set matches text.
+func (set *RegexSet) IsMatch(text string) bool {
+	return set.IsMatchBytesAt(noCopyBytes(text), 0)
+}
+
+// IsMatchBytes returns true if any pattern in set matches text.
+func (set *RegexSet) IsMatchBytes(text []byte) bool {
+	return set.IsMatchBytesAt(text, 0)
+}
+
+// IsMatchAt returns true if any pattern in set matches text starting at
+// index i.
+func (set *RegexSet) IsMatchAt(text string, i int) bool {
+	return set.IsMatchBytesAt(noCopyBytes(text), i)
+}
+
+// IsMatchBytesAt returns true if any pattern in set matches text starting at
+// index i.
+func (set *RegexSet) IsMatchBytesAt(text []byte, i int) bool {
+	start := set.startSearch()
+	ok := bool(C.rure_set_is_match(
+		set.p, asUint8Ptr(text), C.size_t(len(text)), C.size_t(i)))
+	set.endSearch(start, "IsMatch", len(text), ok)
+	return ok
+}
+
+// Matches returns, for each pattern in set, whether it matches text. The
+// slice returned is indexed in the same order as the patterns the set was
+// compiled with.
+func (set *RegexSet) Matches(text string) []bool {
+	return set.MatchesBytesAt(noCopyBytes(text), 0)
+}
+
+// MatchesBytes returns, for each pattern in set, whether it matches text.
+// The slice returned is indexed in the same order as the patterns the set
+// was compiled with.
+func (set *RegexSet) MatchesBytes(text []byte) []bool {
+	return set.MatchesBytesAt(text, 0)
+}
+
+// MatchesAt is like Matches, but starts searching text at index i.
+func (set *RegexSet) MatchesAt(text string, i int) []bool {
+	return set.MatchesBytesAt(noCopyBytes(text), i)
+}
+
+// MatchesBytesAt is like MatchesBytes, but starts searching text at index i.
+func (set *RegexSet) MatchesBytesAt(text []byte, i int) []bool {
+	start := set.startSearch()
+	matches := make([]C.bool, set.Len()+1)
+	ok := bool(C.rure_set_matches(
+		set.p, asUint8Ptr(text), C.size_t(len(text)), C.size_t(i),
+		&matches[0]))
+
+	results := make([]bool, len(matches)-1)
+	for i := range results {
+		results[i] = bool(matches[i])
+	}
+	set.endSearch(start, "Matches", len(text), ok)
+	return results
+}
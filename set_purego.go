@@ -0,0 +1,133 @@
+//go:build !cgo || purego
+// +build !cgo purego
+
+package rure
+
+// RegexSet is a set of compiled regular expressions that are searched
+// simultaneously in a single scan of a haystack.
+//
+// The pure Go fallback searches with each regular expression in turn.
+//
+// It can be used safely from multiple goroutines simultaneously.
+type RegexSet struct {
+	patterns []string
+	regexes  []*Regex
+
+	flags    uint32
+	options  *Options
+	anchored anchoredSets
+}
+
+// CompileSetOptions compiles each of patterns (in UTF-8) into a single set of
+// regular expressions.
+//
+// Flags and options are applied to every pattern in the set, with the same
+// meaning as in CompileOptions.
+//
+// If there was a problem compiling any of the patterns, then an error is
+// returned.
+func CompileSetOptions(
+	patterns []string,
+	flags uint32,
+	options *Options,
+) (*RegexSet, error) {
+	return compileSet(patterns, flags, options, false)
+}
+
+// compileSet is CompileSetOptions, where internal is true for sets built by
+// this package, whose patterns are reported to observers as internal.
+func compileSet(
+	patterns []string,
+	flags uint32,
+	options *Options,
+	internal bool,
+) (*RegexSet, error) {
+	set := &RegexSet{
+		patterns: append([]string(nil), patterns...),
+		flags:    flags,
+		options:  options,
+	}
+	for _, pattern := range patterns {
+		re := &Regex{}
+		if err := re.compile(pattern, flags, options, internal); err != nil {
+			return nil, err
+		}
+		set.regexes = append(set.regexes, re)
+	}
+	return set, nil
+}
+
+// CompiledSize returns the approximate number of bytes used by the compiled
+// program of set in the C library. The pure Go fallback doesn't use the C
+// library, so it always returns 0.
+func (set *RegexSet) CompiledSize() int {
+	return 0
+}
+
+// Len returns the number of patterns in the set.
+func (set *RegexSet) Len() int {
+	return len(set.regexes)
+}
+
+// IsMatch returns true if any pattern in set matches text.
+func (set *RegexSet) IsMatch(text string) bool {
+	return set.IsMatchBytesAt(noCopyBytes(text), 0)
+}
+
+// IsMatchBytes returns true if any pattern in set matches text.
+func (set *RegexSet) IsMatchBytes(text []byte) bool {
+	return set.IsMatchBytesAt(text, 0)
+}
+
+// IsMatchAt returns true if any pattern in set matches text starting at
+// index i.
+func (set *RegexSet) IsMatchAt(text string, i int) bool {
+	return set.IsMatchBytesAt(noCopyBytes(text), i)
+}
+
+// IsMatchBytesAt returns true if any pattern in set matches text starting at
+// index i.
+func (set *RegexSet) IsMatchBytesAt(text []byte, i int) bool {
+	start := set.startSearch()
+	ok := false
+	for _, re := range set.regexes {
+		if re.isMatchAt(text, i) {
+			ok = true
+			break
+		}
+	}
+	set.endSearch(start, "IsMatch", len(text), ok)
+	return ok
+}
+
+// Matches returns, for each pattern in set, whether it matches text. The
+// slice returned is indexed in the same order as the patterns the set was
+// compiled with.
+func (set *RegexSet) Matches(text string) []bool {
+	return set.MatchesBytesAt(noCopyBytes(text), 0)
+}
+
+// MatchesBytes returns, for each pattern in set, whether it matches text.
+// The slice returned is indexed in the same order as the patterns the set
+// was compiled with.
+func (set *RegexSet) MatchesBytes(text []byte) []bool {
+	return set.MatchesBytesAt(text, 0)
+}
+
+// MatchesAt is like Matches, but starts searching text at index i.
+func (set *RegexSet) MatchesAt(text string, i int) []bool {
+	return set.MatchesBytesAt(noCopyBytes(text), i)
+}
+
+// MatchesBytesAt is like MatchesBytes, but starts searching text at index i.
+func (set *RegexSet) MatchesBytesAt(text []byte, i int) []bool {
+	start := set.startSearch()
+	results := make([]bool, len(set.regexes))
+	ok := false
+	for j, re := range set.regexes {
+		results[j] = re.isMatchAt(text, i)
+		ok = ok || results[j]
+	}
+	set.endSearch(start, "Matches", len(text), ok)
+	return results
+}
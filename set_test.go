@@ -0,0 +1,74 @@
+//go:build cgo && !purego
+// +build cgo,!purego
+
+package rure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetError(t *testing.T) {
+	set, err := CompileSet([]string{`a`, `(`})
+	require.Nil(t, set)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "unclosed group")
+}
+
+func TestSetMatches(t *testing.T) {
+	set := MustCompileSet([]string{`\w+`, `\d+`, `\p{So}`, `z`})
+	require.Equal(t, 4, set.Len())
+	require.True(t, set.IsMatch("snowman: ☃"))
+	require.False(t, set.IsMatch("!!!"))
+	require.Equal(t,
+		[]bool{true, false, true, false}, set.Matches("snowman: ☃"))
+	require.Equal(t,
+		[]bool{false, false, false, false}, set.MatchesBytes(nil))
+}
+
+func TestSetAt(t *testing.T) {
+	set := MustCompileSet([]string{`\bbar`, `^foo`})
+	haystack := "foobar"
+	require.True(t, set.IsMatch(haystack[3:]))
+	require.False(t, set.IsMatchAt(haystack, 3))
+	require.Equal(t, []bool{false, false}, set.MatchesAt(haystack, 3))
+}
+
+func TestSetEmpty(t *testing.T) {
+	set := MustCompileSet(nil)
+	require.Equal(t, 0, set.Len())
+	require.False(t, set.IsMatch("abc"))
+	require.Equal(t, []bool{}, set.Matches("abc"))
+}
+
+func TestSetFinder(t *testing.T) {
+	f, err := NewSetFinder(
+		[]string{`\d+`, `[a-z]+`, `(?P<sym>\p{So})`}, FlagDefault, nil)
+	require.NoError(t, err)
+
+	matches := f.Find("snowman: ☃")
+	require.Equal(t, []SetMatch{
+		{Pattern: 1, Start: 0, End: 7},
+		{Pattern: 2, Start: 9, End: 12},
+	}, matches)
+	require.Nil(t, f.regexes[0].re)
+	require.Nil(t, f.FindBytes([]byte("!!!")))
+
+	matches = f.FindCaptures("a 1 ☃")
+	require.Len(t, matches, 3)
+	start, end, ok := matches[2].Captures.GroupName("sym")
+	require.True(t, ok)
+	require.Equal(t, 4, start)
+	require.Equal(t, 7, end)
+	require.Equal(t, 2, matches[0].Start)
+	require.Equal(t, 3, matches[0].End)
+}
+
+func TestSetFinderCount(t *testing.T) {
+	f, err := NewSetFinder([]string{`\d+`, `[a-z]+`, `!`}, FlagDefault, nil)
+	require.NoError(t, err)
+	require.Equal(t, []int{2, 3, 0}, f.Count("a 1 bc 22 d"))
+	require.Equal(t, []int{0, 0, 0}, f.CountBytes(nil))
+	require.Nil(t, f.regexes[2].re)
+}
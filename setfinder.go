@@ -0,0 +1,155 @@
+package rure
+
+import (
+	"fmt"
+	"sync"
+)
+
+// SetFinder finds the location of each pattern in a RegexSet that matches a
+// haystack.
+//
+// A RegexSet can only report which of its patterns match. A SetFinder first
+// searches with the set, and then searches again with an individually
+// compiled Regex for only those patterns that the set reported as matching.
+// Each individual Regex is compiled the first time it is needed.
+//
+// It can be used safely from multiple goroutines simultaneously.
+type SetFinder struct {
+	set     *RegexSet
+	flags   uint32
+	options *Options
+	regexes []lazyRegex
+}
+
+type lazyRegex struct {
+	once sync.Once
+	re   *Regex
+}
+
+// SetMatch is the location of a match of a single pattern in a SetFinder.
+type SetMatch struct {
+	// Pattern is the index of the pattern that matched, in the order the
+	// patterns were given to the set.
+	Pattern int
+	// Start is the start offset of the leftmost-first match of the pattern.
+	Start int
+	// End is the end offset of the leftmost-first match of the pattern.
+	End int
+	// Captures contains the location of every capturing group in the match.
+	// It is only set by FindCaptures and FindCapturesBytes.
+	Captures *Captures
+}
+
+// NewSetFinder compiles patterns into a RegexSet and returns a SetFinder
+// for it. Flags and options have the same meaning as in CompileSetOptions.
+//
+// The same flags and options are used when compiling the individual
+// patterns, so options must not be modified after calling NewSetFinder.
+func NewSetFinder(
+	patterns []string,
+	flags uint32,
+	options *Options,
+) (*SetFinder, error) {
+	set, err := CompileSetOptions(patterns, flags, options)
+	if err != nil {
+		return nil, err
+	}
+	return &SetFinder{
+		set:     set,
+		flags:   flags,
+		options: options,
+		regexes: make([]lazyRegex, len(patterns)),
+	}, nil
+}
+
+// Set returns the RegexSet used for the first pass of every search.
+func (f *SetFinder) Set() *RegexSet {
+	return f.set
+}
+
+// Regex returns the individually compiled Regex for the pattern indexed by
+// i, compiling it if this is the first time it is needed.
+func (f *SetFinder) Regex(i int) *Regex {
+	lazy := &f.regexes[i]
+	lazy.once.Do(func() {
+		re, err := CompileOptions(f.set.patterns[i], f.flags, f.options)
+		if err != nil {
+			// This should be impossible, since the pattern was already
+			// compiled as part of a set with the same flags and options.
+			panic(fmt.Sprintf("rure: pattern %d of set failed: %s", i, err))
+		}
+		lazy.re = re
+	})
+	return lazy.re
+}
+
+// Find returns the location of the leftmost-first match of each pattern that
+// matches text, in the order the patterns were given to the set.
+//
+// If no pattern matches, then nil is returned.
+func (f *SetFinder) Find(text string) []SetMatch {
+	return f.find(noCopyBytes(text), false)
+}
+
+// FindBytes returns the location of the leftmost-first match of each pattern
+// that matches text, in the order the patterns were given to the set.
+//
+// If no pattern matches, then nil is returned.
+func (f *SetFinder) FindBytes(text []byte) []SetMatch {
+	return f.find(text, false)
+}
+
+// FindCaptures is like Find, but also sets the Captures of each match.
+func (f *SetFinder) FindCaptures(text string) []SetMatch {
+	return f.find(noCopyBytes(text), true)
+}
+
+// FindCapturesBytes is like FindBytes, but also sets the Captures of each
+// match.
+func (f *SetFinder) FindCapturesBytes(text []byte) []SetMatch {
+	return f.find(text, true)
+}
+
+func (f *SetFinder) find(text []byte, captures bool) []SetMatch {
+	var matches []SetMatch
+	for i, ok := range f.set.MatchesBytes(text) {
+		if !ok {
+			continue
+		}
+		re := f.Regex(i)
+		m := SetMatch{Pattern: i}
+		if captures {
+			m.Captures = re.NewCaptures()
+			if !re.CapturesBytes(m.Captures, text) {
+				continue
+			}
+			m.Start, m.End, _ = m.Captures.Group(0)
+		} else {
+			m.Start, m.End, ok = re.FindBytes(text)
+			if !ok {
+				continue
+			}
+		}
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+// Count returns the number of successive non-overlapping matches of each
+// pattern in text, in the order the patterns were given to the set. Only the
+// patterns that the set reports as matching are counted with their
+// individual Regex, as if by Regex.Count.
+func (f *SetFinder) Count(text string) []int {
+	return f.CountBytes(noCopyBytes(text))
+}
+
+// CountBytes is like Count, but for a []byte haystack.
+func (f *SetFinder) CountBytes(text []byte) []int {
+	counts := make([]int, f.set.Len())
+	for i, ok := range f.set.MatchesBytes(text) {
+		if ok {
+			counts[i] = f.Regex(i).CountBytes(text)
+		}
+	}
+	return counts
+}
@@ -0,0 +1,187 @@
+package rure
+
+import (
+	"bufio"
+	"unicode/utf8"
+)
+
+// SplitMode decides how the matches of a regex divide text into records in
+// SplitFunc.
+type SplitMode int
+
+const (
+	// SplitDelimiter is the mode where matches separate records, like the
+	// new lines found by bufio.ScanLines. The matches themselves are not
+	// part of any record unless KeepDelimiter is set.
+	SplitDelimiter SplitMode = iota
+	// SplitRecordStart is the mode where each match starts a new record,
+	// such as the timestamp at the start of each entry in a log whose
+	// entries may span multiple lines. Each match is part of the record it
+	// starts, and any text before the first match is a record of its own.
+	SplitRecordStart
+)
+
+// SplitOptions configures the bufio.SplitFunc returned by SplitFunc.
+type SplitOptions struct {
+	// Mode is how matches divide text into records.
+	Mode SplitMode
+	// KeepDelimiter is true if each record in SplitDelimiter mode should end
+	// with the match that ends it. It is ignored in SplitRecordStart mode.
+	KeepDelimiter bool
+}
+
+// SplitFunc returns a bufio.SplitFunc that splits text into records using
+// the leftmost-first matches of re, for use with bufio.Scanner.
+//
+// Empty matches never divide records. In SplitDelimiter mode, text that ends
+// with a match does not have an empty record after it, like bufio.ScanLines.
+//
+// Matches are found as if the whole text were searched at once, so ^ and \A
+// only match at the start of the text, and (?m)^ and \b see the text before
+// the data that the scanner has buffered. For this, the function returned
+// keeps track of the text it has split, so it must only be used by one
+// bufio.Scanner, and patterns with such assertions are searched in a copy of
+// the buffered data.
+//
+// A match that ends at the end of the data that the scanner has buffered
+// might turn out differently once more data is read, so more data is
+// requested in that case. But since the split function can't see beyond the
+// end of the buffered data, a match that is found earlier in the buffer is
+// used even if, with more data, a match starting before it would have been
+// found. Patterns whose matches can't be extended by more data, such as
+// \r?\n or (?m)^\d{4}-, don't have this problem.
+func (re *Regex) SplitFunc(opts SplitOptions) bufio.SplitFunc {
+	sp := &splitter{re: re, keep: opts.KeepDelimiter}
+	sp.looksBehind = looksBehind(re.pattern, re.flags)
+	if opts.Mode == SplitRecordStart {
+		return sp.splitRecordStart
+	}
+	return sp.splitDelimiter
+}
+
+// splitter is the state of a bufio.SplitFunc returned by SplitFunc.
+type splitter struct {
+	re   *Regex
+	keep bool
+	// looksBehind is true if re has assertions, like ^ and \b, whose
+	// matches depend on the text before the data being searched.
+	looksBehind bool
+	// before is the end of the text that was split so far, which is at most
+	// utf8.UTFMax bytes long, and is empty at the start of the text.
+	before []byte
+	// buf holds before followed by the data being searched, when the
+	// matches of re depend on before.
+	buf []byte
+}
+
+func (sp *splitter) splitDelimiter(
+	data []byte,
+	atEOF bool,
+) (advance int, token []byte, err error) {
+	if len(data) == 0 {
+		return 0, nil, nil
+	}
+	start, end, ok := sp.next(data, 0)
+	if !ok || end == len(data) && !atEOF {
+		if atEOF {
+			return sp.advance(data, len(data)), data, nil
+		}
+		return 0, nil, nil
+	}
+	if sp.keep {
+		return sp.advance(data, end), data[:end], nil
+	}
+	return sp.advance(data, end), data[:start], nil
+}
+
+func (sp *splitter) splitRecordStart(
+	data []byte,
+	atEOF bool,
+) (advance int, token []byte, err error) {
+	if len(data) == 0 {
+		return 0, nil, nil
+	}
+	// The match that starts this record, if any, can't start the next one,
+	// even if another match overlaps it.
+	from := 1
+	if start, end, ok := sp.next(data, 0); ok && start == 0 {
+		from = end
+	}
+	start, end, ok := sp.next(data, from)
+	if !ok || end == len(data) && !atEOF {
+		if atEOF {
+			return sp.advance(data, len(data)), data, nil
+		}
+		return 0, nil, nil
+	}
+	return sp.advance(data, start), data[:start], nil
+}
+
+// advance records that the first n bytes of data were split off, and
+// returns n.
+func (sp *splitter) advance(data []byte, n int) int {
+	if n >= utf8.UTFMax {
+		sp.before = append(sp.before[:0], data[n-utf8.UTFMax:n]...)
+	} else {
+		sp.before = append(sp.before, data[:n]...)
+		if len(sp.before) > utf8.UTFMax {
+			sp.before = sp.before[len(sp.before)-utf8.UTFMax:]
+		}
+	}
+	return n
+}
+
+// next returns the leftmost-first non-empty match of re in data that starts
+// at or after from, as if the text split so far came before data.
+func (sp *splitter) next(data []byte, from int) (start, end int, ok bool) {
+	if !sp.looksBehind || len(sp.before) == 0 {
+		return sp.re.splitNext(data, from)
+	}
+	sp.buf = append(append(sp.buf[:0], sp.before...), data...)
+	start, end, ok = sp.re.splitNext(sp.buf, len(sp.before)+from)
+	if !ok {
+		return 0, 0, false
+	}
+	return start - len(sp.before), end - len(sp.before), true
+}
+
+// looksBehind returns true if pattern, compiled with flags, has assertions
+// that depend on the text before where they match, or if it can't be
+// parsed.
+func looksBehind(pattern string, flags uint32) bool {
+	root, _, err := parse(pattern, flags)
+	if err != nil {
+		return true
+	}
+	var visit func(n *node) bool
+	visit = func(n *node) bool {
+		if n.kind == nodeAssertion &&
+			n.assert != assertEndText && n.assert != assertEndLine {
+			return true
+		}
+		for _, sub := range n.subs {
+			if visit(sub) {
+				return true
+			}
+		}
+		return false
+	}
+	return visit(root)
+}
+
+// splitNext returns the leftmost-first non-empty match of re in data that
+// starts at or after from.
+func (re *Regex) splitNext(data []byte, from int) (start, end int, ok bool) {
+	for from <= len(data) {
+		if from == 0 {
+			start, end, ok = re.FindBytes(data)
+		} else if locs := re.FindSubmatchIndexBytesAt(data, from); locs != nil {
+			start, end, ok = locs[0], locs[1], true
+		}
+		if !ok || start < end {
+			return start, end, ok
+		}
+		from, ok = end+1, false
+	}
+	return 0, 0, false
+}
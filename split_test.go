@@ -0,0 +1,83 @@
+package rure
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func scanAll(
+	t *testing.T,
+	re *Regex,
+	opts SplitOptions,
+	text string,
+) []string {
+	var records []string
+	// Reading a byte at a time with a small buffer makes matches touch the
+	// end of the buffered data as often as possible.
+	sc := bufio.NewScanner(iotest.OneByteReader(strings.NewReader(text)))
+	sc.Buffer(make([]byte, 2), 1024)
+	sc.Split(re.SplitFunc(opts))
+	for sc.Scan() {
+		records = append(records, sc.Text())
+	}
+	require.NoError(t, sc.Err())
+	return records
+}
+
+func TestSplitDelimiter(t *testing.T) {
+	re := MustCompile(`\n[ \t]*\n`)
+	text := "a\nb\n\nc\n \n\nd\n\n"
+	require.Equal(t, []string{"a\nb", "c", "\nd"},
+		scanAll(t, re, SplitOptions{}, text))
+	require.Equal(t, []string{"a\nb\n\n", "c\n \n", "\nd\n\n"},
+		scanAll(t, re, SplitOptions{KeepDelimiter: true}, text))
+	require.Equal(t, []string{"x"}, scanAll(t, re, SplitOptions{}, "x"))
+	require.Empty(t, scanAll(t, re, SplitOptions{}, ""))
+
+	// A match touching the end of the buffer is only a delimiter once it
+	// can't be extended.
+	re = MustCompile(`,+`)
+	require.Equal(t, []string{"a", "b", "c"},
+		scanAll(t, re, SplitOptions{}, "a,,,b,,c"))
+}
+
+func TestSplitAnchors(t *testing.T) {
+	// After the scanner refills its buffer, the data it gives to the split
+	// function no longer starts at the start of the text or of a line.
+	re := MustCompile(`(?m)^a`)
+	require.Equal(t, []string{"", "ab\n", "a"},
+		scanAll(t, re, SplitOptions{}, "aab\naa"))
+	require.Equal(t, []string{"a", "ab\na", "a"},
+		scanAll(t, re, SplitOptions{KeepDelimiter: true}, "aab\naa"))
+	require.Equal(t, []string{"aab\n", "aa"},
+		scanAll(t, re, SplitOptions{Mode: SplitRecordStart}, "aab\naa"))
+
+	re = MustCompile(`\Ax|(?-u:\b)y`)
+	require.Equal(t, []string{"", "xy ", " ", "xy"},
+		scanAll(t, re, SplitOptions{}, "xxy y yxy"))
+}
+
+func TestSplitRecordStart(t *testing.T) {
+	re := MustCompile(`(?m)^\d{4}-`)
+	text := "preamble\n2024-01-01 one\n  more\n2024-01-02 two\n2024-01-03"
+	opts := SplitOptions{Mode: SplitRecordStart}
+	require.Equal(t, []string{
+		"preamble\n",
+		"2024-01-01 one\n  more\n",
+		"2024-01-02 two\n",
+		"2024-01-03",
+	}, scanAll(t, re, opts, text))
+	require.Equal(t, []string{"2024-x"}, scanAll(t, re, opts, "2024-x"))
+}
+
+func TestSplitEmptyMatches(t *testing.T) {
+	re := MustCompile(`;*`)
+	require.Equal(t, []string{"a", "b"},
+		scanAll(t, re, SplitOptions{}, "a;;b"))
+	require.Equal(t, []string{"a", ";;b"},
+		scanAll(t, re, SplitOptions{Mode: SplitRecordStart}, "a;;b"))
+}
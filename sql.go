@@ -0,0 +1,135 @@
+package rure
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// Scan implements sql.Scanner by compiling a pattern read from a database
+// with default flags and default size limits, as if by Compile. The pattern
+// may be stored as any string or byte column. To scan a column that may be
+// NULL, or to compile with other flags, use NullRegex.
+//
+// If the pattern fails to compile, then a *ScanError is returned and re is
+// left unchanged.
+func (re *Regex) Scan(src interface{}) error {
+	return scanRegex(re, src, FlagDefault, nil)
+}
+
+// Value implements driver.Valuer by storing the text written by
+// MarshalText.
+func (re *Regex) Value() (driver.Value, error) {
+	text, err := re.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return string(text), nil
+}
+
+// NullRegex is a regular expression that may be NULL in a database. It
+// implements sql.Scanner and driver.Valuer.
+//
+// Flags and Options are used to compile each pattern scanned, and may be set
+// before scanning a row:
+//
+//	n := rure.NullRegex{Flags: rure.FlagCaseI | rure.FlagUnicode}
+//	err := rows.Scan(&name, &n)
+//
+// Since a zero Flags means FlagDefault, FlagsSet must also be set to compile
+// with no flags at all:
+//
+//	n := rure.NullRegex{FlagsSet: true}
+type NullRegex struct {
+	// Regex is the most recently scanned regular expression. It is nil if
+	// the most recently scanned value was NULL.
+	Regex *Regex
+	// Valid is true if Regex is not NULL.
+	Valid bool
+
+	// Flags is used to compile scanned patterns. When zero, FlagDefault is
+	// used unless FlagsSet is true.
+	Flags uint32
+	// FlagsSet is true if Flags is used as is, even when it is zero.
+	FlagsSet bool
+	// Options is used to compile scanned patterns. When nil, default settings
+	// are used.
+	Options *Options
+}
+
+// Scan implements sql.Scanner. If the pattern fails to compile, then a
+// *ScanError is returned and n is left unchanged.
+func (n *NullRegex) Scan(src interface{}) error {
+	if src == nil {
+		n.Regex, n.Valid = nil, false
+		return nil
+	}
+	flags := n.Flags
+	if flags == 0 && !n.FlagsSet {
+		flags = FlagDefault
+	}
+	re := &Regex{}
+	if err := scanRegex(re, src, flags, n.Options); err != nil {
+		return err
+	}
+	n.Regex, n.Valid = re, true
+	return nil
+}
+
+// Value implements driver.Valuer. It stores NULL when n is not valid, and
+// the text written by MarshalText otherwise.
+func (n NullRegex) Value() (driver.Value, error) {
+	if !n.Valid || n.Regex == nil {
+		return nil, nil
+	}
+	return n.Regex.Value()
+}
+
+// ScanError is returned when a pattern read from a database fails to
+// compile. database/sql adds the column of the row being scanned when
+// reporting it.
+type ScanError struct {
+	// Pattern is the pattern that failed to compile.
+	Pattern string
+	// SourceType is the Go type of the value the pattern was scanned from,
+	// such as "string" or "[]uint8".
+	SourceType string
+	// Err is the reason it failed to compile, usually an *Error.
+	Err error
+}
+
+func (err *ScanError) Error() string {
+	return fmt.Sprintf("rure: compiling %q scanned from %s: %s",
+		err.Pattern, err.SourceType, err.Err)
+}
+
+// Unwrap returns the error that caused the pattern to fail to compile.
+func (err *ScanError) Unwrap() error {
+	return err.Err
+}
+
+func scanRegex(
+	re *Regex,
+	src interface{},
+	flags uint32,
+	options *Options,
+) error {
+	var pattern string
+	switch src := src.(type) {
+	case string:
+		pattern = src
+	case []byte:
+		pattern = string(src)
+	case nil:
+		return fmt.Errorf("rure: cannot scan NULL into *rure.Regex")
+	default:
+		return fmt.Errorf("rure: cannot scan %T into *rure.Regex", src)
+	}
+	if err := re.compile(pattern, flags, options, false); err != nil {
+		return &ScanError{
+			Pattern:    pattern,
+			SourceType: fmt.Sprintf("%T", src),
+			Err:        err,
+		}
+	}
+	return nil
+}
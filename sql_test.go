@@ -0,0 +1,218 @@
+package rure
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDriver is a database/sql driver for a single table with a name column
+// and a pattern column. The query INSERT inserts a row, DELETE deletes every
+// row and anything else selects every row.
+type fakeDriver struct {
+	mu   sync.Mutex
+	rows [][]driver.Value
+}
+
+var registerFakeDriver sync.Once
+
+func openFakeDB(t *testing.T) *sql.DB {
+	registerFakeDriver.Do(func() {
+		sql.Register("rurefake", &fakeDriver{})
+	})
+	db, err := sql.Open("rurefake", "")
+	require.NoError(t, err)
+	_, err = db.Exec("DELETE")
+	require.NoError(t, err)
+	return db
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	return fakeConn{d}, nil
+}
+
+type fakeConn struct {
+	d *fakeDriver
+}
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeStmt{c.d, query}, nil
+}
+
+func (c fakeConn) Close() error {
+	return nil
+}
+
+func (c fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+type fakeStmt struct {
+	d     *fakeDriver
+	query string
+}
+
+func (s fakeStmt) Close() error {
+	return nil
+}
+
+func (s fakeStmt) NumInput() int {
+	if s.query == "INSERT" {
+		return 2
+	}
+	return 0
+}
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	if s.query == "DELETE" {
+		s.d.rows = nil
+	} else {
+		s.d.rows = append(s.d.rows, args)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	return &fakeRows{rows: append([][]driver.Value(nil), s.d.rows...)}, nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"name", "pattern"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestSQLRoundTrip(t *testing.T) {
+	db := openFakeDB(t)
+	defer db.Close()
+
+	re, err := CompileOptions(`fo+`, FlagCaseI|FlagUnicode, nil)
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT", "regex", re)
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT", "null", NullRegex{})
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT", "bytes", []byte(`ba+r`))
+	require.NoError(t, err)
+
+	rows, err := db.Query("SELECT")
+	require.NoError(t, err)
+	defer rows.Close()
+	var got []NullRegex
+	for rows.Next() {
+		var name string
+		n := NullRegex{Flags: FlagMulti | FlagUnicode}
+		require.NoError(t, rows.Scan(&name, &n))
+		got = append(got, n)
+	}
+	require.NoError(t, rows.Err())
+	require.Len(t, got, 3)
+
+	require.True(t, got[0].Valid)
+	require.Equal(t, `(?i)fo+`, got[0].Regex.String())
+	require.True(t, got[0].Regex.IsMatch("FOO"))
+	require.False(t, got[1].Valid)
+	require.Nil(t, got[1].Regex)
+	require.True(t, got[2].Valid)
+	require.True(t, got[2].Regex.IsMatch("x\nbaar"))
+
+	v, err := got[1].Value()
+	require.NoError(t, err)
+	require.Nil(t, v)
+	v, err = got[2].Value()
+	require.NoError(t, err)
+	require.Equal(t, `(?m)ba+r`, v)
+}
+
+func TestSQLScanRegex(t *testing.T) {
+	db := openFakeDB(t)
+	defer db.Close()
+	_, err := db.Exec("INSERT", "ok", `\d+`)
+	require.NoError(t, err)
+
+	var name string
+	var re Regex
+	require.NoError(t, db.QueryRow("SELECT").Scan(&name, &re))
+	require.True(t, re.IsMatch("42"))
+
+	_, err = db.Exec("INSERT", "null", nil)
+	require.NoError(t, err)
+	rows, err := db.Query("SELECT")
+	require.NoError(t, err)
+	defer rows.Close()
+	require.True(t, rows.Next())
+	require.True(t, rows.Next())
+	err = rows.Scan(&name, &re)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "NULL")
+	require.True(t, re.IsMatch("42"))
+}
+
+func TestSQLScanError(t *testing.T) {
+	db := openFakeDB(t)
+	defer db.Close()
+	_, err := db.Exec("INSERT", "bad", `(`)
+	require.NoError(t, err)
+
+	var name string
+	var n NullRegex
+	err = db.QueryRow("SELECT").Scan(&name, &n)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `name "pattern"`)
+
+	var scanErr *ScanError
+	require.True(t, errors.As(err, &scanErr))
+	require.Equal(t, `(`, scanErr.Pattern)
+	require.Equal(t, "string", scanErr.SourceType)
+	require.Contains(t, err.Error(), "scanned from string")
+	var compileErr *Error
+	require.True(t, errors.As(err, &compileErr))
+	require.False(t, n.Valid)
+
+	var re Regex
+	require.Error(t, re.Scan(1))
+	err = re.Scan([]byte(`)`))
+	require.True(t, errors.As(err, &scanErr))
+	require.Equal(t, "[]uint8", scanErr.SourceType)
+}
+
+func TestSQLNullRegexFlags(t *testing.T) {
+	var n NullRegex
+	require.NoError(t, n.Scan(`\w`))
+	require.True(t, n.Regex.IsMatch("é"))
+
+	n = NullRegex{Flags: FlagCaseI}
+	require.NoError(t, n.Scan(`a`))
+	require.True(t, n.Regex.IsMatch("A"))
+
+	// Without FlagsSet, a zero Flags means FlagDefault, which enables
+	// Unicode. With it, no flags are used at all.
+	n = NullRegex{FlagsSet: true}
+	require.NoError(t, n.Scan(`\w`))
+	require.False(t, n.Regex.IsMatch("é"))
+	require.True(t, n.Regex.IsMatch("a"))
+}
@@ -0,0 +1,979 @@
+package rure
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/rure-go/internal/inlineflags"
+)
+
+// SyntaxError is an error in the syntax of a pattern found while parsing it
+// in Go, rather than by compiling it with the regex engine.
+type SyntaxError struct {
+	// Pattern is the pattern that has the error.
+	Pattern string
+	// Offset is the byte offset in Pattern where the error is.
+	Offset int
+	// Message describes the error.
+	Message string
+}
+
+func (err *SyntaxError) Error() string {
+	return fmt.Sprintf("regex parse error at offset %d: %s",
+		err.Offset, err.Message)
+}
+
+// nodeKind is the kind of a node in the syntax tree of a pattern.
+type nodeKind int
+
+const (
+	nodeEmpty nodeKind = iota
+	nodeLiteral
+	nodeDot
+	nodeClass
+	nodeAssertion
+	nodeRepetition
+	nodeGroup
+	nodeFlags
+	nodeConcat
+	nodeAlternation
+)
+
+// assertKind is the kind of an assertion, such as ^ or \b.
+type assertKind int
+
+const (
+	assertStartText assertKind = iota
+	assertEndText
+	assertStartLine
+	assertEndLine
+	assertWordBoundary
+	assertNotWordBoundary
+	assertWordStart
+	assertWordEnd
+	assertWordStartHalf
+	assertWordEndHalf
+)
+
+// node is a node in the syntax tree of a pattern, as parsed by parse.
+type node struct {
+	kind nodeKind
+	// start and end are the byte offsets of the node in the pattern.
+	start, end int
+	// flags are the flags in effect at the node, and crlf is true if CRLF
+	// mode, which has no Flag constant, is enabled. For a group, they are
+	// the flags in effect inside the group, and for a nodeFlags, they are
+	// the flags after it.
+	flags uint32
+	crlf  bool
+	subs  []*node
+
+	// lit is the codepoint of a nodeLiteral, or its byte if isByte is true.
+	lit    rune
+	isByte bool
+	// class is the class of a nodeClass.
+	class *classNode
+	// assert is the kind of a nodeAssertion.
+	assert assertKind
+	// min, max and greedy describe a nodeRepetition, whose max is -1 if it
+	// is unbounded. greedy takes the U flag into account.
+	min, max int
+	greedy   bool
+	// index is the index of a capturing nodeGroup, or 0 for a group that
+	// doesn't capture, and name is its name if it has one.
+	index int
+	name  string
+	// setFlags is the text of the flags set by a nodeFlags or by a nodeGroup
+	// like (?i:...), such as "i-u".
+	setFlags string
+}
+
+// classKind is the kind of a classNode.
+type classKind int
+
+const (
+	classBracket classKind = iota
+	classUnion
+	classOp
+	classRange
+	classPerl
+	classUnicode
+	classASCII
+)
+
+// classNode is a class, or a part of a bracketed class.
+type classNode struct {
+	kind classKind
+	// start and end are the byte offsets of the class in the pattern.
+	start, end int
+	// negated is true for a negated class, such as [^a], \D, \PL or
+	// [:^alpha:].
+	negated bool
+	// lo and hi are the bounds of a classRange, which is a single literal if
+	// they're equal.
+	lo, hi rune
+	// name is the letter of a classPerl, such as "d", the text of a
+	// classUnicode without its braces, such as "Greek", the name of a
+	// classASCII, such as "alpha", or the operator of a classOp, such as
+	// "&&".
+	name string
+	// items are the body of a classBracket, the members of a classUnion and
+	// the operands of a classOp.
+	items []*classNode
+}
+
+// parser is the state of a single call to parse.
+type parser struct {
+	pattern string
+	pos     int
+	flags   uint32
+	crlf    bool
+	// dialect is the syntax of the pattern.
+	dialect Dialect
+	// names has the name of every capturing group, in the order their
+	// opening parentheses appear, as reported by Regex.CaptureNames.
+	names []string
+}
+
+// parse parses a pattern in the syntax of Rust's regex crate, compiled with
+// the given flags, into a syntax tree. It returns the tree along with the
+// name of every capturing group, where unnamed groups have empty names.
+//
+// It is meant for patterns that are known to compile, and so it doesn't
+// find every error that the regex engine does.
+func parse(pattern string, flags uint32) (*node, []string, error) {
+	return parseDialect(pattern, flags, DialectRust)
+}
+
+// parseDialect is like parse, but for a pattern in the given dialect. The
+// tree of a Go or PCRE pattern is the tree of an equivalent Rust pattern, so
+// that, for example, Go's \d is parsed as [0-9].
+func parseDialect(pattern string, flags uint32, dialect Dialect) (
+	*node,
+	[]string,
+	error,
+) {
+	if !utf8.ValidString(pattern) {
+		return nil, nil, &SyntaxError{pattern, 0,
+			"pattern is not valid UTF-8"}
+	}
+	p := &parser{
+		pattern: pattern,
+		flags:   flags,
+		dialect: dialect,
+		names:   []string{""},
+	}
+	root, err := p.alternation()
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.pos < len(p.pattern) {
+		return nil, nil, p.errorf(p.pos, "unopened group")
+	}
+	return root, p.names, nil
+}
+
+func (p *parser) errorf(pos int, format string, args ...interface{}) error {
+	return &SyntaxError{p.pattern, pos, fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) peek(s string) bool {
+	return strings.HasPrefix(p.pattern[p.pos:], s)
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.pattern)
+}
+
+// skipSpace skips whitespace and comments when the x flag is enabled.
+func (p *parser) skipSpace() {
+	for p.flags&FlagSpace != 0 && !p.eof() {
+		r, size := utf8.DecodeRuneInString(p.pattern[p.pos:])
+		switch {
+		case unicode.IsSpace(r):
+			p.pos += size
+		case r == '#':
+			for !p.eof() && p.pattern[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) newNode(kind nodeKind, start int) *node {
+	return &node{
+		kind:  kind,
+		start: start,
+		end:   p.pos,
+		flags: p.flags,
+		crlf:  p.crlf,
+	}
+}
+
+// alternation parses alternatives up to the end of the enclosing group.
+func (p *parser) alternation() (*node, error) {
+	start, flags, crlf := p.pos, p.flags, p.crlf
+	var alts []*node
+	for {
+		alt, err := p.concat()
+		if err != nil {
+			return nil, err
+		}
+		alts = append(alts, alt)
+		if !p.peek("|") {
+			break
+		}
+		p.pos++
+	}
+	if len(alts) == 1 {
+		return alts[0], nil
+	}
+	n := p.newNode(nodeAlternation, start)
+	n.flags, n.crlf, n.subs = flags, crlf, alts
+	return n, nil
+}
+
+// concat parses a sequence of expressions up to the next alternative or the
+// end of the enclosing group.
+func (p *parser) concat() (*node, error) {
+	start, flags, crlf := p.pos, p.flags, p.crlf
+	var subs []*node
+	for {
+		p.skipSpace()
+		if p.eof() || p.peek("|") || p.peek(")") {
+			break
+		}
+		if p.dialect != DialectRust {
+			handled, err := p.dialectAtom(&subs)
+			if err != nil {
+				return nil, err
+			}
+			if handled {
+				continue
+			}
+		}
+		var n *node
+		var err error
+		at := p.pos
+		switch p.pattern[p.pos] {
+		case '(':
+			n, err = p.group()
+		case '[':
+			var class *classNode
+			if class, err = p.class(); err == nil {
+				n = p.newNode(nodeClass, at)
+				n.class = class
+			}
+		case '\\':
+			n, err = p.escape()
+		case '.':
+			p.pos++
+			n = p.newNode(nodeDot, at)
+		case '^', '$':
+			multi := p.flags&FlagMulti != 0
+			p.pos++
+			if p.dialect == DialectPCRE && p.pattern[at] == '$' && !multi {
+				err = p.pcreEndText(at)
+				break
+			}
+			n = p.newNode(nodeAssertion, at)
+			switch {
+			case p.pattern[at] == '^' && multi:
+				n.assert = assertStartLine
+			case p.pattern[at] == '^':
+				n.assert = assertStartText
+			case multi:
+				n.assert = assertEndLine
+			default:
+				n.assert = assertEndText
+			}
+		case '*', '+', '?', '{':
+			last := len(subs) - 1
+			if last < 0 || subs[last].kind == nodeFlags {
+				return nil, p.errorf(at,
+					"repetition operator missing expression")
+			}
+			if p.dialect != DialectRust && subs[last].kind == nodeRepetition {
+				return nil, p.errorf(at, "nested repetition operator")
+			}
+			if subs[last], err = p.repetition(subs[last]); err != nil {
+				return nil, err
+			}
+			continue
+		default:
+			r, size := utf8.DecodeRuneInString(p.pattern[p.pos:])
+			p.pos += size
+			n = p.newNode(nodeLiteral, at)
+			n.lit = r
+		}
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, n)
+	}
+	switch len(subs) {
+	case 0:
+		n := p.newNode(nodeEmpty, start)
+		n.flags, n.crlf = flags, crlf
+		return n, nil
+	case 1:
+		return subs[0], nil
+	}
+	n := p.newNode(nodeConcat, start)
+	n.flags, n.crlf, n.subs = flags, crlf, subs
+	return n, nil
+}
+
+// repetition parses a repetition operator applied to sub.
+func (p *parser) repetition(sub *node) (*node, error) {
+	at := p.pos
+	n := &node{kind: nodeRepetition, start: sub.start, subs: []*node{sub}}
+	switch p.pattern[p.pos] {
+	case '*':
+		n.min, n.max = 0, -1
+	case '+':
+		n.min, n.max = 1, -1
+	case '?':
+		n.min, n.max = 0, 1
+	case '{':
+		p.pos++
+		var err error
+		if n.min, n.max, err = p.counted(at); err != nil {
+			return nil, err
+		}
+		// counted leaves the position on the closing brace.
+	}
+	p.pos++
+	n.greedy = true
+	if p.peek("?") {
+		n.greedy = false
+		p.pos++
+	}
+	if p.dialect == DialectPCRE && p.peek("+") {
+		return nil, p.errorf(p.pos, "possessive quantifiers are not supported")
+	}
+	if p.flags&FlagSwapGreed != 0 {
+		n.greedy = !n.greedy
+	}
+	n.end, n.flags, n.crlf = p.pos, p.flags, p.crlf
+	return n, nil
+}
+
+// counted parses the bounds of a counted repetition that starts at start,
+// up to its closing brace.
+func (p *parser) counted(start int) (min, max int, err error) {
+	decimal := func() (int, bool) {
+		p.skipSpace()
+		i := p.pos
+		for !p.eof() && p.pattern[p.pos] >= '0' && p.pattern[p.pos] <= '9' {
+			p.pos++
+		}
+		n, err := strconv.Atoi(p.pattern[i:p.pos])
+		p.skipSpace()
+		return n, err == nil
+	}
+	min, ok := decimal()
+	if !ok {
+		return 0, 0, p.errorf(start,
+			"repetition quantifier expects a valid decimal")
+	}
+	max = min
+	if p.peek(",") {
+		p.pos++
+		p.skipSpace()
+		if p.peek("}") {
+			max = -1
+		} else if max, ok = decimal(); !ok {
+			return 0, 0, p.errorf(start,
+				"repetition quantifier expects a valid decimal")
+		}
+	}
+	if !p.peek("}") {
+		return 0, 0, p.errorf(start, "unclosed counted repetition")
+	}
+	if max >= 0 && min > max {
+		return 0, 0, p.errorf(start, "invalid repetition count range, "+
+			"the start must be <= the end")
+	}
+	return min, max, nil
+}
+
+// group parses a group, or a group of flags like (?i) that sets flags for
+// the rest of the enclosing group.
+func (p *parser) group() (*node, error) {
+	start, flags, crlf := p.pos, p.flags, p.crlf
+	p.pos++
+	if p.dialect == DialectRust {
+		p.skipSpace()
+	} else if err := p.dialectGroup(start); err != nil {
+		return nil, err
+	}
+	index, name, setFlags := 0, "", ""
+	switch {
+	case (p.peek("?P<") || p.peek("?<")) && !p.peek("?<=") && !p.peek("?<!"),
+		p.dialect == DialectPCRE && p.peek("?'"):
+		open := strings.IndexAny(p.pattern[p.pos:], "<'")
+		closing := map[byte]byte{'<': '>', '\'': '\''}[p.pattern[p.pos+open]]
+		p.pos += open + 1
+		end := strings.IndexByte(p.pattern[p.pos:], closing)
+		if end < 0 {
+			return nil, p.errorf(start, "unclosed capture group name")
+		}
+		name = p.pattern[p.pos : p.pos+end]
+		if name == "" {
+			return nil, p.errorf(p.pos, "empty capture group name")
+		}
+		if p.dialect != DialectRust && !isWordName(name) {
+			return nil, p.errorf(p.pos, "invalid capture group name")
+		}
+		for _, other := range p.names {
+			if other == name {
+				return nil, p.errorf(p.pos, "duplicate capture group name")
+			}
+		}
+		p.pos += end + 1
+		index = len(p.names)
+		p.names = append(p.names, name)
+	case p.peek("?=") || p.peek("?!") || p.peek("?<=") || p.peek("?<!"):
+		return nil, p.errorf(start, "look-around is not supported")
+	case p.peek("?"):
+		p.pos++
+		at := p.pos
+		if err := p.setFlags(); err != nil {
+			return nil, err
+		}
+		setFlags = p.pattern[at:p.pos]
+		if p.peek(")") {
+			p.pos++
+			n := p.newNode(nodeFlags, start)
+			n.setFlags = setFlags
+			return n, nil
+		}
+		p.pos++ // The colon.
+	default:
+		index = len(p.names)
+		p.names = append(p.names, "")
+	}
+	inner, innerCRLF := p.flags, p.crlf
+	sub, err := p.alternation()
+	if err != nil {
+		return nil, err
+	}
+	if !p.peek(")") {
+		return nil, p.errorf(start, "unclosed group")
+	}
+	p.pos++
+	p.flags, p.crlf = flags, crlf
+	n := p.newNode(nodeGroup, start)
+	n.flags, n.crlf = inner, innerCRLF
+	n.index, n.name, n.setFlags = index, name, setFlags
+	n.subs = []*node{sub}
+	return n, nil
+}
+
+// setFlags parses the flags of a group up to the colon or closing
+// parenthesis that ends them, and sets them.
+func (p *parser) setFlags() error {
+	negate := false
+	for !p.eof() {
+		c := p.pattern[p.pos]
+		var flag uint32
+		if c != ':' && c != ')' && c != '-' && !p.flagAllowed(c) {
+			return p.errorf(p.pos, "unrecognized flag")
+		}
+		switch c {
+		case ':', ')':
+			if negate && p.pattern[p.pos-1] == '-' {
+				return p.errorf(p.pos-1, "dangling flag negation operator")
+			}
+			return nil
+		case '-':
+			negate = true
+		case 'R':
+			p.crlf = !negate
+		default:
+			var ok bool
+			if flag, ok = inlineflags.Flag(rune(c)); !ok {
+				return p.errorf(p.pos, "unrecognized flag")
+			}
+		}
+		if negate {
+			p.flags &^= flag
+		} else {
+			p.flags |= flag
+		}
+		p.pos++
+	}
+	return p.errorf(p.pos, "unclosed group")
+}
+
+// escape parses an escape sequence outside of a bracketed class.
+func (p *parser) escape() (*node, error) {
+	if p.dialect != DialectRust {
+		return p.dialectEscape()
+	}
+	start := p.pos
+	if p.peek(`\b{`) {
+		end := strings.IndexByte(p.pattern[p.pos:], '}')
+		if end >= 0 {
+			kinds := map[string]assertKind{
+				"start":      assertWordStart,
+				"end":        assertWordEnd,
+				"start-half": assertWordStartHalf,
+				"end-half":   assertWordEndHalf,
+			}
+			kind, ok := kinds[p.pattern[p.pos+3:p.pos+end]]
+			if !ok {
+				return nil, p.errorf(start, "unrecognized special word "+
+					"boundary assertion")
+			}
+			p.pos += end + 1
+			n := p.newNode(nodeAssertion, start)
+			n.assert = kind
+			return n, nil
+		}
+	}
+	if p.pos+1 < len(p.pattern) {
+		assertions := map[byte]assertKind{
+			'A': assertStartText,
+			'z': assertEndText,
+			'b': assertWordBoundary,
+			'B': assertNotWordBoundary,
+			'<': assertWordStart,
+			'>': assertWordEnd,
+		}
+		if kind, ok := assertions[p.pattern[p.pos+1]]; ok {
+			p.pos += 2
+			n := p.newNode(nodeAssertion, start)
+			n.assert = kind
+			return n, nil
+		}
+	}
+	lit, isByte, class, err := p.classEscape()
+	if err != nil {
+		return nil, err
+	}
+	if class != nil {
+		n := p.newNode(nodeClass, start)
+		n.class = class
+		return n, nil
+	}
+	n := p.newNode(nodeLiteral, start)
+	n.lit, n.isByte = lit, isByte
+	return n, nil
+}
+
+// classEscape parses an escape sequence that is a literal or a class, which
+// are the escape sequences that may be used in a bracketed class. If it is a
+// class, then the class is returned, and otherwise the literal is returned.
+// A literal is a byte rather than a codepoint if isByte is true.
+func (p *parser) classEscape() (
+	lit rune,
+	isByte bool,
+	class *classNode,
+	err error,
+) {
+	if p.dialect != DialectRust {
+		return p.dialectClassEscape(true)
+	}
+	start := p.pos
+	p.pos++
+	if p.eof() {
+		return 0, false, nil, p.errorf(start, "incomplete escape sequence, "+
+			"reached end of pattern prematurely")
+	}
+	c := p.pattern[p.pos]
+	switch c {
+	case 'd', 's', 'w', 'D', 'S', 'W':
+		p.pos++
+		class = &classNode{
+			kind:    classPerl,
+			start:   start,
+			end:     p.pos,
+			negated: c < 'a',
+			name:    string(c | 0x20),
+		}
+		return 0, false, class, nil
+	case 'p', 'P':
+		p.pos++
+		var name string
+		if p.peek("{") {
+			end := strings.IndexByte(p.pattern[p.pos:], '}')
+			if end < 0 {
+				return 0, false, nil, p.errorf(start, "unclosed Unicode class")
+			}
+			name = p.pattern[p.pos+1 : p.pos+end]
+			if p.flags&FlagSpace != 0 {
+				name = strings.Join(strings.Fields(name), "")
+			}
+			p.pos += end + 1
+		} else if !p.eof() {
+			_, size := utf8.DecodeRuneInString(p.pattern[p.pos:])
+			name = p.pattern[p.pos : p.pos+size]
+			p.pos += size
+		}
+		class = &classNode{
+			kind:    classUnicode,
+			start:   start,
+			end:     p.pos,
+			negated: c == 'P',
+			name:    name,
+		}
+		return 0, false, class, nil
+	case 'x', 'u', 'U':
+		return p.hex(start)
+	case 'a':
+		lit = '\a'
+	case 'f':
+		lit = '\f'
+	case 't':
+		lit = '\t'
+	case 'n':
+		lit = '\n'
+	case 'r':
+		lit = '\r'
+	case 'v':
+		lit = '\v'
+	default:
+		switch {
+		case c >= '0' && c <= '9':
+			return 0, false, nil, p.errorf(start,
+				"backreferences are not supported")
+		case c < utf8.RuneSelf && c != '<' && c != '>' &&
+			!unicode.IsLetter(rune(c)):
+			lit = rune(c)
+		default:
+			return 0, false, nil, p.errorf(start,
+				"unrecognized escape sequence")
+		}
+	}
+	p.pos++
+	return lit, false, nil, nil
+}
+
+// hex parses the \x, \u and \U escapes, in either their fixed width or their
+// braced forms.
+func (p *parser) hex(start int) (
+	lit rune,
+	isByte bool,
+	class *classNode,
+	err error,
+) {
+	width := map[byte]int{'x': 2, 'u': 4, 'U': 8}[p.pattern[p.pos]]
+	p.pos++
+	var digits string
+	if p.peek("{") {
+		end := strings.IndexByte(p.pattern[p.pos:], '}')
+		if end < 0 {
+			return 0, false, nil, p.errorf(start,
+				"unclosed hexadecimal escape")
+		}
+		digits = strings.TrimSpace(p.pattern[p.pos+1 : p.pos+end])
+		p.pos += end + 1
+	} else {
+		if p.pos+width > len(p.pattern) {
+			return 0, false, nil, p.errorf(start, "incomplete escape "+
+				"sequence, reached end of pattern prematurely")
+		}
+		digits = p.pattern[p.pos : p.pos+width]
+		p.pos += width
+	}
+	cp, perr := strconv.ParseUint(digits, 16, 32)
+	if perr != nil || cp > unicode.MaxRune || cp >= 0xD800 && cp <= 0xDFFF {
+		return 0, false, nil, p.errorf(start,
+			"hexadecimal literal is not a Unicode scalar value")
+	}
+	// When Unicode mode is disabled, escapes match bytes.
+	isByte = p.flags&FlagUnicode == 0 && cp > unicode.MaxASCII && cp <= 0xFF
+	return rune(cp), isByte, nil, nil
+}
+
+// class parses a bracketed class.
+func (p *parser) class() (*classNode, error) {
+	start := p.pos
+	p.pos++
+	p.classSpace()
+	negated := false
+	if p.peek("^") {
+		negated = true
+		p.pos++
+	}
+	// The first operand may start with ], which is then a literal.
+	body, err := p.classUnion(true)
+	for err == nil {
+		p.classSpace()
+		op := p.classOp()
+		if op == "" {
+			break
+		}
+		p.pos += len(op)
+		var rhs *classNode
+		if rhs, err = p.classUnion(false); err == nil {
+			body = &classNode{
+				kind:  classOp,
+				start: body.start,
+				end:   rhs.end,
+				name:  op,
+				items: []*classNode{body, rhs},
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !p.peek("]") {
+		return nil, p.errorf(start, "unclosed character class")
+	}
+	p.pos++
+	return &classNode{
+		kind:    classBracket,
+		start:   start,
+		end:     p.pos,
+		negated: negated,
+		items:   []*classNode{body},
+	}, nil
+}
+
+// classOp returns the class set operator at the current position, if any.
+func (p *parser) classOp() string {
+	if p.dialect != DialectRust {
+		return ""
+	}
+	for _, op := range []string{"&&", "--", "~~"} {
+		if p.peek(op) {
+			return op
+		}
+	}
+	return ""
+}
+
+// classUnion parses the members of a bracketed class up to the end of the
+// class or the next set operator. If first is true, then a ] at the start
+// is a literal.
+func (p *parser) classUnion(first bool) (*classNode, error) {
+	p.classSpace()
+	union := &classNode{kind: classUnion, start: p.pos, end: p.pos}
+	for {
+		p.classSpace()
+		if p.eof() {
+			return nil, p.errorf(union.start, "unclosed character class")
+		}
+		if !first && (p.peek("]") || p.classOp() != "") {
+			return union, nil
+		}
+		item, err := p.classItem(first)
+		if err != nil {
+			return nil, err
+		}
+		first = false
+		union.items = append(union.items, item)
+		union.end = item.end
+	}
+}
+
+// classItem parses a single member of a bracketed class, which is a literal,
+// a range, a nested class or an escaped class. If first is true, then a ] is
+// a literal.
+func (p *parser) classItem(first bool) (*classNode, error) {
+	start := p.pos
+	if p.peek("[") {
+		if class := p.asciiClass(); class != nil {
+			return class, nil
+		}
+		switch {
+		case p.dialect == DialectRust:
+			return p.class()
+		case p.dialect == DialectPCRE && (p.peek("[:<:]") || p.peek("[:>:]")):
+			return nil, p.errorf(p.pos, "word boundary %s is not supported",
+				p.pattern[p.pos:p.pos+5])
+		}
+		// Other dialects don't nest classes, so the [ is a literal.
+	}
+	lo, isClass, err := p.classLiteral(first)
+	if err != nil || isClass != nil {
+		return isClass, err
+	}
+	item := &classNode{
+		kind:  classRange,
+		start: start,
+		end:   p.pos,
+		lo:    lo,
+		hi:    lo,
+	}
+
+	// A - that isn't followed by the end of the class makes a range.
+	save := p.pos
+	p.classSpace()
+	if !p.peek("-") || p.dialect == DialectRust && p.peek("--") {
+		p.pos = save
+		return item, nil
+	}
+	p.pos++
+	p.classSpace()
+	if p.eof() || p.peek("]") {
+		p.pos = save
+		return item, nil
+	}
+	at := p.pos
+	hi, isClass, err := p.classLiteral(false)
+	if err != nil {
+		return nil, err
+	}
+	if isClass != nil {
+		return nil, p.errorf(at, "invalid range boundary, must be a literal")
+	}
+	if hi < lo {
+		return nil, p.errorf(start, "invalid character class range, the "+
+			"start must be <= the end")
+	}
+	item.hi, item.end = hi, p.pos
+	return item, nil
+}
+
+// classSpace skips whitespace and comments in a bracketed class when the x
+// flag is enabled. Only Rust's x flag applies inside classes.
+func (p *parser) classSpace() {
+	if p.dialect == DialectRust {
+		p.skipSpace()
+	}
+}
+
+// classLiteral parses a literal in a bracketed class, or a class if the
+// literal turns out to be an escaped class like \d.
+func (p *parser) classLiteral(first bool) (rune, *classNode, error) {
+	if p.peek(`\`) {
+		start := p.pos
+		lit, _, class, err := p.classEscape()
+		if err != nil {
+			if p.pos > start+1 && strings.Contains("AzbB<>",
+				string(p.pattern[start+1])) {
+				err = p.errorf(start,
+					"invalid escape sequence found in character class")
+			}
+			return 0, nil, err
+		}
+		return lit, class, nil
+	}
+	r, size := utf8.DecodeRuneInString(p.pattern[p.pos:])
+	if r == ']' && !first {
+		return 0, nil, p.errorf(p.pos, "unexpected ]")
+	}
+	p.pos += size
+	return r, nil, nil
+}
+
+// asciiClass parses an ASCII class like [:alpha:] if there is one at the
+// current position, and returns nil otherwise.
+func (p *parser) asciiClass() *classNode {
+	if !p.peek("[:") {
+		return nil
+	}
+	end := strings.Index(p.pattern[p.pos:], ":]")
+	if end < 0 {
+		return nil
+	}
+	name := p.pattern[p.pos+2 : p.pos+end]
+	negated := strings.HasPrefix(name, "^")
+	name = strings.TrimPrefix(name, "^")
+	if _, ok := asciiClasses[name]; !ok {
+		return nil
+	}
+	start := p.pos
+	p.pos += end + 2
+	return &classNode{
+		kind:    classASCII,
+		start:   start,
+		end:     p.pos,
+		negated: negated,
+		name:    name,
+	}
+}
+
+// classRanges returns the ranges of codepoints matched by a class with the
+// given flags, or of bytes if Unicode mode is disabled. It returns false if
+// the class uses Unicode tables that Go doesn't have.
+func classRanges(c *classNode, flags uint32) ([]RuneRange, bool) {
+	unicodeMode := flags&FlagUnicode != 0
+	var ranges []RuneRange
+	negated := c.negated
+	switch c.kind {
+	case classBracket:
+		body, ok := classRanges(c.items[0], flags)
+		if !ok {
+			return nil, false
+		}
+		ranges = body
+	case classUnion:
+		for _, item := range c.items {
+			more, ok := classRanges(item, flags)
+			if !ok {
+				return nil, false
+			}
+			ranges = append(ranges, more...)
+		}
+		return normalizeRanges(ranges), true
+	case classOp:
+		lhs, ok := classRanges(c.items[0], flags)
+		if !ok {
+			return nil, false
+		}
+		rhs, ok := classRanges(c.items[1], flags)
+		if !ok {
+			return nil, false
+		}
+		switch c.name {
+		case "&&":
+			return intersectRanges(lhs, rhs), true
+		case "--":
+			return subtractRanges(lhs, rhs), true
+		default:
+			return symmetricDifferenceRanges(lhs, rhs), true
+		}
+	case classRange:
+		ranges = []RuneRange{{c.lo, c.hi}}
+	case classPerl:
+		ranges = perlRanges(c.name[0], unicodeMode)
+	case classASCII:
+		ranges = asciiClasses[c.name]
+	case classUnicode:
+		var ok bool
+		if ranges, ok = unicodeClassRanges(c.name); !ok {
+			return nil, false
+		}
+	}
+	if c.kind != classBracket && flags&FlagCaseI != 0 {
+		ranges = foldRanges(ranges, !unicodeMode)
+	}
+	if negated {
+		if unicodeMode {
+			ranges = subtractRanges(negateRanges(ranges, maxRune), surrogates)
+		} else {
+			ranges = negateRanges(ranges, maxByte)
+		}
+	}
+	return ranges, true
+}
+
+// dotRanges returns the ranges of codepoints matched by ., or of bytes if
+// Unicode mode is disabled.
+func dotRanges(flags uint32, crlf bool) []RuneRange {
+	var ranges []RuneRange
+	if flags&FlagUnicode != 0 {
+		ranges = []RuneRange{{0, 0xD7FF}, {0xE000, maxRune}}
+	} else {
+		ranges = []RuneRange{{0, maxByte}}
+	}
+	if flags&FlagDotNL != 0 {
+		return ranges
+	}
+	excluded := []RuneRange{{'\n', '\n'}}
+	if crlf {
+		excluded = []RuneRange{{'\n', '\n'}, {'\r', '\r'}}
+	}
+	return subtractRanges(ranges, excluded)
+}
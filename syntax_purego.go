@@ -0,0 +1,30 @@
+//go:build !cgo || purego
+// +build !cgo purego
+
+package rure
+
+import "github.com/BurntSushi/rure-go/internal/inlineflags"
+
+// translate rewrites pattern, written in the syntax of Rust's regex crate
+// and compiled with the given flags, into the syntax of Go's regexp package.
+//
+// It is Translate from DialectRust to DialectGo, except that pattern is
+// compiled with flags rather than FlagDefault, and is parsed rather than
+// compiled by the regex engine first, so that errors in it are reported by
+// the parser, or by Go's regexp package for the translated pattern.
+func translate(pattern string, flags uint32) (string, error) {
+	root, _, err := parse(pattern, flags)
+	if err != nil {
+		return "", &Error{msg: err.Error()}
+	}
+	pr := &dialectPrinter{pattern: pattern, dialect: DialectGo}
+	if on := inlineflags.Format(flags & pr.flagMask()); on != "" {
+		pr.out.WriteString("(?" + on + ")")
+	}
+	pr.flags = flags & pr.flagMask()
+	if err := pr.node(root); err != nil {
+		return "", &Error{msg: err.Error() +
+			" (not supported by the pure Go fallback)"}
+	}
+	return pr.out.String(), nil
+}
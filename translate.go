@@ -0,0 +1,1018 @@
+package rure
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/rure-go/internal/inlineflags"
+)
+
+// Dialect is the syntax of a regular expression library.
+type Dialect int
+
+const (
+	// DialectRust is the syntax of Rust's regex crate, which is used by this
+	// package.
+	DialectRust Dialect = iota
+	// DialectGo is the syntax of Go's regexp package, which is RE2's syntax.
+	DialectGo
+	// DialectPCRE is the syntax of PCRE2 in UTF mode, without the UCP option
+	// that makes \d, \s, \w and \b Unicode-aware.
+	DialectPCRE
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case DialectRust:
+		return "Rust"
+	case DialectGo:
+		return "Go"
+	case DialectPCRE:
+		return "PCRE"
+	}
+	return fmt.Sprintf("Dialect(%d)", int(d))
+}
+
+// Translate rewrites pattern from the syntax of one dialect into the syntax
+// of another, such that the result matches the same text. Rust patterns are
+// those compiled with FlagDefault.
+//
+// Syntax with the same meaning is kept, and syntax whose meaning differs
+// between the dialects is rewritten. For example, \d, \w and \s are ASCII-only
+// in Go and PCRE, and so Go's \d becomes [0-9] in Rust, and Rust's \d becomes
+// \p{Nd} in Go. Likewise, Go's \b becomes (?-u:\b) in Rust. Whitespace and
+// comments allowed by the x flag are removed.
+//
+// Syntax that has no equivalent in the other dialect is rejected with a
+// *SyntaxError at its offset in pattern. This includes the backreferences,
+// look-around, atomic groups and possessive quantifiers of PCRE, the
+// Unicode-aware word boundaries of Rust and Rust's ability to match
+// arbitrary bytes when Unicode mode is disabled. It also includes PCRE's \Z,
+// and $ outside of multi-line mode, which match before a new line at the end
+// of the text as well as at the end. Unicode classes that the other dialect
+// doesn't have are expanded using the tables of Go's unicode package, when
+// possible.
+//
+// Errors in a Rust pattern are reported by the regex engine, and errors in a
+// Go pattern are reported by Go's regexp/syntax package. PCRE patterns are
+// only checked as far as translation requires.
+func Translate(pattern string, from, to Dialect) (string, error) {
+	if from == DialectRust {
+		if _, err := CompileOptions(pattern, FlagDefault, nil); err != nil {
+			return "", err
+		}
+	}
+	root, _, err := parseDialect(pattern, FlagDefault, from)
+	if err != nil {
+		return "", err
+	}
+	if from == DialectGo {
+		if err := checkGoSyntax(pattern); err != nil {
+			return "", err
+		}
+	}
+	if from == to {
+		return pattern, nil
+	}
+
+	pr := &dialectPrinter{pattern: pattern, dialect: to}
+	if to == DialectRust {
+		pr.flags = FlagDefault
+	}
+	if err := pr.node(root); err != nil {
+		return "", err
+	}
+	translated := pr.out.String()
+	switch to {
+	case DialectRust:
+		_, err = CompileOptions(translated, FlagDefault, nil)
+	case DialectGo:
+		err = checkGoSyntax(translated)
+	}
+	if err != nil {
+		return "", fmt.Errorf("rure: translating %q from %s to %s gave %q, "+
+			"which is invalid: %w", pattern, from, to, translated, err)
+	}
+	return translated, nil
+}
+
+// checkGoSyntax returns an error if pattern isn't valid in Go's syntax.
+func checkGoSyntax(pattern string) error {
+	_, err := syntax.Parse(pattern, syntax.Perl)
+	serr, ok := err.(*syntax.Error)
+	if !ok {
+		return err
+	}
+	// Go reports the text of the error rather than its offset.
+	offset := strings.Index(pattern, serr.Expr)
+	if offset < 0 {
+		offset = 0
+	}
+	message := fmt.Sprintf("%s: `%s`", serr.Code, serr.Expr)
+	return &SyntaxError{pattern, offset, message}
+}
+
+// countedRepetition matches a counted repetition like {2,5}. In Go and PCRE,
+// a { that doesn't start one is a literal.
+var countedRepetition = regexp.MustCompile(`^\{[0-9]+(,[0-9]*)?\}`)
+
+// dialectAtom parses syntax at the current position that only Go and PCRE
+// have, and appends its nodes to subs. It returns false if there is none.
+func (p *parser) dialectAtom(subs *[]*node) (bool, error) {
+	start := p.pos
+	switch {
+	case p.dialect == DialectPCRE && p.peek("(?#"):
+		end := strings.IndexByte(p.pattern[p.pos:], ')')
+		if end < 0 {
+			return true, p.errorf(start, "unclosed comment")
+		}
+		p.pos += end + 1
+	case p.dialect == DialectPCRE && p.peek("(*"):
+		return true, p.errorf(start,
+			"backtracking control verbs are not supported")
+	case p.peek(`\Q`):
+		// Everything up to \E, or the end of the pattern, is literal.
+		p.pos += 2
+		end := strings.Index(p.pattern[p.pos:], `\E`)
+		if end < 0 {
+			end = len(p.pattern) - p.pos
+		}
+		for _, r := range p.pattern[p.pos : p.pos+end] {
+			at := p.pos
+			p.pos += utf8.RuneLen(r)
+			n := p.newNode(nodeLiteral, at)
+			n.lit = r
+			*subs = append(*subs, n)
+		}
+		if p.peek(`\E`) {
+			p.pos += 2
+		}
+	case p.dialect == DialectPCRE && p.peek(`\E`):
+		p.pos += 2
+	case p.peek("{") && !countedRepetition.MatchString(p.pattern[p.pos:]):
+		p.pos++
+		n := p.newNode(nodeLiteral, start)
+		n.lit = '{'
+		*subs = append(*subs, n)
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// dialectGroup rejects the groups of Go and PCRE that have no equivalent.
+// The position is just after the opening parenthesis at start.
+func (p *parser) dialectGroup(start int) error {
+	for _, group := range []struct {
+		prefix, message string
+	}{
+		{"?>", "atomic groups are not supported"},
+		{"?|", "branch reset groups are not supported"},
+		{"?P=", "backreferences are not supported"},
+		{"?P>", "recursion is not supported"},
+		{"?&", "recursion is not supported"},
+		{"?R", "recursion is not supported"},
+		{"?(", "conditionals are not supported"},
+		{"?C", "callouts are not supported"},
+		{"?^", "(?^) is not supported"},
+	} {
+		if p.peek(group.prefix) {
+			return p.errorf(start, group.message)
+		}
+	}
+	rest := strings.TrimLeft(strings.TrimPrefix(p.pattern[p.pos:], "?"), "+-")
+	if p.peek("?") && rest != "" && rest[0] >= '0' && rest[0] <= '9' {
+		return p.errorf(start, "recursion is not supported")
+	}
+	return nil
+}
+
+// flagAllowed returns true if c is an inline flag of the dialect.
+func (p *parser) flagAllowed(c byte) bool {
+	switch p.dialect {
+	case DialectGo:
+		return strings.IndexByte("imsU", c) >= 0
+	case DialectPCRE:
+		return strings.IndexByte("imsxU", c) >= 0
+	}
+	return true
+}
+
+// isWordName returns true if name is made of ASCII letters, digits and
+// underscores, which are the only characters that Go and PCRE allow in the
+// name of a capturing group.
+func isWordName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if !isWordByte(name[i]) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' ||
+		c >= 'A' && c <= 'Z'
+}
+
+// dialectEscape parses an escape sequence of Go or PCRE outside of a
+// bracketed class.
+func (p *parser) dialectEscape() (*node, error) {
+	start := p.pos
+	pcre := p.dialect == DialectPCRE
+	if p.pos+1 < len(p.pattern) {
+		c := p.pattern[p.pos+1]
+		switch {
+		case strings.IndexByte("AzbB", c) >= 0:
+			p.pos += 2
+			n := p.newNode(nodeAssertion, start)
+			n.assert = map[byte]assertKind{
+				'A': assertStartText,
+				'z': assertEndText,
+				'b': assertWordBoundary,
+				'B': assertNotWordBoundary,
+			}[c]
+			if c == 'b' || c == 'B' {
+				// Word boundaries are always ASCII-only.
+				n.flags &^= FlagUnicode
+			}
+			return n, nil
+		case pcre && c == 'Z':
+			p.pos += 2
+			return nil, p.pcreEndText(start)
+		case pcre && strings.IndexByte("GKXC", c) >= 0:
+			return nil, p.errorf(start, "%s is not supported", map[byte]string{
+				'G': `\G (the end of the previous match)`,
+				'K': `\K (resetting the start of the match)`,
+				'X': `\X (an extended grapheme cluster)`,
+				'C': `\C (a single byte)`,
+			}[c])
+		case pcre && c == 'R':
+			p.pos += 2
+			return p.newlineSequence(start), nil
+		case pcre && c == 'N' && !p.peek(`\N{`):
+			// \N is any character but a new line, regardless of the s flag.
+			p.pos += 2
+			n := p.newNode(nodeClass, start)
+			n.class = rangesClass(start, p.pos, true,
+				[]RuneRange{{'\n', '\n'}})
+			return n, nil
+		}
+	}
+	lit, _, class, err := p.dialectClassEscape(false)
+	if err != nil {
+		return nil, err
+	}
+	if class != nil {
+		n := p.newNode(nodeClass, start)
+		n.class = class
+		if pcre && class.kind == classBracket {
+			// PCRE doesn't fold the case of its Perl classes, so that (?i)\w
+			// doesn't match the Kelvin sign.
+			n.flags &^= FlagCaseI
+		}
+		return n, nil
+	}
+	n := p.newNode(nodeLiteral, start)
+	n.lit = lit
+	return n, nil
+}
+
+// pcreEndText returns the error for PCRE's $ outside of multi-line mode, or
+// for \Z, at start, which match at the end of the text or before a new line
+// at the end of the text. No other dialect can match before that new line
+// without look-ahead, and \n?\z would include the new line in the match.
+func (p *parser) pcreEndText(start int) error {
+	return p.errorf(start, "%s also matches before a new line at the end "+
+		"of the text, which has no equivalent; use "+`\z to match only at `+
+		`the end of the text, or \n?\z to include a final new line in the `+
+		"match", p.pattern[start:p.pos])
+}
+
+// newlineSequence returns the tree of PCRE's \R, which matches any new line
+// sequence, at start.
+func (p *parser) newlineSequence(start int) *node {
+	crlf := []*node{p.newNode(nodeLiteral, start), p.newNode(nodeLiteral, start)}
+	crlf[0].lit, crlf[1].lit = '\r', '\n'
+	alts := []*node{p.newNode(nodeConcat, start), p.newNode(nodeClass, start)}
+	alts[0].subs = crlf
+	alts[1].class = rangesClass(start, p.pos, false, []RuneRange{
+		{'\n', '\r'}, {0x85, 0x85}, {0x2028, 0x2029},
+	})
+	alt := p.newNode(nodeAlternation, start)
+	alt.subs = alts
+	n := p.newNode(nodeGroup, start)
+	n.subs = []*node{alt}
+	return n
+}
+
+// rangesClass returns a bracketed class of the given ranges.
+func rangesClass(start, end int, negated bool, ranges []RuneRange) *classNode {
+	union := &classNode{kind: classUnion, start: start, end: end}
+	for _, r := range ranges {
+		union.items = append(union.items, &classNode{
+			kind:  classRange,
+			start: start,
+			end:   end,
+			lo:    r.Lo,
+			hi:    r.Hi,
+		})
+	}
+	return &classNode{
+		kind:    classBracket,
+		start:   start,
+		end:     end,
+		negated: negated,
+		items:   []*classNode{union},
+	}
+}
+
+// dialectPerlRanges returns the ranges of the ASCII-only Perl classes of Go
+// and PCRE, such as \d, along with PCRE's \h and \v, by their letter.
+func dialectPerlRanges(dialect Dialect, c byte) []RuneRange {
+	switch c {
+	case 'd':
+		return []RuneRange{{'0', '9'}}
+	case 'w':
+		return []RuneRange{{'0', '9'}, {'A', 'Z'}, {'_', '_'}, {'a', 'z'}}
+	case 's':
+		// Go's \s doesn't include the vertical tab.
+		if dialect == DialectGo {
+			return []RuneRange{{'\t', '\n'}, {'\f', '\r'}, {' ', ' '}}
+		}
+		return []RuneRange{{'\t', '\r'}, {' ', ' '}}
+	case 'h':
+		return []RuneRange{
+			{'\t', '\t'}, {' ', ' '}, {0xA0, 0xA0}, {0x1680, 0x1680},
+			{0x180E, 0x180E}, {0x2000, 0x200A}, {0x202F, 0x202F},
+			{0x205F, 0x205F}, {0x3000, 0x3000},
+		}
+	default:
+		return []RuneRange{{'\n', '\r'}, {0x85, 0x85}, {0x2028, 0x2029}}
+	}
+}
+
+// dialectClassEscape is like classEscape, but for Go and PCRE. inClass is
+// true for an escape sequence in a bracketed class.
+func (p *parser) dialectClassEscape(inClass bool) (
+	lit rune,
+	isByte bool,
+	class *classNode,
+	err error,
+) {
+	start := p.pos
+	p.pos++
+	if p.eof() {
+		return 0, false, nil, p.errorf(start, "incomplete escape sequence, "+
+			"reached end of pattern prematurely")
+	}
+	c := p.pattern[p.pos]
+	pcre := p.dialect == DialectPCRE
+	literals := map[byte]rune{
+		'a': '\a',
+		'f': '\f',
+		't': '\t',
+		'n': '\n',
+		'r': '\r',
+	}
+	if pcre {
+		literals['e'] = 0x1B
+		if inClass {
+			literals['b'] = '\b'
+		}
+	} else {
+		literals['v'] = '\v'
+	}
+	switch {
+	case strings.IndexByte("dswDSW", c) >= 0,
+		pcre && strings.IndexByte("hvHV", c) >= 0:
+		p.pos++
+		ranges := dialectPerlRanges(p.dialect, c|0x20)
+		return 0, false, rangesClass(start, p.pos, c < 'a', ranges), nil
+	case c == 'p' || c == 'P':
+		return p.dialectUnicodeClass(start)
+	case c == 'x':
+		return p.dialectHex(start)
+	case pcre && c == 'o':
+		p.pos++
+		end := strings.IndexByte(p.pattern[p.pos:], '}')
+		if !p.peek("{") || end < 0 {
+			return 0, false, nil, p.errorf(start, "unclosed octal escape")
+		}
+		cp, perr := strconv.ParseUint(p.pattern[p.pos+1:p.pos+end], 8, 32)
+		p.pos += end + 1
+		return p.scalarValue(start, cp, perr)
+	case c >= '0' && c <= '9':
+		return p.octal(start, inClass)
+	case pcre && (c == 'g' || c == 'k'):
+		return 0, false, nil, p.errorf(start,
+			"backreferences are not supported")
+	case pcre && c == 'c':
+		p.pos++
+		if p.eof() || p.pattern[p.pos] >= utf8.RuneSelf {
+			return 0, false, nil, p.errorf(start,
+				`\c must be followed by an ASCII character`)
+		}
+		lit = unicode.ToUpper(rune(p.pattern[p.pos])) ^ 0x40
+	case literals[c] != 0:
+		lit = literals[c]
+	case c < utf8.RuneSelf && !isWordByte(c):
+		lit = rune(c)
+	default:
+		return 0, false, nil, p.errorf(start, "unrecognized escape sequence")
+	}
+	p.pos++
+	return lit, false, nil, nil
+}
+
+// dialectUnicodeClass parses a Unicode class like \pL or \p{^Greek} of Go
+// or PCRE, which starts at start.
+func (p *parser) dialectUnicodeClass(start int) (
+	lit rune,
+	isByte bool,
+	class *classNode,
+	err error,
+) {
+	negated := p.pattern[p.pos] == 'P'
+	p.pos++
+	var name string
+	if p.peek("{") {
+		end := strings.IndexByte(p.pattern[p.pos:], '}')
+		if end < 0 {
+			return 0, false, nil, p.errorf(start, "unclosed Unicode class")
+		}
+		name = p.pattern[p.pos+1 : p.pos+end]
+		p.pos += end + 1
+	} else if !p.eof() {
+		_, size := utf8.DecodeRuneInString(p.pattern[p.pos:])
+		name = p.pattern[p.pos : p.pos+size]
+		p.pos += size
+	}
+	if strings.HasPrefix(name, "^") {
+		negated = !negated
+		name = name[1:]
+	}
+	if p.dialect == DialectPCRE && (name == "L&" || name == "L_") {
+		name = "LC"
+	}
+	if name == "" {
+		return 0, false, nil, p.errorf(start, "empty Unicode class")
+	}
+	class = &classNode{
+		kind:    classUnicode,
+		start:   start,
+		end:     p.pos,
+		negated: negated,
+		name:    name,
+	}
+	return 0, false, class, nil
+}
+
+// dialectHex parses the \x escape of Go or PCRE, which starts at start. Go
+// requires two digits without braces, and PCRE allows up to two.
+func (p *parser) dialectHex(start int) (
+	lit rune,
+	isByte bool,
+	class *classNode,
+	err error,
+) {
+	p.pos++
+	var digits string
+	if p.peek("{") {
+		end := strings.IndexByte(p.pattern[p.pos:], '}')
+		if end < 0 {
+			return 0, false, nil, p.errorf(start,
+				"unclosed hexadecimal escape")
+		}
+		digits = p.pattern[p.pos+1 : p.pos+end]
+		p.pos += end + 1
+	} else {
+		at := p.pos
+		for p.pos < at+2 && !p.eof() && strings.IndexByte(
+			"0123456789abcdefABCDEF", p.pattern[p.pos]) >= 0 {
+			p.pos++
+		}
+		digits = p.pattern[at:p.pos]
+		if p.dialect == DialectGo && len(digits) < 2 {
+			return 0, false, nil, p.errorf(start,
+				"incomplete hexadecimal escape")
+		}
+		if digits == "" {
+			digits = "0"
+		}
+	}
+	cp, perr := strconv.ParseUint(digits, 16, 32)
+	return p.scalarValue(start, cp, perr)
+}
+
+// octal parses an escape sequence of digits at start, which inClass is true
+// for in a bracketed class. In Go, \1 to \7 are octal if followed by another
+// octal digit, and are backreferences otherwise. In PCRE, outside of a class,
+// the digits are a backreference if their decimal number is less than 10,
+// starts with 8 or 9, or is at most the number of groups before it, and are
+// octal otherwise. In a PCRE class, \8 and \9 are literals, and anything
+// else is octal. Octal escapes have up to three digits.
+func (p *parser) octal(start int, inClass bool) (
+	lit rune,
+	isByte bool,
+	class *classNode,
+	err error,
+) {
+	isOctal := func(i int) bool {
+		return i < len(p.pattern) && p.pattern[i] >= '0' && p.pattern[i] <= '7'
+	}
+	c := p.pattern[p.pos]
+	backref := false
+	switch {
+	case c == '0':
+	case p.dialect == DialectGo:
+		backref = !isOctal(p.pos) || !isOctal(p.pos+1)
+	case inClass && c >= '8':
+		p.pos++
+		return rune(c), false, nil, nil
+	case !inClass:
+		end := p.pos
+		for end < len(p.pattern) && p.pattern[end] >= '0' &&
+			p.pattern[end] <= '9' {
+			end++
+		}
+		number, nerr := strconv.Atoi(p.pattern[p.pos:end])
+		backref = nerr == nil &&
+			(number < 10 || c >= '8' || number < len(p.names))
+	}
+	if backref {
+		return 0, false, nil, p.errorf(start,
+			"backreferences are not supported")
+	}
+	at := p.pos
+	for p.pos < at+3 && isOctal(p.pos) {
+		p.pos++
+	}
+	cp, perr := strconv.ParseUint(p.pattern[at:p.pos], 8, 32)
+	return p.scalarValue(start, cp, perr)
+}
+
+// scalarValue returns the codepoint of an escape sequence at start, or an
+// error if it isn't a Unicode scalar value.
+func (p *parser) scalarValue(start int, cp uint64, err error) (
+	rune,
+	bool,
+	*classNode,
+	error,
+) {
+	if err != nil || cp > unicode.MaxRune || cp >= 0xD800 && cp <= 0xDFFF {
+		return 0, false, nil, p.errorf(start,
+			"escape sequence is not a Unicode scalar value")
+	}
+	return rune(cp), false, nil, nil
+}
+
+// dialectPrinter prints a syntax tree in the syntax of a dialect.
+type dialectPrinter struct {
+	// pattern is the pattern that the tree was parsed from.
+	pattern string
+	dialect Dialect
+	out     strings.Builder
+	// flags are the flags in effect at the end of out.
+	flags uint32
+}
+
+func (pr *dialectPrinter) errorf(n *node, format string,
+	args ...interface{}) error {
+	return &SyntaxError{pr.pattern, n.start, fmt.Sprintf(format, args...)}
+}
+
+// flagMask returns the flags that can be set inline in the dialect. Go and
+// PCRE have no u flag, since they are always in Unicode mode.
+func (pr *dialectPrinter) flagMask() uint32 {
+	mask := uint32(FlagCaseI | FlagMulti | FlagDotNL | FlagSwapGreed)
+	if pr.dialect == DialectRust {
+		mask |= FlagUnicode
+	}
+	return mask
+}
+
+// setFlags returns the text of the inline flags, such as "i-s", that change
+// the flags in effect to want, for the flags in mask.
+func (pr *dialectPrinter) setFlags(want, mask uint32) string {
+	diff := (want ^ pr.flags) & mask & pr.flagMask()
+	on := inlineflags.Format(want & diff)
+	if off := inlineflags.Format(pr.flags & diff); off != "" {
+		return on + "-" + off
+	}
+	return on
+}
+
+// withFlags calls print with the flags in mask set as in want, wrapping its
+// output in a group like (?i:...) if they aren't already.
+func (pr *dialectPrinter) withFlags(want, mask uint32,
+	print func() error) error {
+	set := pr.setFlags(want, mask)
+	if set == "" {
+		return print()
+	}
+	saved := pr.flags
+	mask &= pr.flagMask()
+	pr.flags = pr.flags&^mask | want&mask
+	pr.out.WriteString("(?" + set + ":")
+	err := print()
+	pr.out.WriteByte(')')
+	pr.flags = saved
+	return err
+}
+
+func (pr *dialectPrinter) write(s string) error {
+	pr.out.WriteString(s)
+	return nil
+}
+
+func (pr *dialectPrinter) node(n *node) error {
+	switch n.kind {
+	case nodeLiteral:
+		return pr.literal(n)
+	case nodeDot:
+		if pr.dialect != DialectRust {
+			if n.flags&FlagUnicode == 0 {
+				return pr.errorf(n, "'.' matches arbitrary bytes when "+
+					"Unicode mode is disabled, which %s doesn't support",
+					pr.dialect)
+			}
+			if n.crlf && n.flags&FlagDotNL == 0 {
+				return pr.errorf(n, "CRLF mode is not supported by %s",
+					pr.dialect)
+			}
+		}
+		return pr.withFlags(n.flags, FlagDotNL|FlagUnicode, func() error {
+			return pr.write(".")
+		})
+	case nodeClass:
+		return pr.class(n)
+	case nodeAssertion:
+		return pr.assertion(n)
+	case nodeRepetition:
+		return pr.repetition(n)
+	case nodeGroup:
+		return pr.group(n)
+	case nodeFlags:
+		if set := pr.setFlags(n.flags, pr.flagMask()); set != "" {
+			pr.out.WriteString("(?" + set + ")")
+			pr.flags = n.flags & pr.flagMask()
+		}
+	case nodeConcat:
+		for _, sub := range n.subs {
+			if err := pr.node(sub); err != nil {
+				return err
+			}
+		}
+	case nodeAlternation:
+		for i, sub := range n.subs {
+			if i > 0 {
+				pr.out.WriteByte('|')
+			}
+			if err := pr.node(sub); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (pr *dialectPrinter) literal(n *node) error {
+	if n.isByte {
+		if pr.dialect != DialectRust {
+			return pr.errorf(n, "%s doesn't support matching the byte "+
+				`\x%02X`, pr.dialect, n.lit)
+		}
+		return pr.withFlags(n.flags, FlagCaseI|FlagUnicode, func() error {
+			return pr.write(fmt.Sprintf(`\x%02X`, n.lit))
+		})
+	}
+	if n.flags&(FlagCaseI|FlagUnicode) == FlagCaseI {
+		// Only ASCII letters have their case ignored when Unicode mode is
+		// disabled, and so k doesn't match the Kelvin sign.
+		folded := foldRanges([]RuneRange{{n.lit, n.lit}}, true)
+		return pr.withFlags(0, FlagCaseI, func() error {
+			if len(folded) == 1 {
+				return pr.write(escapeLiteral(n.lit))
+			}
+			return pr.write(printRanges(folded))
+		})
+	}
+	return pr.withFlags(n.flags, FlagCaseI, func() error {
+		return pr.write(escapeLiteral(n.lit))
+	})
+}
+
+// escapeLiteral returns the text of a literal outside of a bracketed class.
+func escapeLiteral(r rune) string {
+	if strings.ContainsRune(`\.+*?()|[]{}^$#`, r) {
+		return `\` + string(r)
+	}
+	return escapeRune(r)
+}
+
+// escapeClassRune returns the text of a literal in a bracketed class.
+func escapeClassRune(r rune) string {
+	if strings.ContainsRune(`\[]^-&~`, r) {
+		return `\` + string(r)
+	}
+	return escapeRune(r)
+}
+
+// escapeRune returns r, or an escape sequence for it if it isn't a printable
+// character or a space.
+func escapeRune(r rune) string {
+	if r != ' ' && (!unicode.IsPrint(r) || unicode.IsSpace(r)) {
+		return fmt.Sprintf(`\x{%X}`, r)
+	}
+	return string(r)
+}
+
+// printRanges returns a bracketed class that matches ranges.
+func printRanges(ranges []RuneRange) string {
+	if len(ranges) == 0 {
+		return `[^\x00-\x{10FFFF}]`
+	}
+	var buf strings.Builder
+	buf.WriteByte('[')
+	for _, r := range ranges {
+		writeRange(&buf, r.Lo, r.Hi)
+	}
+	buf.WriteByte(']')
+	return buf.String()
+}
+
+// writeRange writes a range in a bracketed class to buf.
+func writeRange(buf *strings.Builder, lo, hi rune) {
+	buf.WriteString(escapeClassRune(lo))
+	if hi > lo {
+		if hi > lo+1 {
+			buf.WriteByte('-')
+		}
+		buf.WriteString(escapeClassRune(hi))
+	}
+}
+
+// class prints a class. Classes that can't be written in the dialect as
+// they are, such as class set operations and Rust's Unicode-aware \w, are
+// expanded into ranges.
+func (pr *dialectPrinter) class(n *node) error {
+	if n.flags&FlagUnicode != 0 {
+		if text, ok := simpleClass(n.class); ok {
+			return pr.withFlags(n.flags, FlagCaseI|FlagUnicode, func() error {
+				return pr.write(text)
+			})
+		}
+	}
+	ranges, ok := classRanges(n.class, n.flags)
+	if !ok {
+		return pr.errorf(n, "%s has no equivalent in %s",
+			pr.pattern[n.start:n.end], pr.dialect)
+	}
+	if n.flags&FlagUnicode == 0 && pr.dialect != DialectRust {
+		for _, r := range ranges {
+			if r.Hi > unicode.MaxASCII {
+				return pr.errorf(n, "%s matches arbitrary bytes when "+
+					"Unicode mode is disabled, which %s doesn't support",
+					pr.pattern[n.start:n.end], pr.dialect)
+			}
+		}
+	}
+	// The ranges already include the case folding of the class.
+	return pr.withFlags(n.flags&^FlagCaseI, FlagCaseI|FlagUnicode,
+		func() error {
+			return pr.write(printRanges(ranges))
+		})
+}
+
+// simpleClass returns the text of a Unicode mode class in a form that every
+// dialect supports, or false if it has none.
+func simpleClass(c *classNode) (string, bool) {
+	switch c.kind {
+	case classBracket:
+		union := c.items[0]
+		if union.kind != classUnion || len(union.items) == 0 {
+			return "", false
+		}
+		var buf strings.Builder
+		for _, item := range union.items {
+			body, ok := simpleClassBody(item)
+			if !ok {
+				return "", false
+			}
+			buf.WriteString(body)
+		}
+		if c.negated {
+			return "[^" + buf.String() + "]", true
+		}
+		return "[" + buf.String() + "]", true
+	case classPerl:
+		if c.name == "d" {
+			return simpleClassBody(c)
+		}
+		body, ok := simpleClassBody(&classNode{kind: classPerl, name: c.name})
+		if c.negated {
+			return "[^" + body + "]", ok
+		}
+		return "[" + body + "]", ok
+	}
+	return simpleClassBody(c)
+}
+
+// simpleClassBody is like simpleClass, but for a member of a bracketed
+// class, and so it returns the text without brackets.
+func simpleClassBody(c *classNode) (string, bool) {
+	switch c.kind {
+	case classRange:
+		var buf strings.Builder
+		writeRange(&buf, c.lo, c.hi)
+		return buf.String(), true
+	case classASCII:
+		if c.negated {
+			return "[:^" + c.name + ":]", true
+		}
+		return "[:" + c.name + ":]", true
+	case classUnicode:
+		name, ok := dialectUnicodeName(c.name)
+		if !ok {
+			return "", false
+		}
+		if c.negated {
+			return `\P{` + name + `}`, true
+		}
+		return `\p{` + name + `}`, true
+	case classPerl:
+		switch {
+		case c.name == "d" && c.negated:
+			return `\P{Nd}`, true
+		case c.name == "d":
+			return `\p{Nd}`, true
+		case c.negated:
+			return "", false
+		}
+		var buf strings.Builder
+		ranges := perlRanges(c.name[0], true)
+		if c.name == "w" {
+			// Most of \w is made of general categories, which are shorter
+			// than their ranges.
+			buf.WriteString(`\p{L}\p{Nl}\p{M}\p{Nd}\p{Pc}`)
+			ranges = subtractRanges(ranges, tableRanges(unicode.L, unicode.Nl,
+				unicode.M, unicode.Nd, unicode.Pc))
+		}
+		for _, r := range ranges {
+			writeRange(&buf, r.Lo, r.Hi)
+		}
+		return buf.String(), true
+	}
+	return "", false
+}
+
+// dialectUnicodeName returns the name of a Unicode class in the form that
+// Go's tables use, which PCRE and Rust also accept, or false if Go has no
+// such table.
+func dialectUnicodeName(name string) (string, bool) {
+	if i := strings.IndexAny(name, "=:"); i >= 0 {
+		switch looseName(name[:i]) {
+		case "generalcategory", "gc", "script", "sc":
+			name = name[i+1:]
+		default:
+			return "", false
+		}
+	}
+	exact, ok := unicodeTables()[looseName(name)]
+	return exact, ok
+}
+
+func (pr *dialectPrinter) assertion(n *node) error {
+	multi := pr.flags&FlagMulti != 0
+	switch n.assert {
+	case assertStartText:
+		if multi {
+			return pr.write(`\A`)
+		}
+		return pr.write("^")
+	case assertEndText:
+		// PCRE's $ also matches before a new line at the end of the text.
+		if multi || pr.dialect == DialectPCRE {
+			return pr.write(`\z`)
+		}
+		return pr.write("$")
+	case assertStartLine, assertEndLine:
+		if n.crlf && pr.dialect != DialectRust {
+			return pr.errorf(n, "CRLF mode is not supported by %s",
+				pr.dialect)
+		}
+		text := map[assertKind]string{
+			assertStartLine: "^",
+			assertEndLine:   "$",
+		}[n.assert]
+		return pr.withFlags(FlagMulti, FlagMulti, func() error {
+			return pr.write(text)
+		})
+	}
+
+	if pr.dialect == DialectRust {
+		text := map[assertKind]string{
+			assertWordBoundary:    `\b`,
+			assertNotWordBoundary: `\B`,
+			assertWordStart:       `\b{start}`,
+			assertWordEnd:         `\b{end}`,
+			assertWordStartHalf:   `\b{start-half}`,
+			assertWordEndHalf:     `\b{end-half}`,
+		}[n.assert]
+		return pr.withFlags(n.flags, FlagUnicode, func() error {
+			return pr.write(text)
+		})
+	}
+	if n.flags&FlagUnicode != 0 {
+		return pr.errorf(n, "Unicode-aware word boundaries are not "+
+			`supported by %s; use (?-u:\b) for an ASCII word boundary`,
+			pr.dialect)
+	}
+	text, ok := map[assertKind]string{
+		assertWordBoundary:    `\b`,
+		assertNotWordBoundary: `\B`,
+	}[n.assert]
+	if !ok && pr.dialect == DialectPCRE {
+		text, ok = map[assertKind]string{
+			assertWordStart:     `\b(?=\w)`,
+			assertWordEnd:       `\b(?<=\w)`,
+			assertWordStartHalf: `(?<!\w)`,
+			assertWordEndHalf:   `(?!\w)`,
+		}[n.assert]
+	}
+	if !ok {
+		return pr.errorf(n, "%s is not supported by %s",
+			pr.pattern[n.start:n.end], pr.dialect)
+	}
+	return pr.write(text)
+}
+
+func (pr *dialectPrinter) repetition(n *node) error {
+	limit := map[Dialect]int{DialectGo: 1000, DialectPCRE: 65535}[pr.dialect]
+	if limit > 0 && (n.min > limit || n.max > limit) {
+		return pr.errorf(n, "%s doesn't support repetition counts above %d",
+			pr.dialect, limit)
+	}
+	// Nested repetitions are only allowed by Rust, and a repetition of a
+	// repetition could be read as a lazy or possessive one.
+	sub := n.subs[0]
+	wrap := sub.kind == nodeRepetition ||
+		pr.dialect != DialectRust && sub.kind == nodeAssertion
+	if wrap {
+		pr.out.WriteString("(?:")
+	}
+	if err := pr.node(sub); err != nil {
+		return err
+	}
+	if wrap {
+		pr.out.WriteByte(')')
+	}
+	switch {
+	case n.min == 0 && n.max == -1:
+		pr.out.WriteByte('*')
+	case n.min == 1 && n.max == -1:
+		pr.out.WriteByte('+')
+	case n.min == 0 && n.max == 1:
+		pr.out.WriteByte('?')
+	case n.max == -1:
+		fmt.Fprintf(&pr.out, "{%d,}", n.min)
+	case n.min == n.max:
+		fmt.Fprintf(&pr.out, "{%d}", n.min)
+	default:
+		fmt.Fprintf(&pr.out, "{%d,%d}", n.min, n.max)
+	}
+	// The U flag swaps the meaning of the trailing ?.
+	if n.greedy == (pr.flags&FlagSwapGreed != 0) {
+		pr.out.WriteByte('?')
+	}
+	return nil
+}
+
+func (pr *dialectPrinter) group(n *node) error {
+	saved := pr.flags
+	switch {
+	case n.name != "":
+		if pr.dialect != DialectRust && !isWordName(n.name) ||
+			pr.dialect == DialectPCRE && n.name[0] <= '9' {
+			return pr.errorf(n, "capture group name %q is not supported "+
+				"by %s", n.name, pr.dialect)
+		}
+		pr.out.WriteString("(?P<" + n.name + ">")
+	case n.index > 0:
+		pr.out.WriteByte('(')
+	default:
+		set := pr.setFlags(n.flags, pr.flagMask())
+		pr.out.WriteString("(?" + set + ":")
+		pr.flags = n.flags & pr.flagMask()
+	}
+	err := pr.node(n.subs[0])
+	pr.out.WriteByte(')')
+	pr.flags = saved
+	return err
+}
@@ -0,0 +1,182 @@
+package rure
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranslateDialects(t *testing.T) {
+	for _, test := range []struct {
+		from, to Dialect
+		pattern  string
+		want     string
+	}{
+		{DialectGo, DialectRust, `a+b`, `a+b`},
+		{DialectGo, DialectRust, `\d\D\w\s`,
+			`[0-9][^0-9][0-9A-Z_a-z][\x{9}\x{A}\x{C}\x{D} ]`},
+		{DialectGo, DialectRust, `\bfoo\B`, `(?-u:\b)foo(?-u:\B)`},
+		{DialectGo, DialectRust, `[\d_]\p{^Greek}`, `[0-9_]\P{Greek}`},
+		{DialectGo, DialectRust, `a{,2}\Q.*\E\101`, `a\{,2\}\.\*A`},
+		{DialectGo, DialectRust, `(?i)(?P<x>a)(?<y>b)(?U:c*?)`,
+			`(?i)(?P<x>a)(?P<y>b)(?U:c*?)`},
+		{DialectPCRE, DialectRust, `(?x) a b # c`, `ab`},
+		{DialectPCRE, DialectRust, `(?<a>x)(?'b'y)(?#c)z*`,
+			`(?P<a>x)(?P<b>y)z*`},
+		{DialectPCRE, DialectRust, `\s\N\e\cA\x7`,
+			`[\x{9}-\x{D} ][^\x{A}]\x{1B}\x{1}\x{7}`},
+		{DialectPCRE, DialectRust, `(?i)\w`, `(?i)(?-i:[0-9A-Z_a-z])`},
+		{DialectPCRE, DialectRust, `(?m)^a$|\Aa\z`, `(?m)^a$|\Aa\z`},
+		{DialectPCRE, DialectRust, `\p{L&}`, `\p{LC}`},
+		{DialectPCRE, DialectGo, `(?m)^foo$`, `(?m)^foo$`},
+		{DialectPCRE, DialectRust, `\101\12`, `A\x{A}`},
+		{DialectPCRE, DialectRust, `(a)\12`, `(a)\x{A}`},
+		{DialectPCRE, DialectRust, `\18[\1\8]`, `\x{1}8[\x{1}8]`},
+		{DialectRust, DialectGo, `\d+`, `\p{Nd}+`},
+		{DialectRust, DialectGo, `\w`,
+			`[\p{L}\p{Nl}\p{M}\p{Nd}\p{Pc}\x{200C}\x{200D}Ⓐ-ⓩ🄰-🅉🅐-🅩🅰-🆉]`},
+		{DialectRust, DialectGo, `(?-u:\b\w+\b)`,
+			`(?:\b[0-9A-Z_a-z]+\b)`},
+		{DialectRust, DialectGo, `[a-z&&[^aeiou]]`, `[b-df-hj-np-tv-z]`},
+		{DialectRust, DialectGo, `\p{sc=Greek}\p{gc=Lu}`,
+			`\p{Greek}\p{Lu}`},
+		{DialectRust, DialectGo, `(?i-u)k`, `(?i)(?-i:[Kk])`},
+		{DialectRust, DialectGo, `(?U)a+b+?a**`, `(?U)a+b+?(?:a*)*`},
+		{DialectRust, DialectGo, `(?m)^a$`, `(?m)^a$`},
+		{DialectRust, DialectPCRE, `^a$`, `^a\z`},
+		{DialectRust, DialectPCRE, `(?-u:\b{start}a\b{end-half})`,
+			`(?:\b(?=\w)a(?!\w))`},
+		{DialectGo, DialectPCRE, `\s`, `[\x{9}\x{A}\x{C}\x{D} ]`},
+		{DialectGo, DialectGo, `\d`, `\d`},
+	} {
+		if test.from == DialectRust {
+			if _, err := Compile(test.pattern); err != nil {
+				// The pure Go fallback can't compile some Rust patterns.
+				continue
+			}
+		}
+		got, err := Translate(test.pattern, test.from, test.to)
+		require.NoError(t, err, test.pattern)
+		require.Equal(t, test.want, got, "%s from %s to %s",
+			test.pattern, test.from, test.to)
+	}
+}
+
+func TestTranslateErrors(t *testing.T) {
+	for _, test := range []struct {
+		from, to Dialect
+		pattern  string
+		offset   int
+		message  string
+	}{
+		{DialectPCRE, DialectRust, `(a)\1`, 3, "backreferences"},
+		{DialectPCRE, DialectRust, `(?P<a>x)(?P=a)`, 8, "backreferences"},
+		{DialectPCRE, DialectRust, `\k<a>`, 0, "backreferences"},
+		{DialectPCRE, DialectRust, `ab(?=c)`, 2, "look-around"},
+		{DialectPCRE, DialectRust, `a(?<!c)`, 1, "look-around"},
+		{DialectPCRE, DialectRust, `x(?>a)`, 1, "atomic groups"},
+		{DialectPCRE, DialectRust, `ab*+`, 3, "possessive"},
+		{DialectPCRE, DialectRust, `^foo$`, 4, `use \z`},
+		{DialectPCRE, DialectRust, `a\Z|b`, 1, `\n?\z`},
+		{DialectPCRE, DialectGo, `(?x) a $ # end`, 7, "no equivalent"},
+		{DialectPCRE, DialectRust, `a$b`, 1, `use \z`},
+		{DialectPCRE, DialectRust, `(a)(b)\2`, 6, "backreferences"},
+		{DialectPCRE, DialectRust, `\81`, 0, "backreferences"},
+		{DialectPCRE, DialectRust, `(a)(?1)`, 3, "recursion"},
+		{DialectPCRE, DialectRust, `(*UTF)a`, 0, "verbs"},
+		{DialectPCRE, DialectRust, `\Ka`, 0, `\K`},
+		{DialectGo, DialectRust, `a\1`, 1, "backreferences"},
+		{DialectGo, DialectRust, `a(?=b)`, 1, "look-around"},
+		{DialectGo, DialectRust, `(?x)a`, 2, "unrecognized flag"},
+		{DialectGo, DialectRust, `a**`, 2, "nested repetition"},
+		{DialectGo, DialectRust, `a{1001}`, 1, "invalid repeat count"},
+		{DialectRust, DialectGo, `a\bb`, 1, "word boundaries"},
+		{DialectRust, DialectGo, `(?-u:a\b{start})`, 6, "not supported"},
+		{DialectRust, DialectGo, `(?-u:.)`, 5, "arbitrary bytes"},
+		{DialectRust, DialectGo, `(?-u:[^a])`, 5, "arbitrary bytes"},
+		{DialectRust, DialectGo, `(?-u:\xFF)`, 5, "byte"},
+		{DialectRust, DialectGo, `a\p{Emoji}`, 1, "no equivalent"},
+		{DialectRust, DialectGo, `a{1001}`, 0, "counts above 1000"},
+		{DialectRust, DialectGo, `(?P<a.b>x)`, 0, "name"},
+		{DialectRust, DialectPCRE, `(?Rm)^a`, 5, "CRLF"},
+	} {
+		_, err := Translate(test.pattern, test.from, test.to)
+		require.Error(t, err, test.pattern)
+		serr, ok := err.(*SyntaxError)
+		if !ok && test.from == DialectRust {
+			// The pure Go fallback can't compile some of the Rust patterns.
+			continue
+		}
+		require.True(t, ok, "%s: %v", test.pattern, err)
+		require.Equal(t, test.pattern, serr.Pattern)
+		require.Equal(t, test.offset, serr.Offset, "%s: %v", test.pattern, err)
+		require.Contains(t, serr.Message, test.message, test.pattern)
+	}
+}
+
+// TestTranslateGo checks that Go patterns translated to Rust match the same
+// text as they do with Go's regexp package.
+func TestTranslateGo(t *testing.T) {
+	texts := []string{
+		"", "abc", "ABC", "a1_b", "foo bar", "x\vy", "x\fy", "é", "١٢",
+		"Kelvin K", "ſ", "a\nb", "αβγ", "  \t", "{,2}", "a.*",
+	}
+	for _, pattern := range []string{
+		`\d+`, `\D+`, `\w+`, `\W+`, `\s+`, `\S+`, `\b\w+\b`, `\B.`,
+		`(?i)k`, `(?i)[a-z]+`, `(?i)\w+`, `[^\d\s]+`, `[[:alpha:]]+`,
+		`\pL+`, `\p{Greek}+`, `\P{L}+`, `a{,2}`, `\Qa.*\E`, `(?s)a.b`,
+		`(?m)^b`, `a$`, `(?U)\w+`, `x[\v\f]y`, `\x{e9}`, `[\x{3b1}-\x{3b3}]+`,
+	} {
+		translated, err := Translate(pattern, DialectGo, DialectRust)
+		require.NoError(t, err, pattern)
+		goRe := regexp.MustCompile(pattern)
+		re := MustCompile(translated)
+		for _, text := range texts {
+			want := goRe.FindStringIndex(text)
+			start, end, ok := re.Find(text)
+			if want == nil {
+				require.False(t, ok, "%s (%s) on %q", pattern, translated, text)
+				continue
+			}
+			require.True(t, ok, "%s (%s) on %q", pattern, translated, text)
+			require.Equal(t, want, []int{start, end},
+				"%s (%s) on %q", pattern, translated, text)
+		}
+	}
+}
+
+// TestTranslateRust checks that Rust patterns translated to Go match the
+// same text as they do with this package.
+func TestTranslateRust(t *testing.T) {
+	texts := []string{
+		"", "abc", "ABC", "a1_b", "foo bar", "x\vy", "x\u00a0y", "é",
+		"١٢", "Kelvin \u212a", "ſ", "a\nb", "αβγ ΑΒΓ", "  \t", "a.*",
+	}
+	for _, pattern := range []string{
+		`\d+`, `\D+`, `\w+`, `\s+`, `\S+`, `(?-u:\b)\w+`, `(?-u:\w+)`,
+		`(?i)k`, `(?i-u)k`, `(?-u:[a-z]+)`, `[a-z&&[^aeiou]]+`,
+		`\p{Greek}+`, `\p{sc=Greek}+`, `[\pL--\p{Greek}]+`, `(?m)^\w+$`,
+		`(?U)a+`, `^a`, `b$`, `(?s).`,
+	} {
+		re, err := Compile(pattern)
+		if err != nil {
+			// The pure Go fallback can't compile some Rust patterns.
+			continue
+		}
+		translated, err := Translate(pattern, DialectRust, DialectGo)
+		require.NoError(t, err, pattern)
+		goRe := regexp.MustCompile(translated)
+		for _, text := range texts {
+			want := goRe.FindStringIndex(text)
+			start, end, ok := re.Find(text)
+			if want == nil {
+				require.False(t, ok, "%s (%s) on %q", pattern, translated, text)
+				continue
+			}
+			require.True(t, ok, "%s (%s) on %q", pattern, translated, text)
+			require.Equal(t, want, []int{start, end},
+				"%s (%s) on %q", pattern, translated, text)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package rure
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// generalCategoryAliases maps the long names of general categories, which
+// Rust accepts, to the short names used by Go.
+var generalCategoryAliases = map[string]string{
+	"Letter":                "L",
+	"Uppercase_Letter":      "Lu",
+	"Lowercase_Letter":      "Ll",
+	"Titlecase_Letter":      "Lt",
+	"Modifier_Letter":       "Lm",
+	"Other_Letter":          "Lo",
+	"Mark":                  "M",
+	"Combining_Mark":        "M",
+	"Nonspacing_Mark":       "Mn",
+	"Spacing_Mark":          "Mc",
+	"Enclosing_Mark":        "Me",
+	"Number":                "N",
+	"Decimal_Number":        "Nd",
+	"Digit":                 "Nd",
+	"Letter_Number":         "Nl",
+	"Other_Number":          "No",
+	"Punctuation":           "P",
+	"Connector_Punctuation": "Pc",
+	"Dash_Punctuation":      "Pd",
+	"Open_Punctuation":      "Ps",
+	"Close_Punctuation":     "Pe",
+	"Initial_Punctuation":   "Pi",
+	"Final_Punctuation":     "Pf",
+	"Other_Punctuation":     "Po",
+	"Symbol":                "S",
+	"Math_Symbol":           "Sm",
+	"Currency_Symbol":       "Sc",
+	"Modifier_Symbol":       "Sk",
+	"Other_Symbol":          "So",
+	"Separator":             "Z",
+	"Space_Separator":       "Zs",
+	"Line_Separator":        "Zl",
+	"Paragraph_Separator":   "Zp",
+	"Other":                 "C",
+	"Control":               "Cc",
+	"Format":                "Cf",
+	"Surrogate":             "Cs",
+	"Private_Use":           "Co",
+}
+
+var (
+	unicodeTablesOnce sync.Once
+	unicodeTablesMap  map[string]string
+)
+
+// unicodeTables returns a map from the loose form of every Unicode class name
+// that Go supports to its exact name.
+func unicodeTables() map[string]string {
+	unicodeTablesOnce.Do(func() {
+		tables := map[string]string{"any": "Any"}
+		for name := range unicode.Scripts {
+			tables[looseName(name)] = name
+		}
+		// General categories are added last so that they take precedence
+		// over a script with the same loose name, as in Rust.
+		for name := range unicode.Categories {
+			tables[looseName(name)] = name
+		}
+		for alias, name := range generalCategoryAliases {
+			tables[looseName(alias)] = name
+		}
+		unicodeTablesMap = tables
+	})
+	return unicodeTablesMap
+}
+
+// looseName implements Unicode's loose matching of property names and
+// values, which ignores case, whitespace, underscores and hyphens.
+func looseName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '_' || r == '-' || unicode.IsSpace(r):
+			return -1
+		default:
+			return unicode.ToLower(r)
+		}
+	}, name)
+}
+
+// maxRune is the largest codepoint that a class can match in Unicode mode,
+// and maxByte is the largest byte that a class can match when Unicode mode
+// is disabled.
+const (
+	maxRune = unicode.MaxRune
+	maxByte = 0xFF
+)
+
+// surrogates are the codepoints that aren't Unicode scalar values, which a
+// class never matches in Unicode mode.
+var surrogates = []RuneRange{{0xD800, 0xDFFF}}
+
+// normalizeRanges sorts ranges and merges those that overlap or are
+// adjacent.
+func normalizeRanges(ranges []RuneRange) []RuneRange {
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].Lo < ranges[j].Lo
+	})
+	var out []RuneRange
+	for _, r := range ranges {
+		if n := len(out); n > 0 && r.Lo <= out[n-1].Hi+1 {
+			if r.Hi > out[n-1].Hi {
+				out[n-1].Hi = r.Hi
+			}
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+func unionRanges(a, b []RuneRange) []RuneRange {
+	return normalizeRanges(append(append([]RuneRange(nil), a...), b...))
+}
+
+// negateRanges returns the ranges in [0, max] that aren't in ranges, which
+// must be normalized.
+func negateRanges(ranges []RuneRange, max rune) []RuneRange {
+	var out []RuneRange
+	next := rune(0)
+	for _, r := range ranges {
+		if r.Lo > next {
+			out = append(out, RuneRange{next, r.Lo - 1})
+		}
+		next = r.Hi + 1
+	}
+	if next <= max {
+		out = append(out, RuneRange{next, max})
+	}
+	return out
+}
+
+// intersectRanges returns the ranges in both a and b, which must be
+// normalized.
+func intersectRanges(a, b []RuneRange) []RuneRange {
+	var out []RuneRange
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		lo, hi := a[i].Lo, a[i].Hi
+		if b[j].Lo > lo {
+			lo = b[j].Lo
+		}
+		if b[j].Hi < hi {
+			hi = b[j].Hi
+		}
+		if lo <= hi {
+			out = append(out, RuneRange{lo, hi})
+		}
+		if a[i].Hi < b[j].Hi {
+			i++
+		} else {
+			j++
+		}
+	}
+	return out
+}
+
+// subtractRanges returns the ranges in a that aren't in b, which must be
+// normalized.
+func subtractRanges(a, b []RuneRange) []RuneRange {
+	return intersectRanges(a, negateRanges(b, maxRune))
+}
+
+// symmetricDifferenceRanges returns the ranges in either a or b but not
+// both, which must be normalized.
+func symmetricDifferenceRanges(a, b []RuneRange) []RuneRange {
+	return subtractRanges(unionRanges(a, b), intersectRanges(a, b))
+}
+
+var (
+	maxFoldOnce sync.Once
+	maxFold     rune
+)
+
+// foldRanges adds every codepoint that is equivalent under simple case
+// folding to a codepoint in ranges. If ascii is true, then only ASCII
+// letters are folded, as when Unicode mode is disabled.
+func foldRanges(ranges []RuneRange, ascii bool) []RuneRange {
+	maxFoldOnce.Do(func() {
+		maxFold = rune(unicode.CaseRanges[len(unicode.CaseRanges)-1].Hi)
+	})
+	limit := maxFold
+	if ascii {
+		limit = unicode.MaxASCII
+	}
+	out := append([]RuneRange(nil), ranges...)
+	for _, r := range ranges {
+		for c := r.Lo; c <= r.Hi && c <= limit; c++ {
+			for f := unicode.SimpleFold(c); f != c; f = unicode.SimpleFold(f) {
+				if f <= limit {
+					out = append(out, RuneRange{f, f})
+				}
+			}
+		}
+	}
+	return normalizeRanges(out)
+}
+
+// tableRanges returns the codepoints in a Unicode table as ranges.
+func tableRanges(tables ...*unicode.RangeTable) []RuneRange {
+	var out []RuneRange
+	add := func(lo, hi, stride rune) {
+		if stride == 1 {
+			out = append(out, RuneRange{lo, hi})
+			return
+		}
+		for c := lo; c <= hi; c += stride {
+			out = append(out, RuneRange{c, c})
+		}
+	}
+	for _, t := range tables {
+		for _, r := range t.R16 {
+			add(rune(r.Lo), rune(r.Hi), rune(r.Stride))
+		}
+		for _, r := range t.R32 {
+			add(rune(r.Lo), rune(r.Hi), rune(r.Stride))
+		}
+	}
+	return normalizeRanges(out)
+}
+
+// perlRanges returns the codepoints matched by the Perl classes \d, \s and
+// \w, given by their lower case letter, in Unicode mode or not.
+//
+// In Unicode mode, \s is the White_Space property and \w is the union of the
+// Alphabetic property, the Mark, Decimal_Number and Connector_Punctuation
+// general categories, and the Join_Control property, as in Rust.
+func perlRanges(c byte, unicodeMode bool) []RuneRange {
+	if !unicodeMode {
+		switch c {
+		case 'd':
+			return []RuneRange{{'0', '9'}}
+		case 's':
+			return []RuneRange{{'\t', '\r'}, {' ', ' '}}
+		default:
+			return []RuneRange{{'0', '9'}, {'A', 'Z'}, {'_', '_'}, {'a', 'z'}}
+		}
+	}
+	switch c {
+	case 'd':
+		return tableRanges(unicode.Nd)
+	case 's':
+		return tableRanges(unicode.White_Space)
+	default:
+		return tableRanges(unicode.L, unicode.Nl, unicode.Other_Alphabetic,
+			unicode.M, unicode.Nd, unicode.Pc, unicode.Join_Control)
+	}
+}
+
+// asciiClasses are the ranges of the ASCII classes, such as [:alpha:], that
+// may be used in a bracketed class.
+var asciiClasses = map[string][]RuneRange{
+	"alnum":  {{'0', '9'}, {'A', 'Z'}, {'a', 'z'}},
+	"alpha":  {{'A', 'Z'}, {'a', 'z'}},
+	"ascii":  {{0, 0x7F}},
+	"blank":  {{'\t', '\t'}, {' ', ' '}},
+	"cntrl":  {{0, 0x1F}, {0x7F, 0x7F}},
+	"digit":  {{'0', '9'}},
+	"graph":  {{'!', '~'}},
+	"lower":  {{'a', 'z'}},
+	"print":  {{' ', '~'}},
+	"punct":  {{'!', '/'}, {':', '@'}, {'[', '`'}, {'{', '~'}},
+	"space":  {{'\t', '\r'}, {' ', ' '}},
+	"upper":  {{'A', 'Z'}},
+	"word":   {{'0', '9'}, {'A', 'Z'}, {'_', '_'}, {'a', 'z'}},
+	"xdigit": {{'0', '9'}, {'A', 'F'}, {'a', 'f'}},
+}
+
+var (
+	propertyTablesOnce sync.Once
+	// categoryTables, scriptTables and propertyTables map the loose forms of
+	// the names of general categories, scripts and binary properties to
+	// their ranges.
+	categoryTables map[string][]*unicode.RangeTable
+	scriptTables   map[string][]*unicode.RangeTable
+	propertyTables map[string][]*unicode.RangeTable
+)
+
+func initPropertyTables() {
+	categoryTables = map[string][]*unicode.RangeTable{}
+	for name, table := range unicode.Categories {
+		categoryTables[looseName(name)] = []*unicode.RangeTable{table}
+	}
+	for alias, name := range generalCategoryAliases {
+		categoryTables[looseName(alias)] = categoryTables[looseName(name)]
+	}
+	// Go's table of the Other category includes unassigned codepoints, so
+	// its subcategories are used instead.
+	var assigned []*unicode.RangeTable
+	for _, name := range []string{
+		"L", "M", "N", "P", "S", "Z", "Cc", "Cf", "Co", "Cs",
+	} {
+		assigned = append(assigned, unicode.Categories[name])
+	}
+	categoryTables["assigned"] = assigned
+	categoryTables["ascii"] = []*unicode.RangeTable{{
+		R16: []unicode.Range16{{Lo: 0, Hi: 0x7F, Stride: 1}},
+	}}
+	categoryTables["any"] = []*unicode.RangeTable{{
+		R32: []unicode.Range32{{Lo: 0, Hi: maxRune, Stride: 1}},
+	}}
+
+	scriptTables = map[string][]*unicode.RangeTable{}
+	for name, table := range unicode.Scripts {
+		scriptTables[looseName(name)] = []*unicode.RangeTable{table}
+	}
+
+	propertyTables = map[string][]*unicode.RangeTable{}
+	for name, table := range unicode.Properties {
+		propertyTables[looseName(name)] = []*unicode.RangeTable{table}
+	}
+	// Derived properties that Go doesn't have tables for.
+	for _, derived := range []struct {
+		names  []string
+		tables []*unicode.RangeTable
+	}{
+		{
+			[]string{"alphabetic", "alpha"},
+			[]*unicode.RangeTable{unicode.L, unicode.Nl,
+				unicode.Other_Alphabetic},
+		},
+		{
+			[]string{"lowercase", "lower"},
+			[]*unicode.RangeTable{unicode.Ll, unicode.Other_Lowercase},
+		},
+		{
+			[]string{"uppercase", "upper"},
+			[]*unicode.RangeTable{unicode.Lu, unicode.Other_Uppercase},
+		},
+		{
+			[]string{"wspace", "space"},
+			[]*unicode.RangeTable{unicode.White_Space},
+		},
+	} {
+		for _, name := range derived.names {
+			propertyTables[name] = derived.tables
+		}
+	}
+}
+
+// unicodeClassRanges returns the codepoints of a Unicode class, given by the
+// name in a \p class, such as "L" or "Script=Greek". It returns false if the
+// class is not one that Go has the tables for, such as a class of a property
+// that Go doesn't know or of a property with values other than general
+// categories and scripts.
+//
+// The tables are from the version of Unicode supported by Go's unicode
+// package, which may differ from the version supported by the Rust library,
+// and Script_Extensions is approximated by Script.
+func unicodeClassRanges(name string) ([]RuneRange, bool) {
+	propertyTablesOnce.Do(initPropertyTables)
+	var tables []*unicode.RangeTable
+	var ok bool
+	if i := strings.IndexAny(name, "=:"); i >= 0 {
+		key, value := name[:i], looseName(name[i+1:])
+		if strings.HasSuffix(key, "!") {
+			// The regex engine doesn't agree with Unicode on whether !=
+			// negates the class, so these classes aren't expanded.
+			return nil, false
+		}
+		switch looseName(key) {
+		case "generalcategory", "gc":
+			tables, ok = categoryTables[value]
+		case "script", "sc", "scriptextensions", "scx":
+			tables, ok = scriptTables[value]
+		}
+	} else {
+		name = looseName(name)
+		for _, loose := range []string{name, strings.TrimPrefix(name, "is")} {
+			if tables, ok = categoryTables[loose]; ok {
+				break
+			}
+			if tables, ok = scriptTables[loose]; ok {
+				break
+			}
+			if tables, ok = propertyTables[loose]; ok {
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil, false
+	}
+	return tableRanges(tables...), true
+}